@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// subcommands — служебные команды, которые выполняются вместо запуска сервера
+var subcommands = map[string]func(args []string) error{
+	"keygen":           runKeygen,
+	"idp-keygen":       runIDPKeygen,
+	"record-keygen":    runRecordKeygen,
+	"tree-head-keygen": runTreeHeadKeygen,
+	"export":           runExport,
+}
+
+// runSubcommand выполняет подкоманду name и завершает процесс с кодом ошибки при неудаче
+func runSubcommand(name string, args []string) {
+	command, exists := subcommands[name]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		fmt.Fprintln(os.Stderr, "usage: ev [keygen|idp-keygen|record-keygen|tree-head-keygen|export] [flags]")
+		os.Exit(2)
+	}
+
+	if err := command(args); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"ev/internal/record"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Автономная проверка выгрузки голосования, полученной с /tally/record/<id>,
+// или подписанного архива с /tally/export/<id> (ev export).
+//
+//	ev-verify -record election_1.json
+//	ev-verify -record election_1.zip -pubkey <открытый ключ record из config.json>
+//	ev-verify -record election_1.json -tree-head-key <ключ с /api/v1/tree-head-key>
+func main() {
+	recordPath := flag.String("record", "", "файл выгрузки голосования (JSON или zip-архив)")
+	publicKey := flag.String("pubkey", "", "открытый ключ Счетчика для проверки подписи архива (base64)")
+	treeHeadKey := flag.String("tree-head-key", "", "открытый ключ Счетчика для проверки подписей корней (base64)")
+	flag.Parse()
+
+	if *recordPath == "" {
+		fmt.Fprintln(os.Stderr, "usage: ev-verify -record <file> [-pubkey <base64>] [-tree-head-key <base64>]")
+		os.Exit(2)
+	}
+
+	rec, err := load(*recordPath, *publicKey)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	// Ключ из выгрузки заменяется ключом, полученным из независимого источника
+	if *treeHeadKey != "" {
+		if rec.Parameters.TreeHeadPublicKey != "" && rec.Parameters.TreeHeadPublicKey != *treeHeadKey {
+			fmt.Println("WARN  tree head key in the record differs from -tree-head-key")
+		}
+		rec.Parameters.TreeHeadPublicKey = *treeHeadKey
+	}
+
+	fmt.Printf("Voting %s: %d ballots, %d options\n", rec.VotingID, len(rec.Ballots), len(rec.Options))
+
+	failed := 0
+	for _, check := range record.Verify(rec) {
+		status := "PASS"
+		if !check.Passed {
+			status = "FAIL"
+			failed++
+		}
+		if check.Detail != "" {
+			fmt.Printf("%s  %s: %s\n", status, check.Name, check.Detail)
+		} else {
+			fmt.Printf("%s  %s\n", status, check.Name)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d check(s) failed\n", failed)
+		os.Exit(1)
+	}
+	fmt.Println("All checks passed")
+}
+
+// load читает выгрузку; у архива дополнительно проверяется подпись манифеста
+func load(path, encodedKey string) (*record.ElectionRecord, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(file, []byte("PK\x03\x04")) {
+		if encodedKey != "" {
+			return nil, fmt.Errorf("-pubkey is only applicable to signed bundles")
+		}
+		return record.Load(path, nil)
+	}
+
+	var publicKey ed25519.PublicKey
+	if encodedKey != "" {
+		publicKey, err = base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("public key is invalid")
+		}
+	}
+
+	rec, manifest, err := record.ReadBundle(file, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if publicKey == nil {
+		fmt.Println("WARN  bundle signature checked against the key embedded in the manifest; pass -pubkey to authenticate it")
+	}
+	fmt.Printf("PASS  bundle signature: %d file(s), created %s\n", len(manifest.Files), manifest.CreatedAt.Format("2006-01-02 15:04:05"))
+
+	return rec, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"ev/internal/config"
+	"ev/internal/database"
+	"ev/internal/handlers"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runExport записывает подписанный архив выгрузки голосования в файл.
+//
+//	ev export -voting 1 -out election_1.zip
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "путь к config.json")
+	cryptoPath := fs.String("crypto", "crypto.json", "путь к crypto.json")
+	votingID := fs.String("voting", "", "идентификатор голосования")
+	outPath := fs.String("out", "", "файл архива (по умолчанию election_<id>.zip)")
+	fs.Parse(args)
+
+	if *votingID == "" {
+		return fmt.Errorf("voting ID is required")
+	}
+	if *outPath == "" {
+		*outPath = "election_" + *votingID + ".zip"
+	}
+
+	if err := config.LoadConfigs(*configPath, *cryptoPath); err != nil {
+		return err
+	}
+
+	db := database.GetCounterPGConnection()
+	defer database.CloseCounterPGConnection()
+
+	file, err := os.OpenFile(*outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = handlers.ExportElectionRecord(context.Background(), db, *votingID, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*outPath)
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Election record written to", *outPath)
+	return nil
+}
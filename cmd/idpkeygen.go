@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+)
+
+// printEd25519Section генерирует ключ Ed25519 и печатает секцию name для config.json.
+// Поля extra добавляются к паре ключей
+func printEd25519Section(name string, extra map[string]interface{}) error {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]interface{}{
+		"private_key": base64.StdEncoding.EncodeToString(privateKey),
+		"public_key":  base64.StdEncoding.EncodeToString(publicKey),
+	}
+	for key, value := range extra {
+		keys[key] = value
+	}
+
+	jsoned, err := json.MarshalIndent(map[string]interface{}{name: keys}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(jsoned))
+	return nil
+}
+
+// runIDPKeygen генерирует ключ Ed25519 для подписи TempID и печатает секцию idp_credential для config.json.
+//
+//	ev idp-keygen -validity 10
+func runIDPKeygen(args []string) error {
+	fs := flag.NewFlagSet("idp-keygen", flag.ExitOnError)
+	validity := fs.Int("validity", 10, "срок действия подписанного TempID в минутах")
+	fs.Parse(args)
+
+	return printEd25519Section("idp_credential", map[string]interface{}{
+		"validity_minutes": *validity,
+	})
+}
+
+// runRecordKeygen генерирует ключ Ed25519 для подписи архивов выгрузки и печатает секцию record для config.json.
+// Открытый ключ передаётся аудиторам для ev-verify -pubkey
+//
+//	ev record-keygen
+func runRecordKeygen(args []string) error {
+	fs := flag.NewFlagSet("record-keygen", flag.ExitOnError)
+	fs.Parse(args)
+
+	return printEd25519Section("record", nil)
+}
+
+// runTreeHeadKeygen генерирует ключ Ed25519 для подписи корней журнала и печатает секцию tree_head для config.json
+//
+//	ev tree-head-keygen
+func runTreeHeadKeygen(args []string) error {
+	fs := flag.NewFlagSet("tree-head-keygen", flag.ExitOnError)
+	fs.Parse(args)
+
+	return printEd25519Section("tree_head", nil)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"ev/internal/config"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/blind_signature"
+	"ev/internal/crypto/paillier"
+	"ev/internal/crypto/zkp"
+	"ev/internal/tally"
+	"flag"
+	"fmt"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runKeygen генерирует ключи RSA и Paillier для нового голосования и дописывает их в crypto.json.
+//
+//	ev keygen -voting 1 -rsa-bits 4096 -paillier-bits 2048
+//
+// Для голосования с весами -weights перечисляет веса больше 1, для каждого генерируется
+// отдельный ключ подписи Регистратора, а -max-total-weight задаёт суммарный вес списка голосующих,
+// который должен поместиться в счетчик варианта.
+//
+// -damgard-jurik-s больше 1 включает схему Дамгорда–Юрика: открытый текст растет до s·paillier-bits бит,
+// что нужно для бюллетеней с большим числом вариантов или большими весами
+func runKeygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	cryptoPath := fs.String("crypto", "crypto.json", "путь к crypto.json")
+	votingID := fs.String("voting", "", "идентификатор голосования")
+	rsaBits := fs.Int("rsa-bits", 4096, "битность модуля RSA для слепой подписи")
+	paillierBits := fs.Int("paillier-bits", 2048, "битность модуля Paillier")
+	base := fs.Uint("base", 24, "битовый размер счетчика одного варианта ответа для голосований, созданных без подбора размера")
+	challengeBits := fs.Uint("challenge-bits", 256, "размер челленджа ZKP")
+	reVotingMultiplier := fs.Uint64("re-voting-multiplier", 3, "множитель обозначения переголосования")
+	zkpVersion := fs.Uint("zkp-version", zkp.ProofVersionContext, "минимальная версия ZKP-доказательства бюллетеня")
+	weightsList := fs.String("weights", "", "веса голосующих больше 1 через запятую, например 10,100")
+	maxTotalWeight := fs.Uint64("max-total-weight", 0, "суммарный вес всех голосующих (0 — не проверять)")
+	damgardJurikS := fs.Uint("damgard-jurik-s", 1, "степень s схемы Дамгорда–Юрика (1 — обычный Paillier)")
+	fs.Parse(args)
+
+	if *votingID == "" {
+		return errors.New("voting ID is required")
+	}
+	if *base == 0 || *base > tally.MaxBase {
+		return fmt.Errorf("base must be between 1 and %d", tally.MaxBase)
+	}
+	if *damgardJurikS == 0 {
+		return errors.New("damgard-jurik-s must be at least 1")
+	}
+	if *damgardJurikS > 1 && *zkpVersion < zkp.ProofVersionContext {
+		return errors.New("damgard-jurik-s > 1 requires zkp-version with context challenge")
+	}
+	if *reVotingMultiplier < 2 {
+		return errors.New("re-voting multiplier must be at least 2")
+	}
+
+	weights, err := parseWeights(*weightsList)
+	if err != nil {
+		return err
+	}
+	// Счетчик варианта может набрать вес всех бюллетеней
+	if *maxTotalWeight > 0 && bits.Len64(*maxTotalWeight) >= int(*base) {
+		return fmt.Errorf("total weight %d does not fit into a %d-bit option counter", *maxTotalWeight, *base)
+	}
+
+	cryptoParams := config.CryptoConfig{}
+	file, err := os.ReadFile(*cryptoPath)
+	if err == nil {
+		if err = json.Unmarshal(file, &cryptoParams); err != nil {
+			return fmt.Errorf("error parsing %s: %w", *cryptoPath, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if _, exists := cryptoParams[*votingID]; exists {
+		return fmt.Errorf("voting %s already has keys in %s, refusing to overwrite", *votingID, *cryptoPath)
+	}
+
+	fmt.Fprintf(os.Stderr, "Generating %d-bit RSA key...\n", *rsaBits)
+	rsaKeyPair, err := blind_signature.NewRSAKeyPair(*rsaBits / 2)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Generating %d-bit Paillier key...\n", *paillierBits)
+	paillierKeyPair, err := paillier.NewPaillierKeyPair(*paillierBits)
+	if err != nil {
+		return err
+	}
+
+	var votingParams config.VotingCryptoConfig
+	votingParams.VotingID = *votingID
+	votingParams.RSA.N = rsaKeyPair.PublicKey.N
+	votingParams.RSA.E = rsaKeyPair.PublicKey.E
+	votingParams.RSA.D = rsaKeyPair.PrivateKey.D
+	votingParams.Paillier.N = paillierKeyPair.N
+	votingParams.Paillier.Lambda = paillierKeyPair.Lambda
+	votingParams.ChallengeBits = *challengeBits
+	votingParams.Base = *base
+	votingParams.ReVotingMultiplier = *reVotingMultiplier
+	votingParams.ZKPVersion = *zkpVersion
+	if *damgardJurikS > 1 {
+		votingParams.DamgardJurikS = *damgardJurikS
+	}
+
+	// Множитель переголосования должен быть обратим по модулю RSA
+	if !bigint.GCD(bigint.NewBigIntFromUint(*reVotingMultiplier), rsaKeyPair.PublicKey.N).Eq(bigint.NewBigIntFromInt(1)) {
+		return errors.New("re-voting multiplier shares a factor with the RSA modulus")
+	}
+
+	for _, weight := range weights {
+		fmt.Fprintf(os.Stderr, "Generating %d-bit RSA key for weight %d...\n", *rsaBits, weight)
+		classKeyPair, err := blind_signature.NewRSAKeyPair(*rsaBits / 2)
+		if err != nil {
+			return err
+		}
+		if !bigint.GCD(bigint.NewBigIntFromUint(*reVotingMultiplier), classKeyPair.PublicKey.N).Eq(bigint.NewBigIntFromInt(1)) {
+			return fmt.Errorf("re-voting multiplier shares a factor with the RSA modulus for weight %d", weight)
+		}
+
+		class := config.WeightClass{Weight: weight}
+		class.RSA.N = classKeyPair.PublicKey.N
+		class.RSA.E = classKeyPair.PublicKey.E
+		class.RSA.D = classKeyPair.PrivateKey.D
+		votingParams.WeightClasses = append(votingParams.WeightClasses, class)
+	}
+
+	cryptoParams[*votingID] = votingParams
+
+	jsoned, err := json.MarshalIndent(cryptoParams, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(*cryptoPath, jsoned, 0600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Keys for voting %s saved to %s\n", *votingID, *cryptoPath)
+	return nil
+}
+
+// parseWeights разбирает список весов классов; вес 1 подписывается основным ключом и в списке не нужен
+func parseWeights(list string) ([]uint64, error) {
+	weights := []uint64{}
+	seen := map[uint64]bool{}
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		weight, err := strconv.ParseUint(field, 10, 64)
+		if err != nil || weight < 2 {
+			return nil, fmt.Errorf("weight %q must be an integer greater than 1", field)
+		}
+		if seen[weight] {
+			return nil, fmt.Errorf("weight %d is listed twice", weight)
+		}
+		seen[weight] = true
+		weights = append(weights, weight)
+	}
+	return weights, nil
+}
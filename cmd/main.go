@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"ev/internal/config"
 	"ev/internal/database"
 	"ev/internal/handlers"
@@ -15,6 +16,12 @@ import (
 )
 
 func main() {
+	// Служебные подкоманды (например, ev keygen) выполняются без запуска сервера
+	if len(os.Args) > 1 {
+		runSubcommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	// Инициализируем логгер
 	logger.InitLogger()
 	log := logger.GetLogger()
@@ -42,6 +49,12 @@ func main() {
 	_ = database.GetQueueRedisConnection()
 	defer database.CloseQueueRedisConnection()
 
+	// Ключи голосований из crypto.json должны вмещать счетчики вариантов
+	if err := handlers.CheckVotingCapacity(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("Voting keys are too small")
+		os.Exit(1)
+	}
+
 	go worker.RunBackgroundResultPublication(60 * time.Second)
 	log.Info().Msg("Background result publication started")
 
@@ -61,6 +74,7 @@ func main() {
 	mux.Handle("/user/profile", middleware.AuthMiddleware(http.HandlerFunc(handlers.ShowProfilePage)))
 	mux.Handle("/auth/user-info", middleware.AuthMiddleware(http.HandlerFunc(handlers.GetUserInfo)))
 	mux.Handle("/auth/temp-id", middleware.AuthMiddleware(http.HandlerFunc(handlers.GetTempID)))
+	mux.Handle("/auth/temp-id-credential", middleware.AuthMiddleware(http.HandlerFunc(handlers.IssueTempIDCredential)))
 
 	mux.Handle("/tally/calculate-results/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Получаем ID из URL
@@ -69,6 +83,43 @@ func main() {
 		handlers.CalculateVoting(w, r, votingID)
 	}))
 
+	mux.Handle("/tally/encrypted-sum/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Зашифрованная сумма для частичного расшифрования доверенными лицами
+		votingID := strings.TrimPrefix(r.URL.Path, "/tally/encrypted-sum/")
+		handlers.GetEncryptedSum(w, r, votingID)
+	}))
+
+	mux.Handle("/tally/partial-decryption/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Прием частичных расшифрований от доверенных лиц
+		votingID := strings.TrimPrefix(r.URL.Path, "/tally/partial-decryption/")
+		handlers.SubmitPartialDecryption(w, r, votingID)
+	}))
+
+	mux.Handle("/tally/record/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Выгрузка голосования для автономной проверки
+		votingID := strings.TrimPrefix(r.URL.Path, "/tally/record/")
+		handlers.GetElectionRecord(w, r, votingID)
+	}))
+
+	mux.Handle("/tally/export/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Подписанный архив выгрузки голосования для аудиторов
+		votingID := strings.TrimPrefix(r.URL.Path, "/tally/export/")
+		handlers.ExportElectionRecordBundle(w, r, votingID)
+	}))
+
+	mux.Handle("/api/v1/votings/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Публичный API журнала бюллетеней: /api/v1/votings/{id}/{resource}
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/api/v1/votings/"), "/", 2)
+		if len(parts) != 2 {
+			http.Error(w, "Неверный формат URL", http.StatusBadRequest)
+			return
+		}
+		handlers.VotingAPI(w, r, parts[0], parts[1])
+	}))
+
+	// Открытый ключ для проверки подписей опубликованных корней
+	mux.HandleFunc("/api/v1/tree-head-key", handlers.GetTreeHeadKey)
+
 	mux.Handle("/voting/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		path := strings.TrimPrefix(r.URL.Path, "/voting/")
 
@@ -130,7 +181,8 @@ func main() {
 
 	mux.Handle("/admin/votings/create", middleware.AuthMiddleware(http.HandlerFunc(handlers.AddNewVoting)))
 
-	mux.Handle("/ballot/register", middleware.AuthMiddleware(http.HandlerFunc(handlers.RegisterVote)))
+	// Регистратор проверяет подписанный IDP TempID и не требует сессии IDP
+	mux.HandleFunc("/ballot/register", handlers.RegisterVote)
 	mux.Handle("/ballot/submit", middleware.AuthMiddleware(http.HandlerFunc(handlers.SubmitVote)))
 
 	// Обработчики аутентификации (POST)
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"ev/internal/config"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/paillier"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Утилита доверенного лица для порогового расшифрования итогов голосования.
+//
+//	trustee deal -crypto crypto.json -voting 1 -trustees 3 -threshold 2 -out shares/
+//	trustee decrypt -share shares/trustee_1_1.json -server http://localhost:8080
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "deal":
+		err = runDeal(os.Args[2:])
+	case "decrypt":
+		err = runDecrypt(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: trustee deal|decrypt [flags]")
+}
+
+// runDeal заменяет ключ Paillier голосования на пороговый и раскладывает доли по файлам.
+// Файлы долей нужно передать доверенным лицам и удалить с машины, где запускалась команда
+func runDeal(args []string) error {
+	fs := flag.NewFlagSet("deal", flag.ExitOnError)
+	cryptoPath := fs.String("crypto", "crypto.json", "путь к crypto.json")
+	votingID := fs.String("voting", "", "идентификатор голосования")
+	bits := fs.Int("bits", 2048, "битность модуля Paillier")
+	trustees := fs.Int("trustees", 3, "количество доверенных лиц")
+	threshold := fs.Int("threshold", 2, "сколько доверенных лиц нужно для расшифрования")
+	outDir := fs.String("out", ".", "каталог для файлов долей")
+	fs.Parse(args)
+
+	if *votingID == "" {
+		return fmt.Errorf("voting ID is required")
+	}
+
+	file, err := os.ReadFile(*cryptoPath)
+	if err != nil {
+		return err
+	}
+
+	var cryptoParams config.CryptoConfig
+	if err = json.Unmarshal(file, &cryptoParams); err != nil {
+		return err
+	}
+
+	votingParams, exists := cryptoParams[*votingID]
+	if !exists {
+		return fmt.Errorf("voting %s not found in %s", *votingID, *cryptoPath)
+	}
+	if votingParams.S() > 1 {
+		return fmt.Errorf("voting %s uses damgard_jurik_s %d, threshold decryption supports only Paillier", *votingID, votingParams.DamgardJurikS)
+	}
+
+	fmt.Fprintf(os.Stderr, "Generating %d-bit threshold key (%d of %d), this may take a while...\n", *bits, *threshold, *trustees)
+
+	pub, shares, err := paillier.GenerateThresholdKeys(*bits, *trustees, *threshold)
+	if err != nil {
+		return err
+	}
+
+	// Голосующие шифруют тем же g = n + 1, меняется только модуль
+	votingParams.Paillier.N = pub.N
+	votingParams.Paillier.Lambda = nil
+	votingParams.Threshold = pub
+	cryptoParams[*votingID] = votingParams
+
+	if err = os.MkdirAll(*outDir, 0700); err != nil {
+		return err
+	}
+
+	for _, share := range shares {
+		share.VotingID = *votingID
+		jsoned, err := json.MarshalIndent(share, "", "    ")
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(*outDir, fmt.Sprintf("trustee_%s_%d.json", *votingID, share.Index))
+		if err = os.WriteFile(path, jsoned, 0600); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Share written to", path)
+	}
+
+	jsoned, err := json.MarshalIndent(cryptoParams, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(*cryptoPath, jsoned, 0600)
+}
+
+// runDecrypt получает у Счетчика зашифрованную сумму и отправляет частичное расшифрование.
+// Для ранжированного голосования отправляются частичные расшифрования всех перемешанных бюллетеней
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	sharePath := fs.String("share", "", "файл доли доверенного лица")
+	server := fs.String("server", "http://localhost:8080", "адрес Счетчика")
+	sum := fs.String("sum", "", "зашифрованная сумма (base64); если задана, результат печатается без отправки")
+	fs.Parse(args)
+
+	file, err := os.ReadFile(*sharePath)
+	if err != nil {
+		return err
+	}
+
+	var share paillier.ThresholdKeyShare
+	if err = json.Unmarshal(file, &share); err != nil {
+		return err
+	}
+
+	// У ранжированного голосования расшифровываются выходы перемешивания бюллетеней, а не сумма
+	var ciphertexts []string
+
+	offline := *sum != ""
+	if !offline {
+		resp, err := http.Get(strings.TrimRight(*server, "/") + "/tally/encrypted-sum/" + share.VotingID)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("counter responded %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+
+		var data struct {
+			CryptedResult string   `json:"crypted_result"`
+			Ciphertexts   []string `json:"ciphertexts"`
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+			return err
+		}
+		*sum = data.CryptedResult
+		ciphertexts = data.Ciphertexts
+	}
+
+	decrypt := func(ciphertext string) (*paillier.PartialDecryption, error) {
+		c, err := bigint.NewBigIntFromBase64(bigint.AddBase64Padding(ciphertext))
+		if err != nil {
+			return nil, err
+		}
+		return paillier.PartialDecrypt(share, c)
+	}
+
+	var jsoned []byte
+	if len(ciphertexts) > 0 {
+		partials := make([]*paillier.PartialDecryption, len(ciphertexts))
+		for i, ciphertext := range ciphertexts {
+			if partials[i], err = decrypt(ciphertext); err != nil {
+				return fmt.Errorf("shuffled ballot %d: %w", i, err)
+			}
+		}
+		jsoned, err = json.Marshal(partials)
+	} else {
+		var partial *paillier.PartialDecryption
+		if partial, err = decrypt(*sum); err != nil {
+			return err
+		}
+		jsoned, err = json.Marshal(partial)
+	}
+	if err != nil {
+		return err
+	}
+
+	if offline {
+		fmt.Println(string(jsoned))
+		return nil
+	}
+
+	resp, err := http.Post(strings.TrimRight(*server, "/")+"/tally/partial-decryption/"+share.VotingID, "application/json", bytes.NewReader(jsoned))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Println(strings.TrimSpace(string(body)))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("counter responded %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package ballotlog
+
+import (
+	"context"
+	"errors"
+	"ev/internal/crypto/merklie"
+	"ev/internal/models"
+	"ev/internal/utils"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Журнал бюллетеней только дополняется. Корни дерева Меркла строятся над префиксом журнала,
+// поэтому любые два опубликованных корня связаны доказательством согласованности,
+// а переголосования видны как записи с заполненным replaced_by
+
+// ErrReplacedBallotNotLogged — заменяемый бюллетень отсутствует в журнале
+var ErrReplacedBallotNotLogged = errors.New("replaced ballot is missing from the ballot log")
+
+// Querier — общий интерфейс pgxpool.Pool и pgx.Tx для чтения журнала
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Append добавляет бюллетень в конец журнала в рамках транзакции tx и возвращает его номер.
+// Если replacedLabel не пуст, запись с этой меткой отмечается как замененная новым бюллетенем
+func Append(ctx context.Context, tx pgx.Tx, entry models.BallotLogEntry, replacedLabel string) (int, error) {
+	// Блокировка строки голосования упорядочивает параллельные добавления в журнал
+	var votingID int
+	err := tx.QueryRow(ctx, "SELECT id FROM votings WHERE id = $1 FOR UPDATE", entry.VotingID).Scan(&votingID)
+	if err != nil {
+		return 0, err
+	}
+
+	var logIndex int
+	err = tx.QueryRow(ctx, "SELECT COALESCE(MAX(log_index) + 1, 0) FROM ballot_log WHERE voting_id = $1", entry.VotingID).Scan(&logIndex)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO ballot_log (voting_id, log_index, label, encrypted_vote, zkp_proof, signature, weight, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		entry.VotingID,
+		logIndex,
+		entry.Label,
+		entry.EncryptedVote,
+		entry.ZKPProof,
+		entry.Signature,
+		entry.Weight,
+		entry.CreatedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if replacedLabel != "" {
+		tag, err := tx.Exec(ctx,
+			"UPDATE ballot_log SET replaced_by = $1 WHERE voting_id = $2 AND label = $3 AND replaced_by IS NULL",
+			logIndex,
+			entry.VotingID,
+			replacedLabel,
+		)
+		if err != nil {
+			return 0, err
+		}
+		if tag.RowsAffected() != 1 {
+			return 0, ErrReplacedBallotNotLogged
+		}
+	}
+
+	return logIndex, nil
+}
+
+// Load возвращает первые size записей журнала голосования; при size < 0 — весь журнал
+func Load(ctx context.Context, q Querier, votingID string, size int) ([]models.BallotLogEntry, error) {
+	rows, err := q.Query(ctx,
+		"SELECT voting_id, log_index, label, encrypted_vote, zkp_proof, signature, weight, created_at, replaced_by FROM ballot_log WHERE voting_id = $1 AND ($2 < 0 OR log_index < $2) ORDER BY log_index",
+		votingID,
+		size,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.BallotLogEntry{}
+	for rows.Next() {
+		var entry models.BallotLogEntry
+		err = rows.Scan(&entry.VotingID, &entry.LogIndex, &entry.Label, &entry.EncryptedVote, &entry.ZKPProof, &entry.Signature, &entry.Weight, &entry.CreatedAt, &entry.ReplacedBy)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if size >= 0 && len(entries) != size {
+		return nil, errors.New("ballot log is shorter than the requested tree size")
+	}
+
+	return entries, nil
+}
+
+// PublishRoot публикует подписанный корень текущего журнала голосования вместе с корнями доски
+// и записей замен, копирует действующие бюллетени в public_encrypted_votes, а переголосования под корнем —
+// в public_revotes, и сохраняет состояние дерева. Возвращает идентификатор корня,
+// его значение и размер дерева
+func PublishRoot(ctx context.Context, tx pgx.Tx, votingID string, publishedAt time.Time) (int64, string, int, error) {
+	var rootHash string
+	var treeSize, treeVersion int
+	err := WithTree(ctx, tx, votingID, func(merkleTree *merklie.MerkleTree) error {
+		rootHash, treeSize, treeVersion = merkleTree.GetRoot(), merkleTree.Size(), merkleTree.Version()
+		return nil
+	})
+	if err != nil {
+		return 0, "", 0, err
+	}
+
+	board, revocations, err := LoadBoards(ctx, tx, votingID, treeSize)
+	if err != nil {
+		return 0, "", 0, err
+	}
+
+	boardRoot, boardSize, revocationRoot := board.Root(), board.Size(), revocations.Root()
+	head := merklie.TreeHead{
+		VotingID:       votingID,
+		TreeVersion:    treeVersion,
+		TreeSize:       treeSize,
+		RootValue:      rootHash,
+		BoardRoot:      &boardRoot,
+		BoardSize:      &boardSize,
+		RevocationRoot: &revocationRoot,
+		Timestamp:      publishedAt.UnixMilli(),
+	}
+	if err = utils.SignTreeHead(&head); err != nil {
+		return 0, "", 0, err
+	}
+
+	var rootID int64
+	err = tx.QueryRow(ctx,
+		"INSERT INTO merklie_roots (voting_id, root_value, created_at, tree_version, tree_size, signed_at, signature, board_root, board_size, revocation_root) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id",
+		votingID,
+		rootHash,
+		publishedAt,
+		treeVersion,
+		treeSize,
+		head.Timestamp,
+		head.Signature,
+		boardRoot,
+		boardSize,
+		revocationRoot,
+	).Scan(&rootID)
+	if err != nil {
+		return 0, "", 0, err
+	}
+
+	// Действующие бюллетени — записи под корнем, которые не заменены записями под тем же корнем
+	_, err = tx.Exec(ctx,
+		"INSERT INTO public_encrypted_votes (voting_id, label, corresponds_to_merklie_root, encrypted_vote, zkp_proof, signature, weight, created_at, moved_into_at) "+
+			"SELECT voting_id, label, $2, encrypted_vote, zkp_proof, signature, weight, created_at, $3 FROM ballot_log "+
+			"WHERE voting_id = $1 AND log_index < $4 AND (replaced_by IS NULL OR replaced_by >= $4) ORDER BY log_index",
+		votingID,
+		rootID,
+		publishedAt,
+		treeSize,
+	)
+	if err != nil {
+		return 0, "", 0, err
+	}
+
+	// Записи переголосований публикуются, когда заменивший бюллетень попадает под корень
+	_, err = tx.Exec(ctx,
+		"INSERT INTO public_revotes (voting_id, old_label, old_nonce, new_label, created_at, moved_into_at) "+
+			"SELECT r.voting_id, r.old_label, r.old_nonce, r.new_label, r.created_at, $2 FROM revotes r "+
+			"JOIN ballot_log b ON b.voting_id = r.voting_id AND b.label = r.new_label "+
+			"WHERE r.voting_id = $1 AND b.log_index < $3 ON CONFLICT (voting_id, old_label) DO NOTHING",
+		votingID,
+		publishedAt,
+		treeSize,
+	)
+	if err != nil {
+		return 0, "", 0, err
+	}
+
+	if err = SaveTree(ctx, tx, votingID); err != nil {
+		return 0, "", 0, err
+	}
+
+	return rootID, rootHash, treeSize, nil
+}
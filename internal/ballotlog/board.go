@@ -0,0 +1,46 @@
+package ballotlog
+
+import (
+	"context"
+	"ev/internal/crypto/merklie"
+	"ev/internal/models"
+)
+
+// Вместе с корнем журнала публикуются корни двух деревьев, упорядоченных по метке:
+// доски действующих бюллетеней (метка → зашифрованный голос) и записей замен
+// (старая метка → метка заменившего бюллетеня). По ним избиратель получает доказательство,
+// что его старый бюллетень отсутствует на доске, а заменивший его — присутствует
+
+// Boards строит доску и записи замен по префиксу журнала entries.
+// Запись считается замененной, если заменивший её бюллетень входит в тот же префикс
+func Boards(entries []models.BallotLogEntry) (*merklie.SortedTree, *merklie.SortedTree, error) {
+	size := len(entries)
+	active := []merklie.SortedLeaf{}
+	replaced := []merklie.SortedLeaf{}
+	for _, entry := range entries {
+		if entry.ReplacedBy != nil && *entry.ReplacedBy < size {
+			replaced = append(replaced, merklie.SortedLeaf{Key: entry.Label, Value: entries[*entry.ReplacedBy].Label})
+			continue
+		}
+		active = append(active, merklie.SortedLeaf{Key: entry.Label, Value: entry.EncryptedVote})
+	}
+
+	board, err := merklie.NewSortedTree(active)
+	if err != nil {
+		return nil, nil, err
+	}
+	revocations, err := merklie.NewSortedTree(replaced)
+	if err != nil {
+		return nil, nil, err
+	}
+	return board, revocations, nil
+}
+
+// LoadBoards строит доску и записи замен по первым size записям журнала голосования
+func LoadBoards(ctx context.Context, q Querier, votingID string, size int) (*merklie.SortedTree, *merklie.SortedTree, error) {
+	entries, err := Load(ctx, q, votingID, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	return Boards(entries)
+}
@@ -0,0 +1,154 @@
+package ballotlog
+
+import (
+	"context"
+	"errors"
+	"ev/internal/crypto/merklie"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Деревья журналов хранятся в памяти процесса и дополняются только новыми записями.
+// Уровни дерева сохраняются в merklie_tree_states, чтобы после перезапуска
+// не пересчитывать хеши всего журнала
+
+// Executor — общий интерфейс pgxpool.Pool и pgx.Tx для чтения и записи состояния дерева
+type Executor interface {
+	Querier
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+type cachedTree struct {
+	tree      *merklie.MerkleTree
+	savedSize int
+}
+
+var (
+	treesMu sync.Mutex
+	trees   = map[string]*cachedTree{}
+)
+
+// WithTree вызывает fn с деревом над всем журналом голосования.
+// Дерево нельзя сохранять после возврата из fn: оно дополняется другими запросами
+func WithTree(ctx context.Context, q Executor, votingID string, fn func(*merklie.MerkleTree) error) error {
+	treesMu.Lock()
+	defer treesMu.Unlock()
+
+	cached, err := loadTree(ctx, q, votingID)
+	if err != nil {
+		return err
+	}
+	return fn(cached.tree)
+}
+
+// SaveTree сохраняет уровни дерева голосования, если с прошлого сохранения журнал вырос
+func SaveTree(ctx context.Context, q Executor, votingID string) error {
+	treesMu.Lock()
+	defer treesMu.Unlock()
+
+	cached, err := loadTree(ctx, q, votingID)
+	if err != nil {
+		return err
+	}
+	if cached.tree.Size() == cached.savedSize {
+		return nil
+	}
+
+	state, err := cached.tree.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(ctx,
+		"INSERT INTO merklie_tree_states (voting_id, tree_version, tree_size, state, updated_at) VALUES ($1, $2, $3, $4, $5) "+
+			"ON CONFLICT (voting_id) DO UPDATE SET tree_version = EXCLUDED.tree_version, tree_size = EXCLUDED.tree_size, state = EXCLUDED.state, updated_at = EXCLUDED.updated_at",
+		votingID,
+		cached.tree.Version(),
+		cached.tree.Size(),
+		state,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	cached.savedSize = cached.tree.Size()
+	return nil
+}
+
+// ForgetTree удаляет дерево голосования из памяти (например, при удалении голосования)
+func ForgetTree(votingID string) {
+	treesMu.Lock()
+	defer treesMu.Unlock()
+
+	delete(trees, votingID)
+}
+
+// loadTree возвращает дерево из памяти или из merklie_tree_states и дополняет его
+// новыми записями журнала. Вызывается под treesMu
+func loadTree(ctx context.Context, q Executor, votingID string) (*cachedTree, error) {
+	cached, exists := trees[votingID]
+	if !exists {
+		cached = &cachedTree{}
+
+		var state []byte
+		err := q.QueryRow(ctx,
+			"SELECT tree_size, state FROM merklie_tree_states WHERE voting_id = $1 AND tree_version = $2",
+			votingID,
+			merklie.CurrentTreeVersion,
+		).Scan(&cached.savedSize, &state)
+		if err == nil {
+			cached.tree = &merklie.MerkleTree{}
+			if err = cached.tree.UnmarshalBinary(state); err != nil || cached.tree.Size() != cached.savedSize {
+				// Повреждённое состояние не используется — дерево строится по журналу заново
+				cached.tree, cached.savedSize = nil, 0
+			}
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+
+		if cached.tree == nil {
+			cached.tree, _ = merklie.NewMerkleTreeWithVersion(merklie.CurrentTreeVersion)
+		}
+	}
+
+	var logSize int
+	if err := q.QueryRow(ctx, "SELECT COUNT(*) FROM ballot_log WHERE voting_id = $1", votingID).Scan(&logSize); err != nil {
+		return nil, err
+	}
+	// Журнал не может укоротиться; если это произошло, дерево строится заново
+	if logSize < cached.tree.Size() {
+		cached.tree, _ = merklie.NewMerkleTreeWithVersion(merklie.CurrentTreeVersion)
+		cached.savedSize = -1
+	}
+
+	if logSize > cached.tree.Size() {
+		rows, err := q.Query(ctx,
+			"SELECT encrypted_vote FROM ballot_log WHERE voting_id = $1 AND log_index >= $2 ORDER BY log_index",
+			votingID,
+			cached.tree.Size(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var encryptedVote string
+			if err = rows.Scan(&encryptedVote); err != nil {
+				return nil, err
+			}
+			cached.tree.AddLeaf(encryptedVote)
+		}
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	trees[votingID] = cached
+	return cached, nil
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
 	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/paillier"
 	"ev/internal/logger"
 	"fmt"
 	"os"
@@ -58,6 +62,30 @@ type AppConfig struct {
 		Issuer               string `json:"jwtIssuer"`
 		TokenValidityMinutes int    `json:"jwtAuthTokenValidityMinutes"`
 	} `json:"jwt"`
+	// IDPCredential — ключ Ed25519, которым IDP подписывает TempID для Регистратора (base64).
+	// Регистратору достаточно открытого ключа
+	IDPCredential struct {
+		PrivateKey      string `json:"private_key"`
+		PublicKey       string `json:"public_key"`
+		ValidityMinutes int    `json:"validity_minutes"`
+	} `json:"idp_credential"`
+	// TempID — ключи HMAC для псевдонимов голосующих. Новые TempID выдаются ключом ActiveKey,
+	// остальные ключи остаются для поиска TempID, выданных до ротации
+	TempID struct {
+		Keys      map[string]string `json:"keys"`
+		ActiveKey string            `json:"active_key"`
+	} `json:"temp_id"`
+	// TreeHead — ключ Ed25519 Счетчика для подписи опубликованных корней журнала бюллетеней (base64).
+	// Открытый ключ публикуется на /api/v1/tree-head-key
+	TreeHead struct {
+		PrivateKey string `json:"private_key"`
+		PublicKey  string `json:"public_key"`
+	} `json:"tree_head"`
+	// Record — ключ Ed25519 Счетчика для подписи архивов выгрузки голосования (base64)
+	Record struct {
+		PrivateKey string `json:"private_key"`
+		PublicKey  string `json:"public_key"`
+	} `json:"record"`
 }
 
 // VotingCryptoConfig содержит криптографические параметры для одного голосования
@@ -72,9 +100,62 @@ type VotingCryptoConfig struct {
 		N      *bigint.BigInt `json:"n"`
 		Lambda *bigint.BigInt `json:"lambda"`
 	} `json:"paillier"`
-	ChallengeBits      uint   `json:"challenge_bits"`
-	Base               uint   `json:"base"`
-	ReVotingMultiplier uint64 `json:"re_voting_multiplier"`
+	// Threshold задан, если ключ Paillier разделён между доверенными лицами;
+	// в этом случае Paillier.Lambda не хранится на сервере
+	Threshold          *paillier.ThresholdPublicKey `json:"threshold,omitempty"`
+	ChallengeBits      uint                         `json:"challenge_bits"`
+	Base               uint                         `json:"base"`
+	ReVotingMultiplier uint64                       `json:"re_voting_multiplier"`
+	// ZKPVersion >= 2 означает, что принимаются только доказательства,
+	// привязанные к голосованию и метке бюллетеня
+	ZKPVersion uint `json:"zkp_version,omitempty"`
+	// WeightClasses — ключи подписи бюллетеней голосующих с весом больше 1
+	WeightClasses []WeightClass `json:"weight_classes,omitempty"`
+	// DamgardJurikS > 1 включает схему Дамгорда–Юрика с модулем n^(s+1): открытый текст вмещает
+	// s·log2(n) бит, и в один шифротекст помещается больше вариантов. 0 и 1 — обычный Paillier.
+	// Пороговое расшифрование поддерживает только Paillier
+	DamgardJurikS uint `json:"damgard_jurik_s,omitempty"`
+}
+
+// S возвращает показатель s схемы Дамгорда–Юрика; для Paillier s = 1
+func (c VotingCryptoConfig) S() uint {
+	return max(c.DamgardJurikS, 1)
+}
+
+// WeightClass — класс веса голосующих. Бюллетени класса Регистратор подписывает отдельным ключом RSA,
+// поэтому подпись удостоверяет вес бюллетеня. Общий ключ с множителем, как у переголосования, не подходит:
+// из-за мультипликативности RSA голосующий с весом 1 мог бы получить подпись с чужим множителем
+type WeightClass struct {
+	Weight uint64 `json:"weight"`
+	RSA    struct {
+		N *bigint.BigInt `json:"n"`
+		D *bigint.BigInt `json:"d"`
+		E *bigint.BigInt `json:"e"`
+	} `json:"rsa"`
+}
+
+// SigningKey возвращает ключ RSA (n, e, d) для бюллетеней с весом weight; вес 0 означает вес 1
+func (c VotingCryptoConfig) SigningKey(weight uint64) (n, e, d *bigint.BigInt, err error) {
+	if weight <= 1 {
+		return c.RSA.N, c.RSA.E, c.RSA.D, nil
+	}
+	for _, class := range c.WeightClasses {
+		if class.Weight == weight {
+			return class.RSA.N, class.RSA.E, class.RSA.D, nil
+		}
+	}
+	return nil, nil, nil, fmt.Errorf("no signing key for weight %d", weight)
+}
+
+// MaxWeight возвращает наибольший вес бюллетеня голосования
+func (c VotingCryptoConfig) MaxWeight() uint64 {
+	max := uint64(1)
+	for _, class := range c.WeightClasses {
+		if class.Weight > max {
+			max = class.Weight
+		}
+	}
+	return max
 }
 
 // CryptoConfig теперь хранит мапу конфигураций голосований
@@ -85,12 +166,33 @@ var (
 	CryptoParams CryptoConfig
 )
 
+// tempIDKeyPlaceholder — заглушка ключа TempID из примеров конфигурации; с ней TempID вычисляет любой
+const tempIDKeyPlaceholder = "change-me"
+
 // LoadConfigs загружает все конфигурационные файлы
 func LoadConfigs(configPath, cryptoPath string) error {
 	if err := loadJSONConfig(configPath, &Config); err != nil {
 		return fmt.Errorf("error loading main config: %w", err)
 	}
 
+	if Config.TempID.Keys[Config.TempID.ActiveKey] == "" {
+		return fmt.Errorf("temp_id.active_key %q has no key in temp_id.keys", Config.TempID.ActiveKey)
+	}
+	if err := checkEd25519Keys("idp_credential", "ev idp-keygen", Config.IDPCredential.PrivateKey, Config.IDPCredential.PublicKey); err != nil {
+		return err
+	}
+	if err := checkEd25519Keys("tree_head", "ev tree-head-keygen", Config.TreeHead.PrivateKey, Config.TreeHead.PublicKey); err != nil {
+		return err
+	}
+	if err := checkEd25519Keys("record", "ev record-keygen", Config.Record.PrivateKey, Config.Record.PublicKey); err != nil {
+		return err
+	}
+	for keyID, key := range Config.TempID.Keys {
+		if key == tempIDKeyPlaceholder {
+			return fmt.Errorf("temp_id.keys[%q] is the placeholder %q, set a secret random key", keyID, tempIDKeyPlaceholder)
+		}
+	}
+
 	log := logger.GetLogger()
 	log.Info().Msg("Successfully loaded main config")
 
@@ -98,11 +200,45 @@ func LoadConfigs(configPath, cryptoPath string) error {
 		return fmt.Errorf("error loading crypto configs: %w", err)
 	}
 
+	for votingID, params := range CryptoParams {
+		if params.Threshold == nil {
+			continue
+		}
+		if err := params.Threshold.Validate(); err != nil {
+			return fmt.Errorf("voting %s: %w", votingID, err)
+		}
+		if params.S() > 1 {
+			return fmt.Errorf("voting %s: threshold decryption does not support damgard_jurik_s %d", votingID, params.DamgardJurikS)
+		}
+	}
+
 	log.Info().Msg("Successfully loaded crypto configs")
 
 	return nil
 }
 
+// checkEd25519Keys проверяет пару ключей Ed25519 секции section: без неё сервер не запускается,
+// ключ генерируется командой keygen
+func checkEd25519Keys(section, keygen, privateKey, publicKey string) error {
+	if privateKey == "" || publicKey == "" {
+		return fmt.Errorf("%s keys are not set, generate them with %s", section, keygen)
+	}
+
+	private, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil || len(private) != ed25519.PrivateKeySize {
+		return fmt.Errorf("%s.private_key is not a base64 Ed25519 private key", section)
+	}
+	public, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		return fmt.Errorf("%s.public_key is not a base64 Ed25519 public key", section)
+	}
+	if !bytes.Equal(ed25519.PrivateKey(private).Public().(ed25519.PublicKey), public) {
+		return fmt.Errorf("%s.public_key does not match private_key", section)
+	}
+
+	return nil
+}
+
 // loadJSONConfig загружает JSON файл в указанную структуру
 func loadJSONConfig(path string, config interface{}) error {
 	absPath, err := filepath.Abs(path)
@@ -108,6 +108,19 @@ func (a *BigInt) Mod(b *BigInt) *BigInt {
 	return &BigInt{bn: new(big.Int).Mod(a.bn, b.bn)}
 }
 
+func (a *BigInt) Neg() *BigInt {
+	return &BigInt{bn: new(big.Int).Neg(a.bn)}
+}
+
+func (a *BigInt) Abs() *BigInt {
+	return &BigInt{bn: new(big.Int).Abs(a.bn)}
+}
+
+// Sign возвращает -1, 0 или +1 в зависимости от знака числа
+func (a *BigInt) Sign() int {
+	return a.bn.Sign()
+}
+
 // Сравнение
 func (a *BigInt) Cmp(b *BigInt) int {
 	return a.bn.Cmp(b.bn)
@@ -196,6 +209,11 @@ func (a *BigInt) Int64() int64 {
 	return a.bn.Int64()
 }
 
+// IsInt64 сообщает, представимо ли число в int64; иначе Int64 возвращает искажённое значение
+func (a *BigInt) IsInt64() bool {
+	return a.bn.IsInt64()
+}
+
 func (a *BigInt) ToBinaryString() string {
 	return a.bn.Text(2)
 }
@@ -0,0 +1,133 @@
+package merklie
+
+import (
+	"errors"
+	"fmt"
+)
+
+// largestPowerOfTwoBelow возвращает наибольшую степень двойки k < n (n > 1)
+func largestPowerOfTwoBelow(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// ConsistencyProof строит доказательство того, что дерево из первых oldSize листьев
+// является префиксом текущего дерева (RFC 6962, раздел 2.1.2)
+func (mt *MerkleTree) ConsistencyProof(oldSize int) ([]string, error) {
+	return mt.ConsistencyProofAt(oldSize, mt.Size())
+}
+
+// ConsistencyProofAt строит доказательство того, что дерево из первых oldSize листьев
+// является префиксом дерева из первых newSize листьев.
+// Поддерживается только TreeVersion2: в версии 1 дублирование нечётного узла
+// делает корень префикса невыводимым из корня всего дерева
+func (mt *MerkleTree) ConsistencyProofAt(oldSize, newSize int) ([]string, error) {
+	if mt.version != TreeVersion2 {
+		return nil, fmt.Errorf("consistency proofs are not supported for tree version %d", mt.version)
+	}
+	if newSize < 0 || newSize > mt.Size() {
+		return nil, fmt.Errorf("new tree size %d is out of range [0, %d]", newSize, mt.Size())
+	}
+	if oldSize < 0 || oldSize > newSize {
+		return nil, fmt.Errorf("old tree size %d is out of range [0, %d]", oldSize, newSize)
+	}
+	if oldSize == 0 || oldSize == newSize {
+		return []string{}, nil
+	}
+
+	return mt.consistencySubproof(oldSize, 0, newSize, true), nil
+}
+
+// consistencySubproof — SUBPROOF(m, D[start:end], b) из RFC 6962
+func (mt *MerkleTree) consistencySubproof(m, start, end int, complete bool) []string {
+	n := end - start
+	if m == n {
+		if complete {
+			return []string{}
+		}
+		return []string{mt.rangeHash(start, end)}
+	}
+
+	k := largestPowerOfTwoBelow(n)
+	if m <= k {
+		return append(mt.consistencySubproof(m, start, start+k, complete), mt.rangeHash(start+k, end))
+	}
+	return append(mt.consistencySubproof(m-k, start+k, end, false), mt.rangeHash(start, start+k))
+}
+
+// VerifyConsistency проверяет, что дерево oldSize с корнем oldRoot является префиксом
+// дерева newSize с корнем newRoot (RFC 9162, раздел 2.1.4.2)
+func VerifyConsistency(oldSize, newSize int, oldRoot, newRoot string, proof []string) error {
+	if oldSize < 0 || oldSize > newSize {
+		return fmt.Errorf("old tree size %d is larger than new tree size %d", oldSize, newSize)
+	}
+	if oldSize == newSize {
+		if len(proof) != 0 || oldRoot != newRoot {
+			return errors.New("trees of equal size must have equal roots and an empty proof")
+		}
+		return nil
+	}
+	// Пустое дерево является префиксом любого дерева
+	if oldSize == 0 {
+		if len(proof) != 0 {
+			return errors.New("proof from an empty tree must be empty")
+		}
+		return nil
+	}
+	if len(proof) == 0 {
+		return errors.New("consistency proof is empty")
+	}
+
+	// Если старое дерево полное, его корень является первым узлом доказательства
+	if oldSize&(oldSize-1) == 0 {
+		proof = append([]string{oldRoot}, proof...)
+	}
+
+	fn, sn := oldSize-1, newSize-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+	for _, node := range proof[1:] {
+		if sn == 0 {
+			return errors.New("consistency proof is too long")
+		}
+
+		var err error
+		if fn&1 == 1 || fn == sn {
+			if fr, err = HashNode(TreeVersion2, node, fr); err != nil {
+				return err
+			}
+			if sr, err = HashNode(TreeVersion2, node, sr); err != nil {
+				return err
+			}
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			if sr, err = HashNode(TreeVersion2, sr, node); err != nil {
+				return err
+			}
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return errors.New("consistency proof is too short")
+	}
+	if fr != oldRoot {
+		return errors.New("consistency proof does not match the old root")
+	}
+	if sr != newRoot {
+		return errors.New("consistency proof does not match the new root")
+	}
+
+	return nil
+}
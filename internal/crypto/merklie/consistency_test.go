@@ -0,0 +1,77 @@
+package merklie
+
+import "testing"
+
+func TestConsistencyProofs(t *testing.T) {
+	const size = 20
+	tree := testTree(t, testLeaves(size))
+
+	for newSize := 0; newSize <= size; newSize++ {
+		newRoot, err := tree.RootAt(newSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for oldSize := 0; oldSize <= newSize; oldSize++ {
+			oldRoot, err := tree.RootAt(oldSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proof, err := tree.ConsistencyProofAt(oldSize, newSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = VerifyConsistency(oldSize, newSize, oldRoot, newRoot, proof); err != nil {
+				t.Fatalf("%d -> %d: %v", oldSize, newSize, err)
+			}
+		}
+	}
+}
+
+func TestConsistencyProofRejectsForks(t *testing.T) {
+	tree := testTree(t, testLeaves(11))
+	oldRoot, _ := tree.RootAt(6)
+	newRoot := tree.GetRoot()
+	proof, err := tree.ConsistencyProof(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Дерево, в котором лист старого префикса подменён
+	forkLeaves := testLeaves(11)
+	forkLeaves[3] = "forged"
+	fork := testTree(t, forkLeaves)
+	forkProof, _ := fork.ConsistencyProof(6)
+	if err = VerifyConsistency(6, 11, oldRoot, fork.GetRoot(), forkProof); err == nil {
+		t.Error("forked tree accepted as an extension")
+	}
+
+	if err = VerifyConsistency(6, 11, newRoot, newRoot, proof); err == nil {
+		t.Error("proof accepted for a wrong old root")
+	}
+
+	forged := append([]string(nil), proof...)
+	forged[len(forged)-1] = tree.HashLeaf("other")
+	if err = VerifyConsistency(6, 11, oldRoot, newRoot, forged); err == nil {
+		t.Error("proof with a changed node accepted")
+	}
+	if err = VerifyConsistency(6, 11, oldRoot, newRoot, proof[:len(proof)-1]); err == nil {
+		t.Error("truncated proof accepted")
+	}
+	if err = VerifyConsistency(6, 11, oldRoot, newRoot, append(proof, proof[0])); err == nil {
+		t.Error("extended proof accepted")
+	}
+
+	if _, err = tree.ConsistencyProofAt(7, 6); err == nil {
+		t.Error("proof built from a larger tree to a smaller one")
+	}
+	if err = VerifyConsistency(7, 6, oldRoot, newRoot, proof); err == nil {
+		t.Error("shrinking tree accepted")
+	}
+
+	legacy := NewMerkleTree()
+	legacy.AddLeaf("a")
+	legacy.AddLeaf("b")
+	if _, err = legacy.ConsistencyProof(1); err == nil {
+		t.Error("consistency proof built for tree version 1")
+	}
+}
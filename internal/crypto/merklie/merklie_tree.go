@@ -2,24 +2,58 @@ package merklie
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"math/bits"
 )
 
-type Node struct {
-	HashHex string
-	Left    *Node
-	Right   *Node
-}
+// Версии дерева Меркла. Версия хранится вместе с корнем (merklie_roots.tree_version),
+// чтобы корни, опубликованные до перехода на новую версию, оставались проверяемыми
+const (
+	// TreeVersion1 — SHA-512 над конкатенацией hex-строк, нечётный узел дублируется
+	TreeVersion1 = 1
+	// TreeVersion2 — дерево в духе RFC 6962: SHA-256 над байтами с префиксами
+	// 0x00 для листьев и 0x01 для узлов, нечётный узел поднимается на уровень выше
+	TreeVersion2 = 2
+
+	// CurrentTreeVersion — версия, в которой строятся новые корни
+	CurrentTreeVersion = TreeVersion2
+)
+
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
 
+// MerkleTree хранит все уровни дерева: levels[0] — хеши листьев, последний уровень — корень.
+// Добавление листа пересчитывает только правый край дерева, поэтому стоит O(log n),
+// а доказательства включения собираются из закешированных уровней
 type MerkleTree struct {
-	leaves []*Node
-	root   *Node
+	version int
+	levels  [][]string
+	// index — номер первого листа с данным хешем
+	index map[string]int
 }
 
+// NewMerkleTree создаёт дерево версии TreeVersion1
 func NewMerkleTree() *MerkleTree {
-	return &MerkleTree{}
+	return &MerkleTree{version: TreeVersion1, index: map[string]int{}}
+}
+
+// NewMerkleTreeWithVersion создаёт дерево указанной версии
+func NewMerkleTreeWithVersion(version int) (*MerkleTree, error) {
+	if version != TreeVersion1 && version != TreeVersion2 {
+		return nil, fmt.Errorf("unsupported merkle tree version %d", version)
+	}
+	return &MerkleTree{version: version, index: map[string]int{}}, nil
+}
+
+// Version возвращает версию дерева
+func (mt *MerkleTree) Version() int {
+	return mt.version
 }
 
 func Hash(data string) string {
@@ -27,65 +61,123 @@ func Hash(data string) string {
 	return hex.EncodeToString(digest[:])
 }
 
-func (mt *MerkleTree) AddLeaf(data string) {
-	leaf := &Node{HashHex: Hash(data)}
-	mt.leaves = append(mt.leaves, leaf)
-	mt.root = mt.buildTree(mt.leaves)
+// HashLeaf хеширует значение листа в дереве версии version
+func HashLeaf(version int, data string) string {
+	if version != TreeVersion2 {
+		return Hash(data)
+	}
+	digest := sha256.Sum256(append([]byte{leafPrefix}, data...))
+	return hex.EncodeToString(digest[:])
 }
 
-func (mt *MerkleTree) RemoveLeaf(leafHash string) {
-	index := -1
-	for i, node := range mt.leaves {
-		if node.HashHex == leafHash {
-			index = i
-			break
-		}
+// HashNode хеширует пару дочерних узлов в дереве версии version
+func HashNode(version int, left, right string) (string, error) {
+	if version != TreeVersion2 {
+		return Hash(left + right), nil
+	}
+
+	leftBytes, err := hex.DecodeString(left)
+	if err != nil {
+		return "", fmt.Errorf("invalid left hash: %w", err)
+	}
+	rightBytes, err := hex.DecodeString(right)
+	if err != nil {
+		return "", fmt.Errorf("invalid right hash: %w", err)
 	}
-	if index != -1 {
-		mt.leaves = append(mt.leaves[:index], mt.leaves[index+1:]...)
-		mt.root = mt.buildTree(mt.leaves)
+	if len(leftBytes) != sha256.Size || len(rightBytes) != sha256.Size {
+		return "", errors.New("node hash has wrong length")
 	}
+
+	data := make([]byte, 0, 1+2*sha256.Size)
+	data = append(data, nodePrefix)
+	data = append(data, leftBytes...)
+	data = append(data, rightBytes...)
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:]), nil
 }
 
-func (mt *MerkleTree) GetRoot() string {
-	if mt.root != nil {
-		return mt.root.HashHex
-	}
-	return ""
+// HashLeaf хеширует значение листа так же, как это делает AddLeaf
+func (mt *MerkleTree) HashLeaf(data string) string {
+	return HashLeaf(mt.version, data)
 }
 
-func (mt *MerkleTree) buildTree(nodes []*Node) *Node {
-	if len(nodes) == 0 {
-		return nil
+func (mt *MerkleTree) AddLeaf(data string) {
+	mt.appendLeafHash(mt.HashLeaf(data))
+}
+
+// appendLeafHash добавляет лист и пересчитывает правый край каждого уровня
+func (mt *MerkleTree) appendLeafHash(leafHash string) {
+	if len(mt.levels) == 0 {
+		mt.levels = [][]string{{}}
 	}
-	if len(nodes) == 1 {
-		return nodes[0]
+	if _, exists := mt.index[leafHash]; !exists {
+		mt.index[leafHash] = len(mt.levels[0])
 	}
+	mt.levels[0] = append(mt.levels[0], leafHash)
+
+	for level := 0; len(mt.levels[level]) > 1; level++ {
+		nodes := mt.levels[level]
+		last := len(nodes) - 1
 
-	var nextLevel []*Node
-	for i := 0; i < len(nodes); i += 2 {
-		left := nodes[i]
-		if i+1 < len(nodes) {
-			right := nodes[i+1]
-			combined := left.HashHex + right.HashHex
-			parent := &Node{
-				HashHex: Hash(combined),
-				Left:    left,
-				Right:   right,
-			}
-			nextLevel = append(nextLevel, parent)
+		// Хеши узлов получены из HashLeaf/HashNode, поэтому ошибка здесь невозможна
+		var parent string
+		if last%2 == 1 {
+			parent, _ = HashNode(mt.version, nodes[last-1], nodes[last])
+		} else if mt.version == TreeVersion2 {
+			// Нечётный узел поднимается без изменений (RFC 6962)
+			parent = nodes[last]
 		} else {
 			// Повторяем последний узел
-			combined := left.HashHex + left.HashHex
-			parent := &Node{
-				HashHex: Hash(combined),
-				Left:    left,
-				Right:   nil,
-			}
-			nextLevel = append(nextLevel, parent)
+			parent, _ = HashNode(mt.version, nodes[last], nodes[last])
+		}
+
+		if level+1 == len(mt.levels) {
+			mt.levels = append(mt.levels, []string{})
+		}
+		if last/2 < len(mt.levels[level+1]) {
+			mt.levels[level+1][last/2] = parent
+		} else {
+			mt.levels[level+1] = append(mt.levels[level+1], parent)
 		}
 	}
-	return mt.buildTree(nextLevel)
+}
+
+// RemoveLeaf удаляет первый лист с хешем leafHash. Дерево перестраивается целиком
+func (mt *MerkleTree) RemoveLeaf(leafHash string) {
+	index, exists := mt.index[leafHash]
+	if !exists {
+		return
+	}
+
+	leaves := append([]string{}, mt.levels[0][:index]...)
+	leaves = append(leaves, mt.levels[0][index+1:]...)
+
+	mt.levels = nil
+	mt.index = map[string]int{}
+	for _, leaf := range leaves {
+		mt.appendLeafHash(leaf)
+	}
+}
+
+func (mt *MerkleTree) GetRoot() string {
+	if len(mt.levels) == 0 || len(mt.levels[0]) == 0 {
+		return ""
+	}
+	return mt.levels[len(mt.levels)-1][0]
+}
+
+// Size возвращает количество листьев дерева
+func (mt *MerkleTree) Size() int {
+	if len(mt.levels) == 0 {
+		return 0
+	}
+	return len(mt.levels[0])
+}
+
+// LeafIndex возвращает номер первого листа с хешем leafHash
+func (mt *MerkleTree) LeafIndex(leafHash string) (int, bool) {
+	index, exists := mt.index[leafHash]
+	return index, exists
 }
 
 type MerklieTreePublicNode struct {
@@ -94,51 +186,95 @@ type MerklieTreePublicNode struct {
 }
 
 func (mt *MerkleTree) GetProof(leafHash string) ([]MerklieTreePublicNode, bool) {
-	var proof []MerklieTreePublicNode
+	index, exists := mt.index[leafHash]
+	if !exists {
+		return []MerklieTreePublicNode{}, false
+	}
 
-	var findPath func(*Node, *Node) ([]*Node, bool)
-	findPath = func(current, target *Node) ([]*Node, bool) {
-		if current == nil {
-			return nil, false
-		}
-		if current == target {
-			return []*Node{current}, true
-		}
-		if path, ok := findPath(current.Left, target); ok {
-			return append(path, current), true
-		}
-		if path, ok := findPath(current.Right, target); ok {
-			return append(path, current), true
+	proof, err := mt.ProofAt(index, mt.Size())
+	return proof, err == nil
+}
+
+// ProofAt возвращает доказательство включения листа index в дерево из первых size листьев.
+// Для версии 1 поддерживается только текущий размер дерева
+func (mt *MerkleTree) ProofAt(index, size int) ([]MerklieTreePublicNode, error) {
+	if size < 1 || size > mt.Size() {
+		return nil, fmt.Errorf("tree size %d is out of range [1, %d]", size, mt.Size())
+	}
+	if index < 0 || index >= size {
+		return nil, fmt.Errorf("leaf index %d is out of range [0, %d)", index, size)
+	}
+
+	if size < mt.Size() {
+		if mt.version != TreeVersion2 {
+			return nil, fmt.Errorf("proofs for earlier tree sizes are not supported for tree version %d", mt.version)
 		}
-		return nil, false
+		return mt.auditPath(index, 0, size), nil
 	}
 
-	var leaf *Node
-	for _, node := range mt.leaves {
-		if node.HashHex == leafHash {
-			leaf = node
-			break
+	proof := []MerklieTreePublicNode{}
+	for level := 0; level < len(mt.levels)-1; level++ {
+		nodes := mt.levels[level]
+		sibling := index ^ 1
+		if sibling < len(nodes) {
+			proof = append(proof, MerklieTreePublicNode{Hash: nodes[sibling], IsRight: sibling > index})
+		} else if mt.version != TreeVersion2 {
+			// В версии 1 нечётный узел хешируется сам с собой
+			proof = append(proof, MerklieTreePublicNode{Hash: nodes[index], IsRight: true})
 		}
+		index >>= 1
 	}
-	if leaf == nil {
-		return proof, false
+	return proof, nil
+}
+
+// auditPath — PATH(m, D[start:end]) из RFC 6962 для дерева версии 2
+func (mt *MerkleTree) auditPath(index, start, end int) []MerklieTreePublicNode {
+	if end-start <= 1 {
+		return []MerklieTreePublicNode{}
 	}
 
-	path, _ := findPath(mt.root, leaf)
+	k := largestPowerOfTwoBelow(end - start)
+	if index < start+k {
+		return append(mt.auditPath(index, start, start+k), MerklieTreePublicNode{Hash: mt.rangeHash(start+k, end), IsRight: true})
+	}
+	return append(mt.auditPath(index, start+k, end), MerklieTreePublicNode{Hash: mt.rangeHash(start, start+k), IsRight: false})
+}
 
-	for i := 0; i < len(path)-1; i++ {
-		parent := path[i+1]
-		current := path[i]
-		if parent.Left == current && parent.Right != nil {
-			proof = append(proof, MerklieTreePublicNode{Hash: parent.Right.HashHex, IsRight: true})
-		} else if parent.Right == current && parent.Left != nil {
-			proof = append(proof, MerklieTreePublicNode{Hash: parent.Left.HashHex, IsRight: false})
-		}
+// rangeHash вычисляет MTH(D[start:end]) для дерева версии 2. Полные выровненные поддеревья
+// берутся из закешированных уровней, поэтому вычисление стоит O(log n)
+func (mt *MerkleTree) rangeHash(start, end int) string {
+	n := end - start
+	if n&(n-1) == 0 && start%n == 0 {
+		level := bits.TrailingZeros(uint(n))
+		return mt.levels[level][start>>level]
 	}
-	return proof, true
+
+	k := largestPowerOfTwoBelow(n)
+	// Хеши узлов получены из HashLeaf/HashNode, поэтому ошибка здесь невозможна
+	hash, _ := HashNode(TreeVersion2, mt.rangeHash(start, start+k), mt.rangeHash(start+k, end))
+	return hash
 }
 
-func CalculateRootFromProof(proof []MerklieTreePublicNode, trueHash string) (string, error) {
+// RootAt возвращает корень дерева из первых size листьев.
+// Для версии 1 поддерживается только текущий размер дерева
+func (mt *MerkleTree) RootAt(size int) (string, error) {
+	if size < 0 || size > mt.Size() {
+		return "", fmt.Errorf("tree size %d is out of range [0, %d]", size, mt.Size())
+	}
+	if size == mt.Size() {
+		return mt.GetRoot(), nil
+	}
+	if mt.version != TreeVersion2 {
+		return "", fmt.Errorf("roots for earlier tree sizes are not supported for tree version %d", mt.version)
+	}
+	if size == 0 {
+		return "", nil
+	}
+	return mt.rangeHash(0, size), nil
+}
+
+// CalculateRootFromProof вычисляет корень дерева версии version по доказательству включения листа trueHash
+func CalculateRootFromProof(version int, proof []MerklieTreePublicNode, trueHash string) (string, error) {
 	if len(proof) == 0 {
 		return "", nil
 	}
@@ -146,14 +282,16 @@ func CalculateRootFromProof(proof []MerklieTreePublicNode, trueHash string) (str
 	currentHash := trueHash
 
 	for _, node := range proof {
+		var err error
 		if node.IsRight {
 			// Если узел в доказательстве является правым, то текущий хэш - левый
-			combined := currentHash + node.Hash
-			currentHash = Hash(combined)
+			currentHash, err = HashNode(version, currentHash, node.Hash)
 		} else {
 			// Если узел в доказательстве является левым, то текущий хэш - правый
-			combined := node.Hash + currentHash
-			currentHash = Hash(combined)
+			currentHash, err = HashNode(version, node.Hash, currentHash)
+		}
+		if err != nil {
+			return "", err
 		}
 	}
 
@@ -162,21 +300,25 @@ func CalculateRootFromProof(proof []MerklieTreePublicNode, trueHash string) (str
 
 func (mt *MerkleTree) Serialize() string {
 	var buffer bytes.Buffer
-	var serializeNode func(*Node)
+	var serializeNode func(level, index int)
 
-	serializeNode = func(node *Node) {
-		if node == nil {
+	serializeNode = func(level, index int) {
+		if level < 0 || index >= len(mt.levels[level]) {
 			buffer.WriteString("null")
 			return
 		}
-		buffer.WriteString(fmt.Sprintf("{ \"hash\": \"%s\", ", node.HashHex))
+		buffer.WriteString(fmt.Sprintf("{ \"hash\": \"%s\", ", mt.levels[level][index]))
 		buffer.WriteString("\"left\": ")
-		serializeNode(node.Left)
+		serializeNode(level-1, 2*index)
 		buffer.WriteString(", \"right\": ")
-		serializeNode(node.Right)
+		serializeNode(level-1, 2*index+1)
 		buffer.WriteString(" }")
 	}
 
-	serializeNode(mt.root)
+	if mt.Size() == 0 {
+		buffer.WriteString("null")
+	} else {
+		serializeNode(len(mt.levels)-1, 0)
+	}
 	return buffer.String()
 }
@@ -0,0 +1,133 @@
+package merklie
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// referenceRoot — MTH(D[n]) из RFC 6962, раздел 2.1, без кешей дерева
+func referenceRoot(leaves []string) []byte {
+	if len(leaves) == 1 {
+		digest := sha256.Sum256(append([]byte{leafPrefix}, leaves[0]...))
+		return digest[:]
+	}
+	k := largestPowerOfTwoBelow(len(leaves))
+	data := append([]byte{nodePrefix}, referenceRoot(leaves[:k])...)
+	digest := sha256.Sum256(append(data, referenceRoot(leaves[k:])...))
+	return digest[:]
+}
+
+func testLeaves(count int) []string {
+	leaves := make([]string, count)
+	for i := range leaves {
+		leaves[i] = fmt.Sprintf("leaf-%d", i)
+	}
+	return leaves
+}
+
+func testTree(t *testing.T, leaves []string) *MerkleTree {
+	t.Helper()
+	tree, err := NewMerkleTreeWithVersion(TreeVersion2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaf := range leaves {
+		tree.AddLeaf(leaf)
+	}
+	return tree
+}
+
+func TestHashLeafMatchesRFC6962(t *testing.T) {
+	// Хеш пустого листа из тестовых векторов certificate-transparency
+	if got := HashLeaf(TreeVersion2, ""); got != "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d" {
+		t.Fatalf("empty leaf hash %s", got)
+	}
+}
+
+func TestTreeVersion2MatchesRFC6962(t *testing.T) {
+	for size := 1; size <= 17; size++ {
+		leaves := testLeaves(size)
+		tree := testTree(t, leaves)
+
+		root := tree.GetRoot()
+		if expected := hex.EncodeToString(referenceRoot(leaves)); root != expected {
+			t.Fatalf("size %d: root %s, expected %s", size, root, expected)
+		}
+
+		for index, leaf := range leaves {
+			proof, ok := tree.GetProof(tree.HashLeaf(leaf))
+			if !ok {
+				t.Fatalf("size %d: no proof for leaf %d", size, index)
+			}
+			if err := VerifyInclusion(index, size, tree.HashLeaf(leaf), proof, root); err != nil {
+				t.Fatalf("size %d, leaf %d: %v", size, index, err)
+			}
+		}
+	}
+}
+
+func TestTreeVersion2RejectsForgedProofs(t *testing.T) {
+	leaves := testLeaves(6)
+	tree := testTree(t, leaves)
+	root := tree.GetRoot()
+	leafHash := tree.HashLeaf(leaves[2])
+	proof, _ := tree.GetProof(leafHash)
+
+	if err := VerifyInclusion(3, 6, leafHash, proof, root); err == nil {
+		t.Error("proof accepted for another leaf index")
+	}
+
+	forged := append([]MerklieTreePublicNode(nil), proof...)
+	forged[0].Hash = tree.HashLeaf("other")
+	if err := VerifyInclusion(2, 6, leafHash, forged, root); err == nil {
+		t.Error("proof with a changed sibling accepted")
+	}
+
+	if err := VerifyInclusion(2, 6, leafHash, proof[:len(proof)-1], root); err == nil {
+		t.Error("truncated proof accepted")
+	}
+
+	// Внутренний узел не выдаётся за лист: префиксы листьев и узлов различаются
+	node, err := HashNode(TreeVersion2, tree.HashLeaf(leaves[0]), tree.HashLeaf(leaves[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node == HashLeaf(TreeVersion2, tree.HashLeaf(leaves[0])+tree.HashLeaf(leaves[1])) {
+		t.Error("node hash equals a leaf hash")
+	}
+
+	if _, err = HashNode(TreeVersion2, "zz", tree.HashLeaf(leaves[1])); err == nil {
+		t.Error("malformed node hash accepted")
+	}
+	if _, err = NewMerkleTreeWithVersion(3); err == nil {
+		t.Error("unknown tree version accepted")
+	}
+}
+
+func TestTreeVersion1StaysCompatible(t *testing.T) {
+	leaves := testLeaves(3)
+	tree := NewMerkleTree()
+	for _, leaf := range leaves {
+		tree.AddLeaf(leaf)
+	}
+
+	// Версия 1: SHA-512 над конкатенацией hex-строк, нечётный узел дублируется
+	h := make([]string, len(leaves))
+	for i, leaf := range leaves {
+		h[i] = Hash(leaf)
+	}
+	expected := Hash(Hash(h[0]+h[1]) + Hash(h[2]+h[2]))
+	if tree.GetRoot() != expected {
+		t.Fatalf("version 1 root %s, expected %s", tree.GetRoot(), expected)
+	}
+
+	proof, _ := tree.GetProof(h[2])
+	if root, err := CalculateRootFromProof(TreeVersion1, proof, h[2]); err != nil || root != expected {
+		t.Fatalf("version 1 proof gives %s, %v", root, err)
+	}
+	if testTree(t, leaves).GetRoot() == expected {
+		t.Error("version 2 root equals version 1 root")
+	}
+}
@@ -0,0 +1,217 @@
+package merklie
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Дерево, упорядоченное по ключу, позволяет доказать не только наличие, но и отсутствие ключа:
+// достаточно показать два соседних листа, между которыми ключ должен был бы находиться.
+// Используется версия дерева 2, так как её доказательства однозначно задают номер листа
+
+var (
+	// ErrKeyNotFound — ключа нет в дереве
+	ErrKeyNotFound = errors.New("key is not present in the sorted tree")
+	// ErrKeyPresent — ключ есть в дереве, доказательство отсутствия невозможно
+	ErrKeyPresent = errors.New("key is present in the sorted tree")
+)
+
+// SortedLeaf — лист дерева, упорядоченного по ключу
+type SortedLeaf struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Data возвращает хешируемое значение листа. Ключи и значения — base64, перевод строки в них не встречается
+func (l SortedLeaf) Data() string {
+	return l.Key + "\n" + l.Value
+}
+
+// SortedTree — дерево Меркла версии 2 над листьями, отсортированными по ключу
+type SortedTree struct {
+	tree   *MerkleTree
+	leaves []SortedLeaf
+}
+
+// SortedProof — доказательство включения листа с номером Index
+type SortedProof struct {
+	Index int                     `json:"index"`
+	Leaf  SortedLeaf              `json:"leaf"`
+	Path  []MerklieTreePublicNode `json:"path"`
+}
+
+// NonInclusionProof — доказательство отсутствия ключа: соседние листы Left и Right
+// с ключами меньше и больше искомого. Left отсутствует, если ключ меньше всех ключей дерева,
+// Right — если больше всех
+type NonInclusionProof struct {
+	Key      string       `json:"key"`
+	TreeSize int          `json:"tree_size"`
+	Left     *SortedProof `json:"left"`
+	Right    *SortedProof `json:"right"`
+}
+
+// NewSortedTree сортирует листья по ключу и строит над ними дерево. Ключи должны быть уникальны
+func NewSortedTree(leaves []SortedLeaf) (*SortedTree, error) {
+	sorted := make([]SortedLeaf, len(leaves))
+	copy(sorted, leaves)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+
+	tree, _ := NewMerkleTreeWithVersion(TreeVersion2)
+	for i, leaf := range sorted {
+		if i > 0 && sorted[i-1].Key == leaf.Key {
+			return nil, fmt.Errorf("duplicate key %s in sorted tree", leaf.Key)
+		}
+		tree.AddLeaf(leaf.Data())
+	}
+
+	return &SortedTree{tree: tree, leaves: sorted}, nil
+}
+
+// Root возвращает корень дерева; у пустого дерева корень — пустая строка
+func (st *SortedTree) Root() string {
+	return st.tree.GetRoot()
+}
+
+// Size возвращает количество листьев
+func (st *SortedTree) Size() int {
+	return len(st.leaves)
+}
+
+// search возвращает номер первого листа с ключом не меньше key
+func (st *SortedTree) search(key string) int {
+	return sort.Search(len(st.leaves), func(i int) bool { return st.leaves[i].Key >= key })
+}
+
+func (st *SortedTree) proofAt(index int) (*SortedProof, error) {
+	path, err := st.tree.ProofAt(index, st.Size())
+	if err != nil {
+		return nil, err
+	}
+	return &SortedProof{Index: index, Leaf: st.leaves[index], Path: path}, nil
+}
+
+// InclusionProof доказывает наличие ключа в дереве
+func (st *SortedTree) InclusionProof(key string) (*SortedProof, error) {
+	index := st.search(key)
+	if index == len(st.leaves) || st.leaves[index].Key != key {
+		return nil, ErrKeyNotFound
+	}
+	return st.proofAt(index)
+}
+
+// NonInclusionProof доказывает отсутствие ключа в дереве
+func (st *SortedTree) NonInclusionProof(key string) (*NonInclusionProof, error) {
+	index := st.search(key)
+	if index < len(st.leaves) && st.leaves[index].Key == key {
+		return nil, ErrKeyPresent
+	}
+
+	proof := &NonInclusionProof{Key: key, TreeSize: st.Size()}
+	var err error
+	if index > 0 {
+		if proof.Left, err = st.proofAt(index - 1); err != nil {
+			return nil, err
+		}
+	}
+	if index < len(st.leaves) {
+		if proof.Right, err = st.proofAt(index); err != nil {
+			return nil, err
+		}
+	}
+	return proof, nil
+}
+
+// VerifyInclusion проверяет доказательство включения листа index в дерево версии 2 из size листьев
+// (RFC 9162, раздел 2.1.3.2). Направления узлов обязаны соответствовать номеру листа
+func VerifyInclusion(index, size int, leafHash string, proof []MerklieTreePublicNode, root string) error {
+	if index < 0 || index >= size {
+		return fmt.Errorf("leaf index %d is out of range [0, %d)", index, size)
+	}
+
+	fn, sn := index, size-1
+	hash := leafHash
+	for _, node := range proof {
+		if sn == 0 {
+			return errors.New("inclusion proof is too long")
+		}
+
+		var err error
+		if fn&1 == 1 || fn == sn {
+			if node.IsRight {
+				return errors.New("inclusion proof does not match the leaf index")
+			}
+			if hash, err = HashNode(TreeVersion2, node.Hash, hash); err != nil {
+				return err
+			}
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			if !node.IsRight {
+				return errors.New("inclusion proof does not match the leaf index")
+			}
+			if hash, err = HashNode(TreeVersion2, hash, node.Hash); err != nil {
+				return err
+			}
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return errors.New("inclusion proof is too short")
+	}
+	if hash != root {
+		return errors.New("inclusion proof does not match the root")
+	}
+	return nil
+}
+
+// VerifySortedInclusion проверяет доказательство включения листа в упорядоченное дерево
+func VerifySortedInclusion(root string, size int, proof *SortedProof) error {
+	return VerifyInclusion(proof.Index, size, HashLeaf(TreeVersion2, proof.Leaf.Data()), proof.Path, root)
+}
+
+// VerifyNonInclusion проверяет доказательство отсутствия ключа в упорядоченном дереве из size листьев.
+// Размер берётся из опубликованных данных, а не из доказательства: от него зависит, какой лист считается последним
+func VerifyNonInclusion(root string, size int, proof *NonInclusionProof) error {
+	if proof.TreeSize != size {
+		return fmt.Errorf("non-inclusion proof is for tree size %d, expected %d", proof.TreeSize, size)
+	}
+	if proof.Left == nil && proof.Right == nil {
+		if proof.TreeSize != 0 || root != "" {
+			return errors.New("non-inclusion proof has no neighbours in a non-empty tree")
+		}
+		return nil
+	}
+
+	if proof.Left != nil {
+		if err := VerifySortedInclusion(root, proof.TreeSize, proof.Left); err != nil {
+			return fmt.Errorf("left neighbour: %w", err)
+		}
+		if proof.Left.Leaf.Key >= proof.Key {
+			return errors.New("left neighbour key is not below the key")
+		}
+	}
+	if proof.Right != nil {
+		if err := VerifySortedInclusion(root, proof.TreeSize, proof.Right); err != nil {
+			return fmt.Errorf("right neighbour: %w", err)
+		}
+		if proof.Right.Leaf.Key <= proof.Key {
+			return errors.New("right neighbour key is not above the key")
+		}
+	}
+
+	// Соседи должны быть смежными листьями, а крайние — первым или последним листом
+	switch {
+	case proof.Left == nil && proof.Right.Index != 0:
+		return errors.New("right neighbour is not the first leaf")
+	case proof.Right == nil && proof.Left.Index != proof.TreeSize-1:
+		return errors.New("left neighbour is not the last leaf")
+	case proof.Left != nil && proof.Right != nil && proof.Right.Index != proof.Left.Index+1:
+		return errors.New("neighbours are not adjacent")
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package merklie
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func testSortedTree(t *testing.T, keys ...string) *SortedTree {
+	t.Helper()
+	leaves := make([]SortedLeaf, len(keys))
+	for i, key := range keys {
+		leaves[i] = SortedLeaf{Key: key, Value: "value-" + key}
+	}
+	tree, err := NewSortedTree(leaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestSortedTreeProofs(t *testing.T) {
+	tree := testSortedTree(t, "m", "c", "x", "f")
+	root := tree.Root()
+
+	for _, key := range []string{"c", "f", "m", "x"} {
+		proof, err := tree.InclusionProof(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = VerifySortedInclusion(root, tree.Size(), proof); err != nil {
+			t.Fatalf("key %s: %v", key, err)
+		}
+	}
+
+	// Ключ меньше всех, между соседями и больше всех
+	for _, key := range []string{"a", "d", "n", "z"} {
+		proof, err := tree.NonInclusionProof(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = VerifyNonInclusion(root, tree.Size(), proof); err != nil {
+			t.Fatalf("key %s: %v", key, err)
+		}
+	}
+
+	empty := testSortedTree(t)
+	proof, err := empty.NonInclusionProof("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyNonInclusion(empty.Root(), 0, proof); err != nil {
+		t.Fatalf("empty tree: %v", err)
+	}
+}
+
+func TestSortedTreeRejectsForgedNonInclusion(t *testing.T) {
+	tree := testSortedTree(t, "b", "d", "f", "h")
+	root := tree.Root()
+
+	if _, err := tree.NonInclusionProof("d"); !errors.Is(err, ErrKeyPresent) {
+		t.Fatalf("non-inclusion proof for a present key: %v", err)
+	}
+	if _, err := tree.InclusionProof("e"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("inclusion proof for an absent key: %v", err)
+	}
+	if _, err := NewSortedTree([]SortedLeaf{{Key: "a"}, {Key: "a"}}); err == nil {
+		t.Fatal("duplicate keys accepted")
+	}
+
+	// Соседи "b" и "f" не смежны: между ними скрыт лист "d"
+	left, _ := tree.InclusionProof("b")
+	right, _ := tree.InclusionProof("f")
+	forged := &NonInclusionProof{Key: "d", TreeSize: tree.Size(), Left: left, Right: right}
+	if err := VerifyNonInclusion(root, tree.Size(), forged); err == nil {
+		t.Error("non-adjacent neighbours accepted")
+	}
+
+	// Последний лист скрыт уменьшением размера дерева
+	proof, _ := tree.NonInclusionProof("g")
+	proof.TreeSize = 3
+	if err := VerifyNonInclusion(root, tree.Size(), proof); err == nil {
+		t.Error("proof for another tree size accepted")
+	}
+
+	// Без правого соседа отсутствие доказывается только за последним листом
+	proof, _ = tree.NonInclusionProof("c")
+	proof.Right = nil
+	if err := VerifyNonInclusion(root, tree.Size(), proof); err == nil {
+		t.Error("missing right neighbour accepted")
+	}
+
+	proof, _ = tree.NonInclusionProof("e")
+	proof.Key = "c"
+	if err := VerifyNonInclusion(root, tree.Size(), proof); err == nil {
+		t.Error("neighbours accepted for a key outside their range")
+	}
+
+	proof, _ = tree.NonInclusionProof("e")
+	proof.Left.Leaf.Value = "changed"
+	if err := VerifyNonInclusion(root, tree.Size(), proof); err == nil {
+		t.Error("neighbour with a changed value accepted")
+	}
+}
+
+func TestTreeHeadSignsBoardRoots(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boardRoot, boardSize, revocationRoot := "board", 4, "revocations"
+	head := &TreeHead{
+		VotingID:       "1",
+		TreeVersion:    TreeVersion2,
+		TreeSize:       5,
+		RootValue:      "root",
+		BoardRoot:      &boardRoot,
+		BoardSize:      &boardSize,
+		RevocationRoot: &revocationRoot,
+		Timestamp:      1700000000000,
+	}
+	head.Sign(private)
+	if err = head.Verify(public); err != nil {
+		t.Fatalf("valid tree head rejected: %v", err)
+	}
+
+	// Корень без полей доски подписывается по v1 и тоже проверяется
+	legacy := *head
+	legacy.BoardRoot, legacy.BoardSize, legacy.RevocationRoot = nil, nil, nil
+	legacy.Sign(private)
+	if err = legacy.Verify(public); err != nil {
+		t.Fatalf("valid v1 tree head rejected: %v", err)
+	}
+
+	stripped := *head
+	stripped.BoardRoot, stripped.BoardSize, stripped.RevocationRoot = nil, nil, nil
+	if err = stripped.Verify(public); err == nil {
+		t.Error("v2 signature accepted without board roots")
+	}
+
+	changed := *head
+	otherBoard := "other"
+	changed.BoardRoot = &otherBoard
+	if err = changed.Verify(public); err == nil {
+		t.Error("tree head with a changed board root accepted")
+	}
+
+	otherPublic, _, _ := ed25519.GenerateKey(nil)
+	if err = head.Verify(otherPublic); err == nil {
+		t.Error("tree head accepted under another key")
+	}
+}
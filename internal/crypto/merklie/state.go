@@ -0,0 +1,104 @@
+package merklie
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Формат состояния дерева: байт версии, затем для каждого уровня — количество узлов (uint64)
+// и сами хеши в двоичном виде. Уровни сохраняются целиком, чтобы после загрузки
+// не пересчитывать хеши всех листьев
+
+// hashSize возвращает длину хеша узла в байтах для версии дерева
+func hashSize(version int) int {
+	if version == TreeVersion2 {
+		return sha256.Size
+	}
+	return sha512.Size
+}
+
+// MarshalBinary сохраняет все уровни дерева
+func (mt *MerkleTree) MarshalBinary() ([]byte, error) {
+	size := hashSize(mt.version)
+
+	total := 1
+	for _, nodes := range mt.levels {
+		total += 8 + len(nodes)*size
+	}
+
+	data := make([]byte, 0, total)
+	data = append(data, byte(mt.version))
+	for _, nodes := range mt.levels {
+		data = binary.BigEndian.AppendUint64(data, uint64(len(nodes)))
+		for _, node := range nodes {
+			decoded, err := hex.DecodeString(node)
+			if err != nil || len(decoded) != size {
+				return nil, errors.New("tree contains a malformed node hash")
+			}
+			data = append(data, decoded...)
+		}
+	}
+
+	return data, nil
+}
+
+// UnmarshalBinary восстанавливает дерево, сохранённое MarshalBinary
+func (mt *MerkleTree) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return errors.New("tree state is empty")
+	}
+
+	version := int(data[0])
+	if version != TreeVersion1 && version != TreeVersion2 {
+		return fmt.Errorf("unsupported merkle tree version %d", version)
+	}
+	size := hashSize(version)
+	data = data[1:]
+
+	levels := [][]string{}
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return errors.New("tree state is truncated")
+		}
+		count := binary.BigEndian.Uint64(data)
+		data = data[8:]
+		if count > uint64(len(data)/size) {
+			return errors.New("tree state is truncated")
+		}
+
+		nodes := make([]string, count)
+		for i := range nodes {
+			nodes[i] = hex.EncodeToString(data[:size])
+			data = data[size:]
+		}
+		levels = append(levels, nodes)
+	}
+
+	// Каждый уровень должен быть ровно вдвое (с округлением вверх) короче предыдущего,
+	// а уровень из одного узла — последним: иначе корнем стал бы лишний узел
+	for i := 1; i < len(levels); i++ {
+		if len(levels[i]) != (len(levels[i-1])+1)/2 || len(levels[i-1]) <= 1 {
+			return errors.New("tree state has inconsistent levels")
+		}
+	}
+	if len(levels) > 0 && len(levels[len(levels)-1]) > 1 {
+		return errors.New("tree state has no root level")
+	}
+
+	mt.version = version
+	mt.levels = levels
+	mt.index = map[string]int{}
+	if len(levels) > 0 {
+		for i, leaf := range levels[0] {
+			if _, exists := mt.index[leaf]; !exists {
+				mt.index[leaf] = i
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package merklie
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestIncrementalTreeKeepsEarlierRootsAndProofs(t *testing.T) {
+	leaves := testLeaves(13)
+	tree := testTree(t, nil)
+
+	roots := []string{""}
+	for size, leaf := range leaves {
+		tree.AddLeaf(leaf)
+		root := tree.GetRoot()
+		if expected := hex.EncodeToString(referenceRoot(leaves[:size+1])); root != expected {
+			t.Fatalf("size %d: incremental root %s, expected %s", size+1, root, expected)
+		}
+		roots = append(roots, root)
+	}
+
+	// Корни и доказательства включения для ранее опубликованных размеров
+	for size := 1; size <= len(leaves); size++ {
+		root, err := tree.RootAt(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root != roots[size] {
+			t.Fatalf("root at %d is %s, published %s", size, root, roots[size])
+		}
+		for index := 0; index < size; index++ {
+			proof, err := tree.ProofAt(index, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = VerifyInclusion(index, size, tree.HashLeaf(leaves[index]), proof, root); err != nil {
+				t.Fatalf("leaf %d of %d: %v", index, size, err)
+			}
+		}
+	}
+
+	if _, err := tree.ProofAt(3, 3); err == nil {
+		t.Error("proof built for a leaf outside the tree")
+	}
+	if _, err := tree.RootAt(len(leaves) + 1); err == nil {
+		t.Error("root built for a size larger than the tree")
+	}
+}
+
+func TestTreeStateRoundTrip(t *testing.T) {
+	for _, version := range []int{TreeVersion1, TreeVersion2} {
+		tree, _ := NewMerkleTreeWithVersion(version)
+		for _, leaf := range testLeaves(9) {
+			tree.AddLeaf(leaf)
+		}
+
+		state, err := tree.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var restored MerkleTree
+		if err = restored.UnmarshalBinary(state); err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		if restored.Version() != version || restored.GetRoot() != tree.GetRoot() || restored.Size() != tree.Size() {
+			t.Fatalf("version %d: restored tree differs", version)
+		}
+
+		// Восстановленное дерево продолжает расти так же, как исходное
+		tree.AddLeaf("next")
+		restored.AddLeaf("next")
+		if restored.GetRoot() != tree.GetRoot() {
+			t.Fatalf("version %d: restored tree grows differently", version)
+		}
+		if index, ok := restored.LeafIndex(restored.HashLeaf("leaf-4")); !ok || index != 4 {
+			t.Fatalf("version %d: leaf index %d, %v", version, index, ok)
+		}
+	}
+}
+
+func TestTreeStateRejectsMalformedData(t *testing.T) {
+	tree := testTree(t, testLeaves(5))
+	state, err := tree.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var restored MerkleTree
+	if err = restored.UnmarshalBinary(nil); err == nil {
+		t.Error("empty state accepted")
+	}
+	if err = restored.UnmarshalBinary(state[:len(state)-1]); err == nil {
+		t.Error("truncated state accepted")
+	}
+
+	unknown := append([]byte(nil), state...)
+	unknown[0] = 9
+	if err = restored.UnmarshalBinary(unknown); err == nil {
+		t.Error("state of an unknown version accepted")
+	}
+
+	// Лишний уровень из одного узла не согласован с корнем
+	inconsistent := append(append([]byte(nil), state...), 0, 0, 0, 0, 0, 0, 0, 1)
+	inconsistent = append(inconsistent, make([]byte, hashSize(TreeVersion2))...)
+	if err = restored.UnmarshalBinary(inconsistent); err == nil {
+		t.Error("state with inconsistent levels accepted")
+	}
+}
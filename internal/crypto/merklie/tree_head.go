@@ -0,0 +1,61 @@
+package merklie
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// treeHeadContext отделяет подпись корня от других подписей тем же ключом.
+// v2 подписывает также корни доски и записей замен; v1 остаётся для корней,
+// опубликованных до их введения
+const (
+	treeHeadContext   = "ev-tree-head-v2"
+	treeHeadContextV1 = "ev-tree-head-v1"
+)
+
+// TreeHead — корень дерева журнала бюллетеней, подписанный Счетчиком.
+// Timestamp — время подписи в миллисекундах Unix. Поля доски пусты у корней,
+// опубликованных до введения доски
+type TreeHead struct {
+	VotingID       string  `json:"voting_id"`
+	TreeVersion    int     `json:"tree_version"`
+	TreeSize       int     `json:"tree_size"`
+	RootValue      string  `json:"root_value"`
+	BoardRoot      *string `json:"board_root,omitempty"`
+	BoardSize      *int    `json:"board_size,omitempty"`
+	RevocationRoot *string `json:"revocation_root,omitempty"`
+	Timestamp      int64   `json:"timestamp"`
+	Signature      string  `json:"signature"`
+}
+
+// Message возвращает подписываемые байты; формат повторяется в static/js/tree_head.js.
+// Удалить поля доски из подписанного по v2 корня нельзя: сообщение v1 отличается контекстом
+func (th *TreeHead) Message() []byte {
+	if th.BoardRoot == nil || th.BoardSize == nil || th.RevocationRoot == nil {
+		return []byte(fmt.Sprintf("%s\n%s\n%d\n%d\n%s\n%d", treeHeadContextV1, th.VotingID, th.TreeVersion, th.TreeSize, th.RootValue, th.Timestamp))
+	}
+	return []byte(fmt.Sprintf("%s\n%s\n%d\n%d\n%s\n%d\n%s\n%d\n%s", treeHeadContext, th.VotingID, th.TreeVersion, th.TreeSize, th.RootValue, th.Timestamp,
+		*th.BoardRoot, *th.BoardSize, *th.RevocationRoot))
+}
+
+// Sign подписывает корень ключом Счетчика
+func (th *TreeHead) Sign(privateKey ed25519.PrivateKey) {
+	th.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, th.Message()))
+}
+
+// Verify проверяет подпись корня открытым ключом Счетчика
+func (th *TreeHead) Verify(publicKey ed25519.PublicKey) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("tree head public key is invalid")
+	}
+	signature, err := base64.StdEncoding.DecodeString(th.Signature)
+	if err != nil {
+		return fmt.Errorf("tree head signature is malformed: %w", err)
+	}
+	if !ed25519.Verify(publicKey, th.Message(), signature) {
+		return errors.New("tree head signature is invalid")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package paillier
+
+import (
+	"errors"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/zkp"
+)
+
+// Схема Дамгорда–Юрика — обобщение Paillier на модуль n^(s+1). Открытый текст берётся из Z_(n^s),
+// то есть вмещает s·log2(n) бит вместо log2(n), а шифротекст — c = (1+n)^m · r^(n^s) mod n^(s+1).
+// Ключи те же, что у Paillier: n = pq и λ = lcm(p-1, q-1), поэтому s выбирается для голосования
+// без генерации новых ключей. При s = 1 все функции совпадают с функциями Paillier для g = n + 1.
+// Модули n^s и n^(s+1) вычисляет zkp.Moduli
+
+// powOnePlusN возвращает (1+n)^m mod n^(s+1); при s = 1 это 1 + m·n mod n²
+func powOnePlusN(m, n *bigint.BigInt, s uint) *bigint.BigInt {
+	_, modulus := zkp.Moduli(n, s)
+	if s <= 1 {
+		return bigint.NewBigIntFromInt(1).Add(m.Mul(n)).Mod(modulus)
+	}
+	return n.Add(bigint.NewBigIntFromInt(1)).ModExp(m, modulus)
+}
+
+// EncryptDJ: c = (1+n)^m · r^(n^s) mod n^(s+1)
+func EncryptDJ(m, r, n *bigint.BigInt, s uint) *bigint.BigInt {
+	ns, modulus := zkp.Moduli(n, s)
+	return powOnePlusN(m, n, s).Mul(r.ModExp(ns, modulus)).Mod(modulus)
+}
+
+// DecryptDJ: c^λ mod n^(s+1) = (1+n)^(m·λ mod n^s), откуда m·λ извлекается по одной степени n
+// (алгоритм из статьи Дамгорда и Юрика) и умножается на λ^-1 mod n^s
+func DecryptDJ(c, lambda, n *bigint.BigInt, s uint) (*bigint.BigInt, error) {
+	ns, modulus := zkp.Moduli(n, s)
+
+	mLambda, err := logOnePlusN(c.ModExp(lambda, modulus), n, s)
+	if err != nil {
+		return nil, err
+	}
+	lambdaInv, err := lambda.ModInverse(ns)
+	if err != nil {
+		return nil, errors.New("lambda is not invertible modulo n^s")
+	}
+	return mLambda.Mul(lambdaInv).Mod(ns), nil
+}
+
+// logOnePlusN находит i по a = (1+n)^i mod n^(s+1). На шаге j известно i mod n^(j-1), и
+// L(a mod n^(j+1)) = Σ_{k=1..j} C(i, k)·n^(k-1) mod n^j позволяет найти i mod n^j
+func logOnePlusN(a, n *bigint.BigInt, s uint) (*bigint.BigInt, error) {
+	if s < 1 {
+		s = 1
+	}
+	one := bigint.NewBigIntFromInt(1)
+	i := bigint.NewBigInt()
+	nj := bigint.NewBigIntFromInt(1)
+	for j := 1; j <= int(s); j++ {
+		nj = nj.Mul(n)
+		t1 := L(a.Mod(nj.Mul(n)), n)
+		t2 := i
+		nk := bigint.NewBigIntFromInt(1)
+		for k := 2; k <= j; k++ {
+			i = i.Sub(one)
+			t2 = t2.Mul(i).Mod(nj)
+			nk = nk.Mul(n)
+			kInv, err := factorial(k).ModInverse(nj)
+			if err != nil {
+				return nil, errors.New("k! is not invertible modulo n^j")
+			}
+			t1 = t1.Sub(t2.Mul(nk).Mul(kInv)).Mod(nj)
+		}
+		i = t1
+	}
+	return i, nil
+}
+
+// CountSumDJ перемножает шифротексты по модулю n^(s+1): произведение шифрует сумму открытых текстов
+func CountSumDJ(values []*bigint.BigInt, n *bigint.BigInt, s uint) *bigint.BigInt {
+	_, modulus := zkp.Moduli(n, s)
+	sum := bigint.NewBigIntFromInt(1)
+	for _, v := range values {
+		sum = sum.Mul(v).Mod(modulus)
+	}
+	return sum
+}
+
+// CountWeightedSumDJ — CountWeightedSum по модулю n^(s+1)
+func CountWeightedSumDJ(values []*bigint.BigInt, weights []uint64, n *bigint.BigInt, s uint) *bigint.BigInt {
+	_, modulus := zkp.Moduli(n, s)
+	sum := bigint.NewBigIntFromInt(1)
+	for i, v := range values {
+		if weights[i] != 1 {
+			v = v.ModExp(bigint.NewBigIntFromUint(weights[i]), modulus)
+		}
+		sum = sum.Mul(v).Mod(modulus)
+	}
+	return sum
+}
@@ -0,0 +1,105 @@
+package paillier
+
+import (
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/zkp"
+	"testing"
+)
+
+func TestDamgardJurikRoundTrip(t *testing.T) {
+	key := testKey(t)
+
+	for s := uint(1); s <= 3; s++ {
+		ns, _ := zkp.Moduli(key.N, s)
+
+		// При s > 1 открытый текст длиннее n, при любом s — на единицу меньше n^s
+		messages := []*bigint.BigInt{bigint.NewBigIntFromInt(0), bigint.NewBigIntFromInt(42), ns.Sub(bigint.NewBigIntFromInt(1))}
+		if s > 1 {
+			messages = append(messages, key.N.Mul(bigint.NewBigIntFromInt(3)).Add(bigint.NewBigIntFromInt(7)))
+		}
+
+		for _, message := range messages {
+			c, _ := zkp.Encrypt(key.N, s, message)
+			m, err := DecryptDJ(c, key.Lambda, key.N, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !m.Eq(message) {
+				t.Fatalf("s = %d: decrypted %s, expected %s", s, m.ToString(), message.ToString())
+			}
+		}
+	}
+
+	// При s = 1 схема совпадает с Paillier
+	c, _ := zkp.Encrypt(key.N, 1, bigint.NewBigIntFromInt(99))
+	m, err := Decrypt(c, key.G, key.Lambda, key.N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Int64() != 99 {
+		t.Fatalf("Paillier decrypted %s, expected 99", m.ToString())
+	}
+}
+
+func TestCountWeightedSumDJ(t *testing.T) {
+	key := testKey(t)
+	const s = 2
+
+	// Сумма превышает n и не поместилась бы в открытый текст Paillier
+	large := key.N.Add(bigint.NewBigIntFromInt(5))
+	values := []*bigint.BigInt{large, bigint.NewBigIntFromInt(10), bigint.NewBigIntFromInt(1)}
+	weights := []uint64{3, 1, 4}
+
+	ciphertexts := make([]*bigint.BigInt, len(values))
+	expected := bigint.NewBigIntFromInt(0)
+	for i, value := range values {
+		ciphertexts[i], _ = zkp.Encrypt(key.N, s, value)
+		expected = expected.Add(value.Mul(bigint.NewBigIntFromUint(weights[i])))
+	}
+
+	m, err := DecryptDJ(CountWeightedSumDJ(ciphertexts, weights, key.N, s), key.Lambda, key.N, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Eq(expected) {
+		t.Fatalf("weighted sum %s, expected %s", m.ToString(), expected.ToString())
+	}
+
+	m, err = DecryptDJ(CountSumDJ(ciphertexts, key.N, s), key.Lambda, key.N, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected = large.Add(bigint.NewBigIntFromInt(11)); !m.Eq(expected) {
+		t.Fatalf("sum %s, expected %s", m.ToString(), expected.ToString())
+	}
+}
+
+func TestDecryptionProofDJ(t *testing.T) {
+	key := testKey(t)
+	const s = 2
+	message := key.N.Mul(bigint.NewBigIntFromInt(2)).Add(bigint.NewBigIntFromInt(17))
+	c, _ := zkp.Encrypt(key.N, s, message)
+
+	m, err := DecryptDJ(c, key.Lambda, key.N, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := ProveDecryptionDJ(c, m, key.Lambda, key.N, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyDecryptionDJ(c, m, key.N, s, proof); err != nil {
+		t.Fatalf("valid decryption rejected: %v", err)
+	}
+
+	if err = VerifyDecryptionDJ(c, m.Add(bigint.NewBigIntFromInt(1)), key.N, s, proof); err == nil {
+		t.Error("proof accepted for a wrong result")
+	}
+	if err = VerifyDecryptionDJ(c, m.Mod(key.N), key.N, 1, proof); err == nil {
+		t.Error("proof accepted for another s")
+	}
+	other, _ := zkp.Encrypt(key.N, s, message)
+	if err = VerifyDecryptionDJ(other, m, key.N, s, proof); err == nil {
+		t.Error("proof accepted for another ciphertext")
+	}
+}
@@ -0,0 +1,121 @@
+package paillier
+
+import (
+	"errors"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/zkp"
+)
+
+// DecryptionChallengeBits — размер челленджа доказательства корректного расшифрования
+const DecryptionChallengeBits = 256
+
+// DecryptionProof — доказательство того, что c·g^(-m) является n-й степенью по модулю n^2,
+// то есть c шифрует именно m. Раскрывает только a = t^n и z = t·r^e, но не r.
+// Для схемы Дамгорда–Юрика степень n заменяется на n^s, а модуль n^2 — на n^(s+1)
+type DecryptionProof struct {
+	A *bigint.BigInt `json:"a"`
+	Z *bigint.BigInt `json:"z"`
+}
+
+// decryptionChallenge вычисляет челлендж Фиата–Шамира для доказательства расшифрования.
+// Для s > 1 в челлендж входит и s, для s = 1 он совпадает с челленджем Paillier
+func decryptionChallenge(n *bigint.BigInt, s uint, c, m, a *bigint.BigInt) *bigint.BigInt {
+	twoToB := bigint.NewBigIntFromInt(1).Lsh(DecryptionChallengeBits)
+	values := []*bigint.BigInt{n, c, m, a}
+	if s > 1 {
+		values = []*bigint.BigInt{n, bigint.NewBigIntFromUint(uint64(s)), c, m, a}
+	}
+	return zkp.ComputeDigest(values).Mod(twoToB)
+}
+
+// stripPlaintext возвращает u = c·(1+n)^(-m) mod n^(s+1)
+func stripPlaintext(c, m, n *bigint.BigInt, s uint) (*bigint.BigInt, error) {
+	_, modulus := zkp.Moduli(n, s)
+	gmInv, err := powOnePlusN(m, n, s).ModInverse(modulus)
+	if err != nil {
+		return nil, err
+	}
+	return c.Mul(gmInv).Mod(modulus), nil
+}
+
+// ProveDecryption строит доказательство того, что c расшифровывается в m.
+// Случайность r шифротекста восстанавливается по lambda и в доказательство не попадает
+func ProveDecryption(c, m, lambda, n *bigint.BigInt) (*DecryptionProof, error) {
+	return ProveDecryptionDJ(c, m, lambda, n, 1)
+}
+
+// ProveDecryptionDJ строит доказательство расшифрования шифротекста схемы Дамгорда–Юрика:
+// c·(1+n)^(-m) является n^s-й степенью по модулю n^(s+1)
+func ProveDecryptionDJ(c, m, lambda, n *bigint.BigInt, s uint) (*DecryptionProof, error) {
+	ns, modulus := zkp.Moduli(n, s)
+
+	// c mod n = r^(n^s) mod n, поэтому r = (c mod n)^((n^s)^-1 mod lambda) mod n
+	nsInv, err := ns.ModInverse(lambda)
+	if err != nil {
+		return nil, errors.New("n is not invertible modulo lambda")
+	}
+	r := c.Mod(n).ModExp(nsInv, n)
+
+	u, err := stripPlaintext(c, m, n, s)
+	if err != nil {
+		return nil, err
+	}
+	if !r.ModExp(ns, modulus).Eq(u) {
+		return nil, errors.New("ciphertext does not decrypt to the given message")
+	}
+
+	t, err := randomUnit(n)
+	if err != nil {
+		return nil, err
+	}
+
+	a := t.ModExp(ns, modulus)
+	e := decryptionChallenge(n, s, c, m, a)
+	z := t.Mul(r.ModExp(e, n)).Mod(n)
+
+	return &DecryptionProof{A: a, Z: z}, nil
+}
+
+// VerifyDecryption проверяет, что c шифрует m под открытым ключом n: z^n ≡ a·(c·g^(-m))^e mod n^2
+func VerifyDecryption(c, m, n *bigint.BigInt, proof *DecryptionProof) error {
+	return VerifyDecryptionDJ(c, m, n, 1, proof)
+}
+
+// VerifyDecryptionDJ проверяет доказательство расшифрования схемы Дамгорда–Юрика:
+// z^(n^s) ≡ a·(c·(1+n)^(-m))^e mod n^(s+1)
+func VerifyDecryptionDJ(c, m, n *bigint.BigInt, s uint, proof *DecryptionProof) error {
+	if proof == nil || proof.A == nil || proof.Z == nil {
+		return errors.New("decryption proof is incomplete")
+	}
+
+	ns, modulus := zkp.Moduli(n, s)
+	zero := bigint.NewBigInt()
+	one := bigint.NewBigIntFromInt(1)
+
+	if m.Lt(zero) || m.Ge(ns) {
+		return errors.New("message is out of range")
+	}
+	if c.Le(zero) || c.Ge(modulus) || !bigint.GCD(c, n).Eq(one) {
+		return errors.New("ciphertext is out of range")
+	}
+	if proof.A.Le(zero) || proof.A.Ge(modulus) || !bigint.GCD(proof.A, n).Eq(one) {
+		return errors.New("proof commitment is out of range")
+	}
+	if proof.Z.Le(zero) || proof.Z.Ge(n) {
+		return errors.New("proof response is out of range")
+	}
+
+	u, err := stripPlaintext(c, m, n, s)
+	if err != nil {
+		return err
+	}
+
+	e := decryptionChallenge(n, s, c, m, proof.A)
+	left := proof.Z.ModExp(ns, modulus)
+	right := proof.A.Mul(u.ModExp(e, modulus)).Mod(modulus)
+	if !left.Eq(right) {
+		return errors.New("decryption proof check failed")
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package paillier
+
+import (
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/zkp"
+	"sync"
+	"testing"
+)
+
+var (
+	testKeyOnce sync.Once
+	testKeyPair *PaillierKeyPair
+	testKeyErr  error
+)
+
+// testKey возвращает общий для тестов пакета ключ на 512 бит
+func testKey(t *testing.T) *PaillierKeyPair {
+	t.Helper()
+	testKeyOnce.Do(func() {
+		testKeyPair, testKeyErr = NewPaillierKeyPair(512)
+	})
+	if testKeyErr != nil {
+		t.Fatal(testKeyErr)
+	}
+	return testKeyPair
+}
+
+func TestDecryptionProofRoundTrip(t *testing.T) {
+	key := testKey(t)
+	c, _ := zkp.Encrypt(key.N, 1, bigint.NewBigIntFromInt(1234))
+
+	m, err := Decrypt(c, key.G, key.Lambda, key.N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Int64() != 1234 {
+		t.Fatalf("decrypted %s, expected 1234", m.ToString())
+	}
+
+	proof, err := ProveDecryption(c, m, key.Lambda, key.N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyDecryption(c, m, key.N, proof); err != nil {
+		t.Fatalf("valid decryption proof rejected: %v", err)
+	}
+}
+
+func TestDecryptionProofRejectsWrongResult(t *testing.T) {
+	key := testKey(t)
+	c, _ := zkp.Encrypt(key.N, 1, bigint.NewBigIntFromInt(10))
+	m := bigint.NewBigIntFromInt(10)
+	wrong := bigint.NewBigIntFromInt(11)
+
+	if _, err := ProveDecryption(c, wrong, key.Lambda, key.N); err == nil {
+		t.Error("proof built for a wrong result")
+	}
+
+	proof, err := ProveDecryption(c, m, key.Lambda, key.N)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyDecryption(c, wrong, key.N, proof); err == nil {
+		t.Error("proof accepted for a wrong result")
+	}
+
+	other, _ := zkp.Encrypt(key.N, 1, m)
+	if err = VerifyDecryption(other, m, key.N, proof); err == nil {
+		t.Error("proof accepted for another ciphertext")
+	}
+
+	forged := &DecryptionProof{A: proof.A, Z: proof.Z.Add(bigint.NewBigIntFromInt(1))}
+	if err = VerifyDecryption(c, m, key.N, forged); err == nil {
+		t.Error("proof with a changed response accepted")
+	}
+	if err = VerifyDecryption(c, m, key.N, &DecryptionProof{A: proof.A}); err == nil {
+		t.Error("incomplete proof accepted")
+	}
+}
@@ -7,8 +7,6 @@ import (
 	"ev/internal/crypto/bigint"
 	"strconv"
 	"strings"
-
-	"github.com/rs/zerolog/log"
 )
 
 // L(x, n) = (x - 1) / n
@@ -32,6 +30,39 @@ func GeneratePaillierKeys(p, q *bigint.BigInt) (n, lambda, g *bigint.BigInt) {
 	return
 }
 
+// PaillierKeyPair содержит ключи одного голосования
+type PaillierKeyPair struct {
+	N      *bigint.BigInt
+	Lambda *bigint.BigInt
+	G      *bigint.BigInt
+}
+
+// NewPaillierKeyPair генерирует ключ с модулем n длиной bits бит на криптостойком генераторе
+func NewPaillierKeyPair(bits int) (*PaillierKeyPair, error) {
+	for {
+		p, err := generatePrime(bits / 2)
+		if err != nil {
+			return nil, err
+		}
+		q, err := generatePrime(bits - bits/2)
+		if err != nil {
+			return nil, err
+		}
+		if p.Eq(q) {
+			continue
+		}
+
+		n, lambda, g := GeneratePaillierKeys(p, q)
+		// gcd(n, (p-1)(q-1)) = 1 гарантирует корректность расшифрования при g = n + 1
+		phi := p.Sub(bigint.NewBigIntFromInt(1)).Mul(q.Sub(bigint.NewBigIntFromInt(1)))
+		if !bigint.GCD(n, phi).Eq(bigint.NewBigIntFromInt(1)) || n.BitLen() != bits {
+			continue
+		}
+
+		return &PaillierKeyPair{N: n, Lambda: lambda, G: g}, nil
+	}
+}
+
 // Encrypt: c = g^m * r^n mod n^2
 func Encrypt(m, r, g, n *bigint.BigInt) *bigint.BigInt {
 	nn := n.Mul(n)
@@ -99,6 +130,21 @@ func CountSum(values []*bigint.BigInt, n *bigint.BigInt) *bigint.BigInt {
 	return sum
 }
 
+// CountWeightedSum перемножает шифротексты, возведённые в степень веса бюллетеня:
+// Π c_i^w_i mod n² шифрует Σ w_i * m_i. При всех весах 1 совпадает с CountSum
+func CountWeightedSum(values []*bigint.BigInt, weights []uint64, n *bigint.BigInt) *bigint.BigInt {
+	sum := bigint.NewBigIntFromInt(1)
+	nn := n.Mul(n)
+
+	for i, v := range values {
+		if weights[i] != 1 {
+			v = v.ModExp(bigint.NewBigIntFromUint(weights[i]), nn)
+		}
+		sum = sum.Mul(v).Mod(nn)
+	}
+	return sum
+}
+
 func SplitAndConvert(binaryString string, chunkSize int) ([]int64, error) {
 	var numbers []int64
 	n := len(binaryString)
@@ -121,15 +167,3 @@ func SplitAndConvert(binaryString string, chunkSize int) ([]int64, error) {
 
 	return numbers, nil
 }
-
-func CreateValueVerify(C *bigint.BigInt, lmbd *bigint.BigInt, n *bigint.BigInt) *bigint.BigInt {
-	N_inv, err := n.ModInverse(lmbd)
-	if err != nil {
-		log.Error().Err(err).Msg("ModInverse error")
-		return nil
-	}
-
-	R := C.Mod(n)
-	r_prime := R.ModExp(N_inv, n)
-	return r_prime
-}
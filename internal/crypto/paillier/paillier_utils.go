@@ -0,0 +1,90 @@
+package paillier
+
+import (
+	"crypto/rand"
+	"ev/internal/crypto/bigint"
+)
+
+// randomBigInt возвращает случайное число в диапазоне [0, max)
+func randomBigInt(max *bigint.BigInt) (*bigint.BigInt, error) {
+	// Берём на 8 байт больше, чтобы смещение от взятия по модулю было пренебрежимо малым
+	bytes := make([]byte, len(max.Bytes())+8)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return nil, err
+	}
+	return bigint.NewBigInt().SetBytes(bytes).Mod(max), nil
+}
+
+// randomUnit возвращает случайный элемент группы Z*_n
+func randomUnit(n *bigint.BigInt) (*bigint.BigInt, error) {
+	one := bigint.NewBigIntFromInt(1)
+	for {
+		r, err := randomBigInt(n)
+		if err != nil {
+			return nil, err
+		}
+		if r.Gt(one) && bigint.GCD(r, n).Eq(one) {
+			return r, nil
+		}
+	}
+}
+
+// randomBits возвращает случайное неотрицательное число длиной не более bits бит
+func randomBits(bits int) (*bigint.BigInt, error) {
+	bytes := make([]byte, (bits+7)/8)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return nil, err
+	}
+	r := bigint.NewBigInt().SetBytes(bytes)
+	return r.Mod(bigint.NewBigIntFromInt(1).Lsh(uint(bits))), nil
+}
+
+func generatePrime(bits int) (*bigint.BigInt, error) {
+	bytes := make([]byte, (bits+7)/8)
+	topBit := uint((bits - 1) % 8)
+	for {
+		_, err := rand.Read(bytes)
+		if err != nil {
+			return nil, err
+		}
+		// Обрезаем лишние старшие биты и выставляем старший бит для нужной длины
+		bytes[0] &= byte(1<<(topBit+1)) - 1
+		bytes[0] |= byte(1 << topBit)
+		// Устанавливаем младший бит в 1 для обеспечения нечётности
+		bytes[len(bytes)-1] |= 0x01
+
+		p := bigint.NewBigInt().SetBytes(bytes)
+		if p.ProbablyPrime(20) {
+			return p, nil
+		}
+	}
+}
+
+// generateSafePrime возвращает простое p = 2p' + 1, где p' тоже простое
+func generateSafePrime(bits int) (*bigint.BigInt, error) {
+	one := bigint.NewBigIntFromInt(1)
+	for {
+		pPrime, err := generatePrime(bits - 1)
+		if err != nil {
+			return nil, err
+		}
+		p := pPrime.Lsh(1).Add(one)
+		if p.ProbablyPrime(20) {
+			return p, nil
+		}
+	}
+}
+
+// modExpSigned возводит в степень с учётом отрицательного показателя
+func modExpSigned(base, exponent, mod *bigint.BigInt) (*bigint.BigInt, error) {
+	if exponent.Sign() >= 0 {
+		return base.ModExp(exponent, mod), nil
+	}
+	inv, err := base.ModInverse(mod)
+	if err != nil {
+		return nil, err
+	}
+	return inv.ModExp(exponent.Neg(), mod), nil
+}
@@ -0,0 +1,309 @@
+package paillier
+
+import (
+	"errors"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/zkp"
+	"fmt"
+)
+
+// Пороговый вариант Paillier (схема Дамгарда–Юрика для s = 1).
+// Ключ расшифрования d делится между l доверенными лицами по схеме Шамира,
+// для расшифрования суммы достаточно t частичных расшифрований.
+
+// ThresholdChallengeBits задаёт размер челленджа в доказательствах частичного расшифрования
+const ThresholdChallengeBits = 256
+
+// ThresholdPublicKey содержит открытые параметры порогового ключа
+type ThresholdPublicKey struct {
+	N                *bigint.BigInt   `json:"n"`
+	V                *bigint.BigInt   `json:"v"`
+	VerificationKeys []*bigint.BigInt `json:"verification_keys"`
+	Threshold        int              `json:"threshold"`
+	Trustees         int              `json:"trustees"`
+}
+
+// Validate проверяет согласованность открытого ключа: порог 1 ≤ t ≤ l и по ключу проверки
+// на каждое доверенное лицо
+func (pub *ThresholdPublicKey) Validate() error {
+	if pub.N == nil || pub.V == nil {
+		return errors.New("threshold public key is incomplete")
+	}
+	if pub.Threshold < 1 || pub.Threshold > pub.Trustees {
+		return fmt.Errorf("threshold %d is out of range for %d trustees", pub.Threshold, pub.Trustees)
+	}
+	if len(pub.VerificationKeys) != pub.Trustees {
+		return fmt.Errorf("got %d verification keys for %d trustees", len(pub.VerificationKeys), pub.Trustees)
+	}
+	for i, vi := range pub.VerificationKeys {
+		if vi == nil {
+			return fmt.Errorf("verification key of trustee %d is missing", i+1)
+		}
+	}
+	return nil
+}
+
+// ThresholdKeyShare хранится у одного доверенного лица и никогда не попадает на сервер
+type ThresholdKeyShare struct {
+	VotingID string         `json:"voting_id"`
+	Index    int            `json:"index"`
+	Trustees int            `json:"trustees"`
+	N        *bigint.BigInt `json:"n"`
+	V        *bigint.BigInt `json:"v"`
+	Share    *bigint.BigInt `json:"share"`
+}
+
+// PartialDecryptionProof доказывает, что частичное расшифрование выполнено долей ключа,
+// соответствующей опубликованному проверочному ключу
+type PartialDecryptionProof struct {
+	A *bigint.BigInt `json:"a"`
+	B *bigint.BigInt `json:"b"`
+	Z *bigint.BigInt `json:"z"`
+}
+
+// PartialDecryption — вклад одного доверенного лица в расшифрование
+type PartialDecryption struct {
+	Index int                    `json:"index"`
+	Value *bigint.BigInt         `json:"value"`
+	Proof PartialDecryptionProof `json:"proof"`
+}
+
+// factorial возвращает l! (Δ в обозначениях схемы)
+func factorial(l int) *bigint.BigInt {
+	result := bigint.NewBigIntFromInt(1)
+	for i := 2; i <= l; i++ {
+		result = result.Mul(bigint.NewBigIntFromInt(int64(i)))
+	}
+	return result
+}
+
+// GenerateThresholdKeys создаёт пороговый ключ на безопасных простых длиной bits/2
+// и делит его между trustees доверенными лицами с порогом threshold
+func GenerateThresholdKeys(bits, trustees, threshold int) (*ThresholdPublicKey, []ThresholdKeyShare, error) {
+	if threshold < 1 || threshold > trustees {
+		return nil, nil, errors.New("threshold must be between 1 and the number of trustees")
+	}
+
+	one := bigint.NewBigIntFromInt(1)
+
+	p, err := generateSafePrime(bits / 2)
+	if err != nil {
+		return nil, nil, err
+	}
+	q, err := generateSafePrime(bits / 2)
+	if err != nil {
+		return nil, nil, err
+	}
+	for p.Eq(q) {
+		q, err = generateSafePrime(bits / 2)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	n := p.Mul(q)
+	nn := n.Mul(n)
+	// m = p'q', где p = 2p' + 1, q = 2q' + 1
+	m := p.Sub(one).Rsh(1).Mul(q.Sub(one).Rsh(1))
+	nm := n.Mul(m)
+
+	// d ≡ 0 mod m, d ≡ 1 mod n
+	mInv, err := m.ModInverse(n)
+	if err != nil {
+		return nil, nil, errors.New("m is not invertible modulo n")
+	}
+	d := m.Mul(mInv).Mod(nm)
+
+	// Многочлен f(X) = d + a_1 X + ... + a_{t-1} X^{t-1} mod nm
+	coefficients := make([]*bigint.BigInt, threshold)
+	coefficients[0] = d
+	for i := 1; i < threshold; i++ {
+		coefficients[i], err = randomBigInt(nm)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// v — случайный квадрат в Z*_{n^2}
+	r, err := randomUnit(nn)
+	if err != nil {
+		return nil, nil, err
+	}
+	v := r.Mul(r).Mod(nn)
+
+	delta := factorial(trustees)
+
+	shares := make([]ThresholdKeyShare, trustees)
+	verificationKeys := make([]*bigint.BigInt, trustees)
+	for i := 1; i <= trustees; i++ {
+		x := bigint.NewBigIntFromInt(int64(i))
+		share := bigint.NewBigInt()
+		for j := threshold - 1; j >= 0; j-- {
+			share = share.Mul(x).Add(coefficients[j]).Mod(nm)
+		}
+		shares[i-1] = ThresholdKeyShare{
+			Index:    i,
+			Trustees: trustees,
+			N:        n,
+			V:        v,
+			Share:    share,
+		}
+		verificationKeys[i-1] = v.ModExp(delta.Mul(share), nn)
+	}
+
+	return &ThresholdPublicKey{
+		N:                n,
+		V:                v,
+		VerificationKeys: verificationKeys,
+		Threshold:        threshold,
+		Trustees:         trustees,
+	}, shares, nil
+}
+
+// partialChallenge вычисляет челлендж Фиата–Шамира для доказательства частичного расшифрования
+func partialChallenge(c4, ci2, v, vi, a, b *bigint.BigInt) *bigint.BigInt {
+	twoToB := bigint.NewBigIntFromInt(1).Lsh(ThresholdChallengeBits)
+	return zkp.ComputeDigest([]*bigint.BigInt{c4, ci2, v, vi, a, b}).Mod(twoToB)
+}
+
+// PartialDecrypt вычисляет c_i = c^(2Δs_i) mod n^2 и доказательство равенства
+// дискретных логарифмов log_{c^4}(c_i^2) = log_v(v_i)
+func PartialDecrypt(share ThresholdKeyShare, c *bigint.BigInt) (*PartialDecryption, error) {
+	n := share.N
+	v := share.V
+	nn := n.Mul(n)
+	delta := factorial(share.Trustees)
+	exponent := delta.Mul(share.Share)
+
+	value := c.ModExp(exponent.Lsh(1), nn)
+
+	c4 := c.ModExp(bigint.NewBigIntFromInt(4), nn)
+	ci2 := value.Mul(value).Mod(nn)
+	vi := v.ModExp(exponent, nn)
+
+	// Случайное r должно статистически скрывать e·Δ·s_i
+	r, err := randomBits(nn.BitLen() + 2*ThresholdChallengeBits)
+	if err != nil {
+		return nil, err
+	}
+
+	a := c4.ModExp(r, nn)
+	b := v.ModExp(r, nn)
+	e := partialChallenge(c4, ci2, v, vi, a, b)
+	z := r.Add(e.Mul(exponent))
+
+	return &PartialDecryption{
+		Index: share.Index,
+		Value: value,
+		Proof: PartialDecryptionProof{A: a, B: b, Z: z},
+	}, nil
+}
+
+// VerifyPartialDecryption проверяет доказательство частичного расшифрования шифротекста c
+func VerifyPartialDecryption(pub *ThresholdPublicKey, c *bigint.BigInt, partial *PartialDecryption) error {
+	if err := pub.Validate(); err != nil {
+		return err
+	}
+	if partial.Index < 1 || partial.Index > pub.Trustees {
+		return fmt.Errorf("trustee index %d is out of range", partial.Index)
+	}
+	if partial.Value == nil || partial.Proof.A == nil || partial.Proof.B == nil || partial.Proof.Z == nil {
+		return errors.New("partial decryption is incomplete")
+	}
+
+	nn := pub.N.Mul(pub.N)
+	vi := pub.VerificationKeys[partial.Index-1]
+
+	c4 := c.ModExp(bigint.NewBigIntFromInt(4), nn)
+	ci2 := partial.Value.Mul(partial.Value).Mod(nn)
+	e := partialChallenge(c4, ci2, pub.V, vi, partial.Proof.A, partial.Proof.B)
+
+	// c^(4z) ≡ a * c_i^(2e) mod n^2
+	left := c4.ModExp(partial.Proof.Z, nn)
+	right := partial.Proof.A.Mul(ci2.ModExp(e, nn)).Mod(nn)
+	if !left.Eq(right) {
+		return errors.New("partial decryption proof check failed")
+	}
+
+	// v^z ≡ b * v_i^e mod n^2
+	left = pub.V.ModExp(partial.Proof.Z, nn)
+	right = partial.Proof.B.Mul(vi.ModExp(e, nn)).Mod(nn)
+	if !left.Eq(right) {
+		return errors.New("verification key check failed")
+	}
+
+	return nil
+}
+
+// CombinePartialDecryptions восстанавливает открытый текст по t проверенным частичным расшифрованиям
+func CombinePartialDecryptions(pub *ThresholdPublicKey, partials []*PartialDecryption) (*bigint.BigInt, error) {
+	if len(partials) < pub.Threshold {
+		return nil, fmt.Errorf("need %d partial decryptions, got %d", pub.Threshold, len(partials))
+	}
+	partials = partials[:pub.Threshold]
+
+	seen := make(map[int]bool)
+	for _, partial := range partials {
+		if seen[partial.Index] {
+			return nil, fmt.Errorf("duplicate partial decryption from trustee %d", partial.Index)
+		}
+		seen[partial.Index] = true
+	}
+
+	n := pub.N
+	nn := n.Mul(n)
+	delta := factorial(pub.Trustees)
+
+	combined := bigint.NewBigIntFromInt(1)
+	for _, partial := range partials {
+		// λ_{0,i} = Δ * Π_{i' != i} i' / (i' - i) — всегда целое число
+		numerator := delta.Copy()
+		denominator := bigint.NewBigIntFromInt(1)
+		for _, other := range partials {
+			if other.Index == partial.Index {
+				continue
+			}
+			numerator = numerator.Mul(bigint.NewBigIntFromInt(int64(other.Index)))
+			denominator = denominator.Mul(bigint.NewBigIntFromInt(int64(other.Index - partial.Index)))
+		}
+		lambda := numerator.Abs().Div(denominator.Abs())
+		if numerator.Sign()*denominator.Sign() < 0 {
+			lambda = lambda.Neg()
+		}
+
+		term, err := modExpSigned(partial.Value, lambda.Lsh(1), nn)
+		if err != nil {
+			return nil, err
+		}
+		combined = combined.Mul(term).Mod(nn)
+	}
+
+	// combined = (1 + n)^(4Δ²m) mod n^2
+	fourDeltaSquared := delta.Mul(delta).Lsh(2)
+	inv, err := fourDeltaSquared.Mod(n).ModInverse(n)
+	if err != nil {
+		return nil, errors.New("modular inverse does not exist")
+	}
+
+	return L(combined, n).Mul(inv).Mod(n), nil
+}
+
+// VerifyThresholdDecryption проверяет опубликованные частичные расшифрования c
+// и то, что их комбинация даёт m
+func VerifyThresholdDecryption(pub *ThresholdPublicKey, c, m *bigint.BigInt, partials []*PartialDecryption) error {
+	for _, partial := range partials {
+		if err := VerifyPartialDecryption(pub, c, partial); err != nil {
+			return fmt.Errorf("trustee %d: %w", partial.Index, err)
+		}
+	}
+
+	combined, err := CombinePartialDecryptions(pub, partials)
+	if err != nil {
+		return err
+	}
+	if !combined.Eq(m) {
+		return errors.New("partial decryptions do not combine to the published result")
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package paillier
+
+import (
+	"encoding/json"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/zkp"
+	"testing"
+)
+
+func TestThresholdDecryptionRoundTrip(t *testing.T) {
+	pub, shares, err := GenerateThresholdKeys(512, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pub.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Сумма двух бюллетеней: 5 + 37
+	c1, _ := zkp.Encrypt(pub.N, 1, bigint.NewBigIntFromInt(5))
+	c2, _ := zkp.Encrypt(pub.N, 1, bigint.NewBigIntFromInt(37))
+	c := CountSum([]*bigint.BigInt{c1, c2}, pub.N)
+	expected := bigint.NewBigIntFromInt(42)
+
+	// Любые два доверенных лица из трёх
+	for _, pair := range [][2]int{{0, 1}, {0, 2}, {2, 1}} {
+		partials := make([]*PartialDecryption, 0, 2)
+		for _, i := range pair {
+			partial, err := PartialDecrypt(shares[i], c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = VerifyPartialDecryption(pub, c, partial); err != nil {
+				t.Fatalf("trustee %d: valid partial decryption rejected: %v", partial.Index, err)
+			}
+			partials = append(partials, partial)
+		}
+
+		// Частичные расшифрования публикуются в JSON
+		jsoned, err := json.Marshal(partials)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var published []*PartialDecryption
+		if err = json.Unmarshal(jsoned, &published); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := CombinePartialDecryptions(pub, published)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m.Eq(expected) {
+			t.Fatalf("trustees %v combined %s, expected 42", pair, m.ToString())
+		}
+		if err = VerifyThresholdDecryption(pub, c, m, published); err != nil {
+			t.Fatalf("trustees %v: %v", pair, err)
+		}
+	}
+}
+
+func TestThresholdDecryptionRejectsInvalidPartials(t *testing.T) {
+	pub, shares, err := GenerateThresholdKeys(512, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := zkp.Encrypt(pub.N, 1, bigint.NewBigIntFromInt(7))
+	other, _ := zkp.Encrypt(pub.N, 1, bigint.NewBigIntFromInt(8))
+
+	first, err := PartialDecrypt(shares[0], c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := PartialDecrypt(shares[1], c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = VerifyPartialDecryption(pub, other, first); err == nil {
+		t.Error("partial decryption accepted for another ciphertext")
+	}
+
+	forged := *first
+	forged.Value = forged.Value.Mul(forged.Value).Mod(pub.N.Mul(pub.N))
+	if err = VerifyPartialDecryption(pub, c, &forged); err == nil {
+		t.Error("partial decryption with a changed value accepted")
+	}
+
+	impostor := *first
+	impostor.Index = 3
+	if err = VerifyPartialDecryption(pub, c, &impostor); err == nil {
+		t.Error("partial decryption accepted under another trustee's verification key")
+	}
+
+	if _, err = CombinePartialDecryptions(pub, []*PartialDecryption{first}); err == nil {
+		t.Error("decryption combined below the threshold")
+	}
+	if _, err = CombinePartialDecryptions(pub, []*PartialDecryption{first, first}); err == nil {
+		t.Error("decryption combined from one trustee twice")
+	}
+	if err = VerifyThresholdDecryption(pub, c, bigint.NewBigIntFromInt(8), []*PartialDecryption{first, second}); err == nil {
+		t.Error("threshold decryption accepted for a wrong result")
+	}
+
+	broken := *pub
+	broken.VerificationKeys = broken.VerificationKeys[:2]
+	if err = VerifyPartialDecryption(&broken, c, first); err == nil {
+		t.Error("public key without all verification keys accepted")
+	}
+}
@@ -8,20 +8,57 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// CorrectMessageProof реализует доказательство допустимости зашифрованного сообщения
+// Версии формата доказательства
+const (
+	// ProofVersionLegacy — челлендж считается только по AVals
+	ProofVersionLegacy uint = 1
+	// ProofVersionContext — челлендж привязан к n, шифротексту, множеству
+	// допустимых сообщений, голосованию и метке бюллетеня
+	ProofVersionContext uint = 2
+)
+
+// ProofContext — контекст бюллетеня, к которому привязывается доказательство версии 2
+type ProofContext struct {
+	VotingID *bigint.BigInt
+	Label    *bigint.BigInt
+}
+
+// CorrectMessageProof реализует доказательство допустимости зашифрованного сообщения.
+// Для схемы Дамгорда–Юрика с s > 1 доказывается, что c·(1+n)^(-m_i) является n^s-й степенью
+// по модулю n^(s+1); при s = 1 это доказательство для Paillier
 type CorrectMessageProof struct {
 	EVals         []*bigint.BigInt
 	ZVals         []*bigint.BigInt
 	AVals         []*bigint.BigInt
 	B             uint
+	Version       uint
+	context       *ProofContext
 	ciphertext    *bigint.BigInt
 	validMessages []*bigint.BigInt
 	n             *bigint.BigInt
-	nn            *bigint.BigInt
+	s             uint
+	// ns = n^s — показатель степени в уравнениях, nn = n^(s+1) — модуль шифротекстов
+	ns *bigint.BigInt
+	nn *bigint.BigInt
+}
+
+// Moduli возвращает n^s и n^(s+1) для схемы Дамгорда–Юрика; s = 0 означает s = 1
+func Moduli(n *bigint.BigInt, s uint) (ns, nn *bigint.BigInt) {
+	ns = n.Copy()
+	for i := uint(1); i < s; i++ {
+		ns = ns.Mul(n)
+	}
+	return ns, ns.Mul(n)
+}
+
+// exponent возвращает s схемы, считая s = 0 равным 1
+func exponent(s uint) uint {
+	return max(s, 1)
 }
 
 // NewCorrectMessageProof создаёт ZKP-доказательство из готовых векторов
-func NewCorrectMessageProof(eVec, zVec, aVec []*bigint.BigInt, cipher *bigint.BigInt, validMsgs []*bigint.BigInt, n *bigint.BigInt, b uint) *CorrectMessageProof {
+func NewCorrectMessageProof(eVec, zVec, aVec []*bigint.BigInt, cipher *bigint.BigInt, validMsgs []*bigint.BigInt, n *bigint.BigInt, s uint, b uint) *CorrectMessageProof {
+	ns, nn := Moduli(n, s)
 	return &CorrectMessageProof{
 		EVals:         eVec,
 		ZVals:         zVec,
@@ -29,18 +66,61 @@ func NewCorrectMessageProof(eVec, zVec, aVec []*bigint.BigInt, cipher *bigint.Bi
 		ciphertext:    cipher,
 		validMessages: validMsgs,
 		n:             n,
-		nn:            n.Mul(n),
+		s:             exponent(s),
+		ns:            ns,
+		nn:            nn,
 		B:             b,
+		Version:       ProofVersionLegacy,
 	}
 }
 
-// Prove создает новое доказательство для заданного сообщения
-func Prove(n *bigint.BigInt, validMessages []*bigint.BigInt, messageToEncrypt *bigint.BigInt, b uint) *CorrectMessageProof {
-	nn := n.Mul(n)
-	numOfMessages := len(validMessages)
+// WithContext переводит доказательство на версию 2 с привязкой к контексту бюллетеня
+func (proof *CorrectMessageProof) WithContext(context *ProofContext) *CorrectMessageProof {
+	proof.Version = ProofVersionContext
+	proof.context = context
+	return proof
+}
+
+// challenge вычисляет челлендж Фиата–Шамира согласно версии доказательства
+func (proof *CorrectMessageProof) challenge(aVals []*bigint.BigInt) (*bigint.BigInt, error) {
+	twoToB := bigint.NewBigIntFromInt(1).Lsh(proof.B)
+
+	switch proof.Version {
+	case ProofVersionLegacy:
+		if proof.s > 1 {
+			return nil, errors.New("legacy proofs do not support Damgård–Jurik ciphertexts")
+		}
+		return ComputeDigest(aVals).Mod(twoToB), nil
+	case ProofVersionContext:
+		if proof.context == nil || proof.context.VotingID == nil || proof.context.Label == nil {
+			return nil, errors.New("proof context is not set")
+		}
+		values := []*bigint.BigInt{
+			bigint.NewBigIntFromUint(uint64(ProofVersionContext)),
+			proof.n,
+		}
+		// s входит в челлендж только для схемы Дамгорда–Юрика, чтобы не менять челлендж Paillier
+		if proof.s > 1 {
+			values = append(values, bigint.NewBigIntFromUint(uint64(proof.s)))
+		}
+		values = append(values,
+			proof.ciphertext,
+			bigint.NewBigIntFromInt(int64(len(proof.validMessages))),
+		)
+		values = append(values, proof.validMessages...)
+		values = append(values, proof.context.VotingID, proof.context.Label)
+		values = append(values, aVals...)
+		return ComputeDigest(values).Mod(twoToB), nil
+	default:
+		return nil, errors.New("unsupported proof version " + strconv.Itoa(int(proof.Version)))
+	}
+}
+
+// Encrypt шифрует сообщение со случайным r по модулю n^(s+1) и возвращает шифротекст и r
+func Encrypt(n *bigint.BigInt, s uint, messageToEncrypt *bigint.BigInt) (ciphertext, r *bigint.BigInt) {
+	ns, nn := Moduli(n, s)
 
 	// Генерация случайного r и шифрование сообщения
-	var r *bigint.BigInt
 	two := bigint.NewBigIntFromInt(2)
 	for {
 		r = randomInRange(two, n)
@@ -49,9 +129,24 @@ func Prove(n *bigint.BigInt, validMessages []*bigint.BigInt, messageToEncrypt *b
 		}
 	}
 
-	// Шифрование сообщения
 	g := n.Add(bigint.NewBigIntFromInt(1)) // Стандартное значение g для Paillier
-	ciphertext := g.ModExp(messageToEncrypt, nn).Mul(r.ModExp(n, nn)).Mod(nn)
+	ciphertext = g.ModExp(messageToEncrypt, nn).Mul(r.ModExp(ns, nn)).Mod(nn)
+	return ciphertext, r
+}
+
+// Prove создает новое доказательство для заданного сообщения
+func Prove(n *bigint.BigInt, s uint, validMessages []*bigint.BigInt, messageToEncrypt *bigint.BigInt, b uint) *CorrectMessageProof {
+	ciphertext, r := Encrypt(n, s, messageToEncrypt)
+	return ProveEncrypted(n, s, validMessages, messageToEncrypt, ciphertext, r, b, nil)
+}
+
+// ProveEncrypted создает доказательство для уже зашифрованного сообщения.
+// Если context задан, строится доказательство версии 2
+func ProveEncrypted(n *bigint.BigInt, s uint, validMessages []*bigint.BigInt, messageToEncrypt, ciphertext, r *bigint.BigInt, b uint, context *ProofContext) *CorrectMessageProof {
+	ns, nn := Moduli(n, s)
+	numOfMessages := len(validMessages)
+	two := bigint.NewBigIntFromInt(2)
+	g := n.Add(bigint.NewBigIntFromInt(1))
 
 	// Вычисление u_i для каждого допустимого сообщения
 	uiVec := make([]*bigint.BigInt, numOfMessages)
@@ -92,9 +187,9 @@ func Prove(n *bigint.BigInt, validMessages []*bigint.BigInt, messageToEncrypt *b
 	j := 0
 	for i := 0; i < numOfMessages; i++ {
 		if i == trueIndex {
-			aiVec[i] = w.ModExp(n, nn)
+			aiVec[i] = w.ModExp(ns, nn)
 		} else {
-			ziN := ziVec[j].ModExp(n, nn)
+			ziN := ziVec[j].ModExp(ns, nn)
 			uiEi := uiVec[i].ModExp(eiVec[j], nn)
 			uiEiInv, _ := uiEi.ModInverse(nn)
 			aiVec[i] = ziN.Mul(uiEiInv).Mod(nn)
@@ -102,8 +197,16 @@ func Prove(n *bigint.BigInt, validMessages []*bigint.BigInt, messageToEncrypt *b
 		}
 	}
 
+	proof := NewCorrectMessageProof(nil, nil, nil, ciphertext, validMessages, n, s, b)
+	if context != nil {
+		proof.WithContext(context)
+	}
+
 	// Вычисляем challenge (chal)
-	chal := ComputeDigest(aiVec).Mod(twoToB)
+	chal, err := proof.challenge(aiVec)
+	if err != nil {
+		panic(err)
+	}
 
 	// Вычисляем e_i для истинного сообщения
 	eiSum := bigint.NewBigIntFromInt(0)
@@ -133,19 +236,34 @@ func Prove(n *bigint.BigInt, validMessages []*bigint.BigInt, messageToEncrypt *b
 		}
 	}
 
-	return NewCorrectMessageProof(eVec, zVec, aiVec, ciphertext, validMessages, n, b)
+	proof.EVals = eVec
+	proof.ZVals = zVec
+	proof.AVals = aiVec
+	return proof
 }
 
-// Verify проверяет доказательство допустимости
-func (proof *CorrectMessageProof) Verify() error {
+// checkChallenge проверяет длины векторов и то, что сумма e_i равна челленджу
+func (proof *CorrectMessageProof) checkChallenge() error {
 	twoToB := bigint.NewBigIntFromInt(1).Lsh(proof.B)
 
-	// Проверка суммы e_i
-	hash := ComputeDigest(proof.AVals)
-	chal := hash.Mod(twoToB)
+	if len(proof.EVals) != len(proof.validMessages) || len(proof.ZVals) != len(proof.validMessages) || len(proof.AVals) != len(proof.validMessages) {
+		return errors.New("proof vectors length mismatch")
+	}
 
+	chal, err := proof.challenge(proof.AVals)
+	if err != nil {
+		return err
+	}
+
+	// Честный prover не выбирает отрицательных e_i; отрицательный e_i превратил бы проверку в обращение по модулю
 	eiSum := bigint.NewBigIntFromInt(0)
-	for _, e := range proof.EVals {
+	for i, e := range proof.EVals {
+		if e == nil || proof.ZVals[i] == nil || proof.AVals[i] == nil {
+			return errors.New("proof vectors contain empty values")
+		}
+		if e.Sign() < 0 {
+			return errors.New("challenge share is negative")
+		}
 		eiSum = eiSum.Add(e).Mod(twoToB)
 	}
 
@@ -153,29 +271,50 @@ func (proof *CorrectMessageProof) Verify() error {
 		log.Error().Msgf("chal: %s, eiSum: %s", chal.ToString(), eiSum.ToString())
 		return errors.New("challenge check failed")
 	}
+	return nil
+}
 
-	// Вычисление u_i для каждого допустимого сообщения
-	g := proof.n.Add(bigint.NewBigIntFromInt(1))
+// uiValues вычисляет u_i = c / g^m_i mod n^(s+1). При s = 1 и g = n+1 верно g^m = 1 + m·n mod n²,
+// а обратный к нему элемент — 1 - m·n mod n², поэтому возведение в степень не требуется.
+// При s > 1 порядок g равен n^s, и g^(-m) = g^(n^s - m)
+func (proof *CorrectMessageProof) uiValues() []*bigint.BigInt {
+	one := bigint.NewBigIntFromInt(1)
+	g := proof.n.Add(one)
 	uiVec := make([]*bigint.BigInt, len(proof.validMessages))
 	for i, m := range proof.validMessages {
-		gm := g.ModExp(m, proof.nn)
-		gmInv, _ := gm.ModInverse(proof.nn)
-
-		ui := proof.ciphertext.Mul(gmInv).Mod(proof.nn)
-		uiVec[i] = ui
+		var gmInv *bigint.BigInt
+		if proof.s > 1 {
+			gmInv = g.ModExp(proof.ns.Sub(m.Mod(proof.ns)), proof.nn)
+		} else {
+			gmInv = one.Sub(m.Mul(proof.n)).Mod(proof.nn)
+		}
+		uiVec[i] = proof.ciphertext.Mul(gmInv).Mod(proof.nn)
 	}
+	return uiVec
+}
 
-	// Проверка каждого уравнения z_i^n ≡ a_i * u_i^e_i mod n²
-	for i := 0; i < len(proof.validMessages); i++ {
-		ziN := proof.ZVals[i].ModExp(proof.n, proof.nn)
-		uiEi := uiVec[i].ModExp(proof.EVals[i], proof.nn)
-		rightSide := proof.AVals[i].Mul(uiEi).Mod(proof.nn)
+// checkEquation проверяет уравнение z_i^(n^s) ≡ a_i * u_i^e_i mod n^(s+1)
+func (proof *CorrectMessageProof) checkEquation(i int, ui *bigint.BigInt) error {
+	ziN := proof.ZVals[i].ModExp(proof.ns, proof.nn)
+	uiEi := ui.ModExp(proof.EVals[i], proof.nn)
+	rightSide := proof.AVals[i].Mul(uiEi).Mod(proof.nn)
 
-		if !ziN.Eq(rightSide) {
-			log.Error().Msg("Equation " + strconv.Itoa(i) + " check failed")
-			return errors.New("equation check failed")
-		}
+	if !ziN.Eq(rightSide) {
+		log.Error().Msg("Equation " + strconv.Itoa(i) + " check failed")
+		return errors.New("equation check failed")
 	}
-
 	return nil
 }
+
+// Verify проверяет доказательство допустимости. Уравнения для разных вариантов
+// проверяются параллельно в общем пуле (см. parallelFor)
+func (proof *CorrectMessageProof) Verify() error {
+	if err := proof.checkChallenge(); err != nil {
+		return err
+	}
+
+	uiVec := proof.uiValues()
+	return parallelFor(len(proof.validMessages), func(i int) error {
+		return proof.checkEquation(i, uiVec[i])
+	})
+}
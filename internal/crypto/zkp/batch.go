@@ -0,0 +1,148 @@
+package zkp
+
+import (
+	"ev/internal/crypto/bigint"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Пакетная проверка доказательств допустимости.
+//
+// Каждое уравнение z_i^n ≡ a_i * u_i^e_i mod n² возводится в случайную степень ρ_i
+// длиной BatchSecurityBits, и все уравнения с одним n перемножаются:
+//
+//	(Π z_i^ρ_i)^n ≡ Π a_i^ρ_i * u_i^(e_i*ρ_i) mod n²
+//
+// Вместо возведения в степень n для каждого уравнения остаются возведения в короткие степени
+// и одно возведение в степень n на всю группу. Для схемы Дамгорда–Юрика группируются уравнения
+// с одними n и s, а n и n² заменяются на n^s и n^(s+1). Если хотя бы одно уравнение неверно,
+// равенство выполняется с вероятностью не больше 2^-BatchSecurityBits для расхождений,
+// порядок которых делится на p или q. Расхождение d, порядок которого взаимно прост с n,
+// само является n-й степенью (d = w^n), и уравнение выполняется для z_i/w, поэтому
+// пропуск такого расхождения не нарушает стойкость доказательства.
+// При неудаче пакетной проверки доказательства группы проверяются по одному,
+// чтобы найти неверные
+
+// BatchSecurityBits — длина случайных множителей ρ в битах
+const BatchSecurityBits = 64
+
+// BatchError перечисляет номера не прошедших проверку доказательств
+type BatchError struct {
+	Failed []int
+}
+
+func (e *BatchError) Error() string {
+	failed := make([]string, len(e.Failed))
+	for i, index := range e.Failed {
+		failed[i] = strconv.Itoa(index)
+	}
+	return "proof check failed for indices " + strings.Join(failed, ", ")
+}
+
+// batchEquation — уравнение j доказательства proof с заранее вычисленным u_j
+type batchEquation struct {
+	proof *CorrectMessageProof
+	index int
+	ui    *bigint.BigInt
+}
+
+// BatchVerify проверяет доказательства вместе. Возвращает *BatchError с номерами
+// неверных доказательств в proofs или nil, если все доказательства верны
+func BatchVerify(proofs []*CorrectMessageProof) error {
+	var (
+		mu     sync.Mutex
+		failed []int
+	)
+	fail := func(index int) {
+		mu.Lock()
+		failed = append(failed, index)
+		mu.Unlock()
+	}
+
+	// Челленджи проверяются для каждого доказательства отдельно, уравнения группируются по n и s
+	groups := map[string][]int{}
+	order := []string{}
+	for i, proof := range proofs {
+		if err := proof.checkChallenge(); err != nil {
+			fail(i)
+			continue
+		}
+		key := proof.n.ToString() + "/" + strconv.FormatUint(uint64(proof.s), 10)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	for _, key := range order {
+		indices := groups[key]
+		if batchCheck(proofs, indices) {
+			continue
+		}
+
+		// Поиск неверных доказательств; уравнения каждого доказательства проверяются
+		// внутри одной задачи пула, так как вложенные обращения к пулу запрещены
+		parallelFor(len(indices), func(k int) error {
+			proof := proofs[indices[k]]
+			for j, ui := range proof.uiValues() {
+				if proof.checkEquation(j, ui) != nil {
+					fail(indices[k])
+					break
+				}
+			}
+			return nil
+		})
+	}
+
+	if len(failed) > 0 {
+		sort.Ints(failed)
+		return &BatchError{Failed: failed}
+	}
+	return nil
+}
+
+// batchCheck проверяет случайную линейную комбинацию уравнений доказательств с общим n
+func batchCheck(proofs []*CorrectMessageProof, indices []int) bool {
+	equations := []batchEquation{}
+	for _, i := range indices {
+		for j, ui := range proofs[i].uiValues() {
+			equations = append(equations, batchEquation{proof: proofs[i], index: j, ui: ui})
+		}
+	}
+	if len(equations) == 0 {
+		return true
+	}
+
+	ns := proofs[indices[0]].ns
+	nn := proofs[indices[0]].nn
+	twoToS := bigint.NewBigIntFromInt(1).Lsh(BatchSecurityBits)
+
+	// Уравнения делятся на части по числу слотов пула; каждая часть даёт свои произведения
+	chunks := min(cap(verifySlots), len(equations))
+	leftParts := make([]*bigint.BigInt, chunks)
+	rightParts := make([]*bigint.BigInt, chunks)
+	parallelFor(chunks, func(c int) error {
+		left := bigint.NewBigIntFromInt(1)
+		right := bigint.NewBigIntFromInt(1)
+		for k := c; k < len(equations); k += chunks {
+			eq := equations[k]
+			rho := randomBigInt(twoToS)
+			left = left.Mul(eq.proof.ZVals[eq.index].ModExp(rho, nn)).Mod(nn)
+			right = right.Mul(eq.proof.AVals[eq.index].ModExp(rho, nn)).Mod(nn)
+			right = right.Mul(eq.ui.ModExp(eq.proof.EVals[eq.index].Mul(rho), nn)).Mod(nn)
+		}
+		leftParts[c], rightParts[c] = left, right
+		return nil
+	})
+
+	left := bigint.NewBigIntFromInt(1)
+	right := bigint.NewBigIntFromInt(1)
+	for c := 0; c < chunks; c++ {
+		left = left.Mul(leftParts[c]).Mod(nn)
+		right = right.Mul(rightParts[c]).Mod(nn)
+	}
+
+	return left.ModExp(ns, nn).Eq(right)
+}
@@ -0,0 +1,93 @@
+package zkp_test
+
+import (
+	"errors"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/zkp"
+	"reflect"
+	"testing"
+)
+
+func testMessages(count int) []*bigint.BigInt {
+	messages := make([]*bigint.BigInt, count)
+	for i := range messages {
+		messages[i] = bigint.NewBigIntFromInt(1).Lsh(uint(8 * i))
+	}
+	return messages
+}
+
+func TestCorrectMessageProofBindsContext(t *testing.T) {
+	key := testKey(t)
+	messages := testMessages(4)
+	context := testContext(1, 10)
+
+	c, r := zkp.Encrypt(key.N, 1, messages[2])
+	record := zkp.ProveEncrypted(key.N, 1, messages, messages[2], c, r, testChallengeBits, context).Record()
+	if record.Version != zkp.ProofVersionContext {
+		t.Fatalf("proof version %d", record.Version)
+	}
+
+	verify := func(ciphertext *bigint.BigInt, valid []*bigint.BigInt, votingID, label int64) error {
+		return record.Proof(ciphertext, valid, key.N, 1, testChallengeBits, bigint.NewBigIntFromInt(votingID), bigint.NewBigIntFromInt(label)).Verify()
+	}
+
+	if err := verify(c, messages, 1, 10); err != nil {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+	if err := verify(c, messages, 2, 10); err == nil {
+		t.Error("proof accepted for another voting")
+	}
+	if err := verify(c, messages, 1, 11); err == nil {
+		t.Error("proof accepted for another ballot label")
+	}
+	other, _ := zkp.Encrypt(key.N, 1, messages[2])
+	if err := verify(other, messages, 1, 10); err == nil {
+		t.Error("proof accepted for another ciphertext")
+	}
+	reordered := []*bigint.BigInt{messages[1], messages[0], messages[2], messages[3]}
+	if err := verify(c, reordered, 1, 10); err == nil {
+		t.Error("proof accepted for another set of valid messages")
+	}
+
+	// Зашифровано недопустимое сообщение: доказательство не строится честно и не проходит
+	invalid, rInvalid := zkp.Encrypt(key.N, 1, bigint.NewBigIntFromInt(3))
+	forged := zkp.ProveEncrypted(key.N, 1, messages, messages[0], invalid, rInvalid, testChallengeBits, context)
+	if err := forged.Verify(); err == nil {
+		t.Error("proof accepted for a message outside the valid set")
+	}
+}
+
+func TestBatchVerify(t *testing.T) {
+	key := testKey(t)
+	messages := testMessages(3)
+
+	proofs := make([]*zkp.CorrectMessageProof, 6)
+	ciphertexts := make([]*bigint.BigInt, len(proofs))
+	for i := range proofs {
+		message := messages[i%len(messages)]
+		c, r := zkp.Encrypt(key.N, 1, message)
+		ciphertexts[i] = c
+		proofs[i] = zkp.ProveEncrypted(key.N, 1, messages, message, c, r, testChallengeBits, testContext(1, int64(i)))
+	}
+	// Доказательство для схемы Дамгорда–Юрика проверяется в своей группе
+	c, r := zkp.Encrypt(key.N, 2, messages[1])
+	proofs = append(proofs, zkp.ProveEncrypted(key.N, 2, messages, messages[1], c, r, testChallengeBits, testContext(1, 6)))
+
+	if err := zkp.BatchVerify(proofs); err != nil {
+		t.Fatalf("valid proofs rejected: %v", err)
+	}
+
+	// Доказательство 2 перенесено на другой бюллетень, в доказательстве 4 изменён ответ
+	record := proofs[2].Record()
+	proofs[2] = record.Proof(ciphertexts[2], messages, key.N, 1, testChallengeBits, bigint.NewBigIntFromInt(1), bigint.NewBigIntFromInt(99))
+	proofs[4].ZVals[0] = proofs[4].ZVals[0].Add(bigint.NewBigIntFromInt(1))
+
+	err := zkp.BatchVerify(proofs)
+	var batchErr *zkp.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected a batch error, got %v", err)
+	}
+	if !reflect.DeepEqual(batchErr.Failed, []int{2, 4}) {
+		t.Fatalf("failed proofs %v, expected [2 4]", batchErr.Failed)
+	}
+}
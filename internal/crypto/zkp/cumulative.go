@@ -0,0 +1,76 @@
+package zkp
+
+import (
+	"ev/internal/crypto/bigint"
+	"fmt"
+)
+
+// Бюллетень с распределением баллов. Голосующий распределяет ровно points баллов
+// между вариантами: шифрует число баллов p_i ∈ {0, ..., points} каждого варианта отдельно
+// и доказывает, что шифротекст c_i шифрует число из этого диапазона.
+// Произведение Π c_i шифрует Σ p_i, и доказательство с единственным допустимым сообщением
+// points показывает, что баллы распределены полностью.
+// Бюллетень собирается так же, как бюллетень с выбором нескольких вариантов (CombineChoices),
+// и хранится в тех же MultiChoiceProof и MultiChoiceRecord
+
+// MaxPoints — наибольшее число баллов: доказательство диапазона каждого варианта
+// содержит points+1 значение
+const MaxPoints = 100
+
+// PointsMessages возвращает допустимое число баллов варианта: от 0 до points
+func PointsMessages(points int) []*bigint.BigInt {
+	return TotalMessages(points)
+}
+
+// PointsTotalMessages возвращает единственную допустимую сумму баллов бюллетеня
+func PointsTotalMessages(points int) []*bigint.BigInt {
+	return []*bigint.BigInt{bigint.NewBigIntFromInt(int64(points))}
+}
+
+// EncryptPoints шифрует баллы вариантов и возвращает шифротексты и их r
+func EncryptPoints(n *bigint.BigInt, s uint, distribution []int) (choices, rs []*bigint.BigInt) {
+	choices = make([]*bigint.BigInt, len(distribution))
+	rs = make([]*bigint.BigInt, len(distribution))
+	for i, p := range distribution {
+		choices[i], rs[i] = Encrypt(n, s, bigint.NewBigIntFromInt(int64(p)))
+	}
+	return choices, rs
+}
+
+// ProvePoints строит доказательства для зашифрованных EncryptPoints баллов.
+// Сумма distribution должна быть равна points
+func ProvePoints(n *bigint.BigInt, s uint, distribution []int, choices, rs []*bigint.BigInt, points int, b uint, context *ProofContext) *MultiChoiceProof {
+	proof := &MultiChoiceProof{Choices: make([]*CorrectMessageProof, len(distribution))}
+
+	totalR := bigint.NewBigIntFromInt(1)
+	for i, p := range distribution {
+		proof.Choices[i] = ProveEncrypted(n, s, PointsMessages(points), bigint.NewBigIntFromInt(int64(p)), choices[i], rs[i], b, context)
+		totalR = totalR.Mul(rs[i]).Mod(n)
+	}
+
+	proof.Total = ProveEncrypted(n, s, PointsTotalMessages(points), bigint.NewBigIntFromInt(int64(points)), ChoicesProduct(n, s, choices), totalR, b, context)
+	return proof
+}
+
+// PointsProof восстанавливает доказательства бюллетеня с распределением points баллов
+// между options вариантами из опубликованной записи
+func (record MultiChoiceRecord) PointsProof(options, points int, n *bigint.BigInt, s uint, b uint, votingID, label *bigint.BigInt) (*MultiChoiceProof, error) {
+	if len(record.Choices) != options {
+		return nil, fmt.Errorf("ballot has %d choices for %d options", len(record.Choices), options)
+	}
+	if points < 1 || points > MaxPoints {
+		return nil, fmt.Errorf("points %d are out of range 1..%d", points, MaxPoints)
+	}
+
+	proof := &MultiChoiceProof{Choices: make([]*CorrectMessageProof, options)}
+	ciphertexts := make([]*bigint.BigInt, options)
+	for i, choice := range record.Choices {
+		if choice.Ciphertext == nil {
+			return nil, fmt.Errorf("choice %d has no ciphertext", i)
+		}
+		ciphertexts[i] = choice.Ciphertext
+		proof.Choices[i] = choice.Proof.Proof(choice.Ciphertext, PointsMessages(points), n, s, b, votingID, label)
+	}
+	proof.Total = record.Total.Proof(ChoicesProduct(n, s, ciphertexts), PointsTotalMessages(points), n, s, b, votingID, label)
+	return proof, nil
+}
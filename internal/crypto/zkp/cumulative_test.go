@@ -0,0 +1,84 @@
+package zkp_test
+
+import (
+	"encoding/json"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/paillier"
+	"ev/internal/crypto/zkp"
+	"testing"
+)
+
+func TestPointsProofRoundTrip(t *testing.T) {
+	key := testKey(t)
+	const base = 8
+	const points = 5
+	distribution := []int{3, 0, 2}
+	context := testContext(4, 30)
+
+	choices, rs := zkp.EncryptPoints(key.N, 1, distribution)
+	ballot := zkp.CombineChoices(key.N, 1, choices, base)
+	proof := zkp.ProvePoints(key.N, 1, distribution, choices, rs, points, testChallengeBits, context)
+
+	jsoned, err := json.Marshal(proof.Record())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record zkp.MultiChoiceRecord
+	if err = json.Unmarshal(jsoned, &record); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := record.PointsProof(len(distribution), points, key.N, 1, testChallengeBits, context.VotingID, context.Label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = restored.Verify(ballot, base); err != nil {
+		t.Fatalf("valid distribution rejected: %v", err)
+	}
+
+	// Бюллетень шифрует баллы каждого варианта в своём счетчике
+	m, err := paillier.DecryptDJ(ballot, key.Lambda, key.N, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := bigint.NewBigIntFromInt(3 + 2<<(2*base)); !m.Eq(expected) {
+		t.Fatalf("ballot decrypts to %s, expected %s", m.ToString(), expected.ToString())
+	}
+}
+
+func TestPointsProofRejectsInvalidDistributions(t *testing.T) {
+	key := testKey(t)
+	const base = 8
+	const points = 5
+	context := testContext(4, 31)
+
+	// Распределено 4 балла из 5: доказательство суммы не проходит
+	distribution := []int{3, 0, 1}
+	choices, rs := zkp.EncryptPoints(key.N, 1, distribution)
+	record := zkp.ProvePoints(key.N, 1, distribution, choices, rs, points, testChallengeBits, context).Record()
+	restored, err := record.PointsProof(len(distribution), points, key.N, 1, testChallengeBits, context.VotingID, context.Label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = restored.Verify(zkp.CombineChoices(key.N, 1, choices, base), base); err == nil {
+		t.Error("incomplete distribution accepted")
+	}
+
+	// Доказательство для 5 баллов не подходит голосованию с 4 баллами
+	distribution = []int{4, 0, 1}
+	choices, rs = zkp.EncryptPoints(key.N, 1, distribution)
+	record = zkp.ProvePoints(key.N, 1, distribution, choices, rs, points, testChallengeBits, context).Record()
+	restored, _ = record.PointsProof(len(distribution), points-1, key.N, 1, testChallengeBits, context.VotingID, context.Label)
+	if err = restored.Verify(zkp.CombineChoices(key.N, 1, choices, base), base); err == nil {
+		t.Error("distribution of 5 points accepted for 4 points")
+	}
+
+	for _, invalid := range []int{0, zkp.MaxPoints + 1} {
+		if _, err = record.PointsProof(len(distribution), invalid, key.N, 1, testChallengeBits, context.VotingID, context.Label); err == nil {
+			t.Errorf("record accepted for %d points", invalid)
+		}
+	}
+	if _, err = record.PointsProof(len(distribution)-1, points, key.N, 1, testChallengeBits, context.VotingID, context.Label); err == nil {
+		t.Error("record accepted for another number of options")
+	}
+}
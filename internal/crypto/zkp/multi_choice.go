@@ -0,0 +1,177 @@
+package zkp
+
+import (
+	"errors"
+	"ev/internal/crypto/bigint"
+	"fmt"
+)
+
+// Бюллетень с выбором нескольких вариантов. Голосующий шифрует отметку b_i ∈ {0, 1}
+// каждого варианта отдельно и доказывает допустимость каждого шифротекста c_i.
+// Произведение Π c_i шифрует число отмеченных вариантов, его допустимость
+// в {0, ..., maxChoices} доказывается тем же доказательством CorrectMessageProof.
+// Сам бюллетень — Π c_i^(2^(base*i)) mod n²: он шифрует Σ b_i * 2^(base*i)
+// и суммируется с остальными бюллетенями так же, как бюллетень с одним выбором.
+// Для схемы Дамгорда–Юрика все вычисления ведутся по модулю n^(s+1)
+
+// MultiChoiceProof — доказательства допустимости бюллетеня с выбором нескольких вариантов
+type MultiChoiceProof struct {
+	// Choices[i] доказывает, что шифротекст варианта i шифрует 0 или 1
+	Choices []*CorrectMessageProof
+	// Total доказывает, что произведение шифротекстов вариантов шифрует число от 0 до maxChoices
+	Total *CorrectMessageProof
+}
+
+// ChoiceRecord — шифротекст варианта и доказательство его допустимости
+type ChoiceRecord struct {
+	Ciphertext *bigint.BigInt `json:"ciphertext"`
+	Proof      ProofRecord    `json:"proof"`
+}
+
+// MultiChoiceRecord — доказательства бюллетеня с выбором нескольких вариантов в публикуемом виде
+type MultiChoiceRecord struct {
+	Choices []ChoiceRecord `json:"choices"`
+	Total   ProofRecord    `json:"total"`
+}
+
+// ChoiceMessages возвращает допустимые отметки варианта: 0 и 1
+func ChoiceMessages() []*bigint.BigInt {
+	return []*bigint.BigInt{bigint.NewBigIntFromInt(0), bigint.NewBigIntFromInt(1)}
+}
+
+// TotalMessages возвращает допустимое число отмеченных вариантов: от 0 до maxChoices
+func TotalMessages(maxChoices int) []*bigint.BigInt {
+	messages := make([]*bigint.BigInt, maxChoices+1)
+	for i := range messages {
+		messages[i] = bigint.NewBigIntFromInt(int64(i))
+	}
+	return messages
+}
+
+// ChoicesProduct возвращает Π c_i mod n^(s+1) — шифротекст числа отмеченных вариантов
+func ChoicesProduct(n *bigint.BigInt, s uint, choices []*bigint.BigInt) *bigint.BigInt {
+	_, nn := Moduli(n, s)
+	product := bigint.NewBigIntFromInt(1)
+	for _, c := range choices {
+		product = product.Mul(c).Mod(nn)
+	}
+	return product
+}
+
+// CombineChoices собирает бюллетень Π c_i^(2^(base*i)) mod n^(s+1) из шифротекстов вариантов
+func CombineChoices(n *bigint.BigInt, s uint, choices []*bigint.BigInt, base uint) *bigint.BigInt {
+	_, nn := Moduli(n, s)
+	ballot := bigint.NewBigIntFromInt(1)
+	for i, c := range choices {
+		shift := bigint.NewBigIntFromInt(1).Lsh(base * uint(i))
+		ballot = ballot.Mul(c.ModExp(shift, nn)).Mod(nn)
+	}
+	return ballot
+}
+
+// EncryptChoices шифрует отметки вариантов и возвращает шифротексты и их r
+func EncryptChoices(n *bigint.BigInt, s uint, selected []bool) (choices, rs []*bigint.BigInt) {
+	choices = make([]*bigint.BigInt, len(selected))
+	rs = make([]*bigint.BigInt, len(selected))
+	for i, isSelected := range selected {
+		m := bigint.NewBigIntFromInt(0)
+		if isSelected {
+			m = bigint.NewBigIntFromInt(1)
+		}
+		choices[i], rs[i] = Encrypt(n, s, m)
+	}
+	return choices, rs
+}
+
+// ProveMultiChoice строит доказательства для зашифрованных EncryptChoices отметок.
+// Контекст задаётся по бюллетеню CombineChoices, так как метка вычисляется от него
+func ProveMultiChoice(n *bigint.BigInt, s uint, selected []bool, choices, rs []*bigint.BigInt, maxChoices int, b uint, context *ProofContext) *MultiChoiceProof {
+	proof := &MultiChoiceProof{Choices: make([]*CorrectMessageProof, len(selected))}
+
+	total := 0
+	totalR := bigint.NewBigIntFromInt(1)
+	for i, isSelected := range selected {
+		m := bigint.NewBigIntFromInt(0)
+		if isSelected {
+			m = bigint.NewBigIntFromInt(1)
+			total++
+		}
+		proof.Choices[i] = ProveEncrypted(n, s, ChoiceMessages(), m, choices[i], rs[i], b, context)
+		totalR = totalR.Mul(rs[i]).Mod(n)
+	}
+
+	proof.Total = ProveEncrypted(n, s, TotalMessages(maxChoices), bigint.NewBigIntFromInt(int64(total)), ChoicesProduct(n, s, choices), totalR, b, context)
+	return proof
+}
+
+// Proofs возвращает все доказательства бюллетеня, например для BatchVerify
+func (proof *MultiChoiceProof) Proofs() []*CorrectMessageProof {
+	return append(append([]*CorrectMessageProof{}, proof.Choices...), proof.Total)
+}
+
+// Ciphertexts возвращает шифротексты вариантов
+func (proof *MultiChoiceProof) Ciphertexts() []*bigint.BigInt {
+	ciphertexts := make([]*bigint.BigInt, len(proof.Choices))
+	for i, choice := range proof.Choices {
+		ciphertexts[i] = choice.ciphertext
+	}
+	return ciphertexts
+}
+
+// CheckBallot проверяет, что бюллетень собран из шифротекстов вариантов
+func (proof *MultiChoiceProof) CheckBallot(ballot *bigint.BigInt, base uint) error {
+	if len(proof.Choices) == 0 {
+		return errors.New("ballot has no choices")
+	}
+	if !CombineChoices(proof.Total.n, proof.Total.s, proof.Ciphertexts(), base).Eq(ballot) {
+		return errors.New("ballot does not match choice ciphertexts")
+	}
+	return nil
+}
+
+// Verify проверяет, что бюллетень собран из шифротекстов вариантов, и все доказательства
+func (proof *MultiChoiceProof) Verify(ballot *bigint.BigInt, base uint) error {
+	if err := proof.CheckBallot(ballot, base); err != nil {
+		return err
+	}
+	for i, choice := range proof.Choices {
+		if err := choice.Verify(); err != nil {
+			return fmt.Errorf("choice %d: %w", i, err)
+		}
+	}
+	if err := proof.Total.Verify(); err != nil {
+		return fmt.Errorf("total: %w", err)
+	}
+	return nil
+}
+
+// Record возвращает публикуемую форму доказательств
+func (proof *MultiChoiceProof) Record() MultiChoiceRecord {
+	record := MultiChoiceRecord{
+		Choices: make([]ChoiceRecord, len(proof.Choices)),
+		Total:   proof.Total.Record(),
+	}
+	for i, choice := range proof.Choices {
+		record.Choices[i] = ChoiceRecord{Ciphertext: choice.ciphertext, Proof: choice.Record()}
+	}
+	return record
+}
+
+// Proof восстанавливает доказательства из опубликованной записи для бюллетеня с options вариантами
+func (record MultiChoiceRecord) Proof(options, maxChoices int, n *bigint.BigInt, s uint, b uint, votingID, label *bigint.BigInt) (*MultiChoiceProof, error) {
+	if len(record.Choices) != options {
+		return nil, fmt.Errorf("ballot has %d choices for %d options", len(record.Choices), options)
+	}
+
+	proof := &MultiChoiceProof{Choices: make([]*CorrectMessageProof, options)}
+	ciphertexts := make([]*bigint.BigInt, options)
+	for i, choice := range record.Choices {
+		if choice.Ciphertext == nil {
+			return nil, fmt.Errorf("choice %d has no ciphertext", i)
+		}
+		ciphertexts[i] = choice.Ciphertext
+		proof.Choices[i] = choice.Proof.Proof(choice.Ciphertext, ChoiceMessages(), n, s, b, votingID, label)
+	}
+	proof.Total = record.Total.Proof(ChoicesProduct(n, s, ciphertexts), TotalMessages(maxChoices), n, s, b, votingID, label)
+	return proof, nil
+}
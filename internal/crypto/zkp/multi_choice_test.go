@@ -0,0 +1,96 @@
+package zkp_test
+
+import (
+	"encoding/json"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/paillier"
+	"ev/internal/crypto/zkp"
+	"testing"
+)
+
+func TestMultiChoiceProofRoundTrip(t *testing.T) {
+	key := testKey(t)
+	const base = 8
+	selected := []bool{true, false, true, false}
+	context := testContext(2, 20)
+
+	choices, rs := zkp.EncryptChoices(key.N, 1, selected)
+	ballot := zkp.CombineChoices(key.N, 1, choices, base)
+	proof := zkp.ProveMultiChoice(key.N, 1, selected, choices, rs, 2, testChallengeBits, context)
+
+	// Доказательства публикуются в JSON вместе с бюллетенем
+	jsoned, err := json.Marshal(proof.Record())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record zkp.MultiChoiceRecord
+	if err = json.Unmarshal(jsoned, &record); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := record.Proof(len(selected), 2, key.N, 1, testChallengeBits, context.VotingID, context.Label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = restored.Verify(ballot, base); err != nil {
+		t.Fatalf("valid ballot rejected: %v", err)
+	}
+	if err = zkp.BatchVerify(restored.Proofs()); err != nil {
+		t.Fatalf("valid ballot rejected in batch: %v", err)
+	}
+
+	// Бюллетень шифрует отметку каждого варианта в своём счетчике
+	m, err := paillier.DecryptDJ(ballot, key.Lambda, key.N, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := bigint.NewBigIntFromInt(1 + 1<<(2*base)); !m.Eq(expected) {
+		t.Fatalf("ballot decrypts to %s, expected %s", m.ToString(), expected.ToString())
+	}
+}
+
+func TestMultiChoiceProofRejectsInvalidBallots(t *testing.T) {
+	key := testKey(t)
+	const base = 8
+	selected := []bool{true, true, true}
+	context := testContext(2, 21)
+
+	// Отмечено три варианта при допустимых двух: доказательство суммы построено для maxChoices = 3
+	choices, rs := zkp.EncryptChoices(key.N, 1, selected)
+	ballot := zkp.CombineChoices(key.N, 1, choices, base)
+	record := zkp.ProveMultiChoice(key.N, 1, selected, choices, rs, 3, testChallengeBits, context).Record()
+
+	restored, err := record.Proof(len(selected), 2, key.N, 1, testChallengeBits, context.VotingID, context.Label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = restored.Verify(ballot, base); err == nil {
+		t.Error("ballot with too many choices accepted")
+	}
+
+	// Бюллетень не совпадает с шифротекстами вариантов
+	restored, _ = record.Proof(len(selected), 3, key.N, 1, testChallengeBits, context.VotingID, context.Label)
+	if err = restored.Verify(ballot, base); err != nil {
+		t.Fatalf("valid ballot rejected: %v", err)
+	}
+	other, _ := zkp.Encrypt(key.N, 1, bigint.NewBigIntFromInt(1))
+	if err = restored.Verify(ballot.Mul(other), base); err == nil {
+		t.Error("ballot that does not match its choices accepted")
+	}
+
+	// Вариант с отметкой 2 вместо 0 или 1
+	two, r := zkp.Encrypt(key.N, 1, bigint.NewBigIntFromInt(2))
+	record.Choices[0] = zkp.ChoiceRecord{
+		Ciphertext: two,
+		Proof:      zkp.ProveEncrypted(key.N, 1, []*bigint.BigInt{bigint.NewBigIntFromInt(2)}, bigint.NewBigIntFromInt(2), two, r, testChallengeBits, context).Record(),
+	}
+	restored, _ = record.Proof(len(selected), 3, key.N, 1, testChallengeBits, context.VotingID, context.Label)
+	choices[0] = two
+	if err = restored.Verify(zkp.CombineChoices(key.N, 1, choices, base), base); err == nil {
+		t.Error("choice outside {0, 1} accepted")
+	}
+
+	if _, err = record.Proof(len(selected)+1, 3, key.N, 1, testChallengeBits, context.VotingID, context.Label); err == nil {
+		t.Error("record accepted for another number of options")
+	}
+}
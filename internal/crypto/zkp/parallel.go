@@ -0,0 +1,52 @@
+package zkp
+
+import (
+	"runtime"
+	"sync"
+)
+
+// verifySlots — общий для процесса пул проверок: одновременно выполняется не больше
+// GOMAXPROCS возведений в степень по модулю n², сколько бы бюллетеней ни проверялось параллельно.
+// Задачи, выполняемые в пуле, не должны сами обращаться к пулу
+var verifySlots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// parallelFor выполняет fn(0), ..., fn(count-1) в пуле проверок и возвращает первую ошибку.
+// После ошибки новые задачи не запускаются
+func parallelFor(count int, fn func(i int) error) error {
+	if count == 1 {
+		return fn(0)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for i := 0; i < count; i++ {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+
+		verifySlots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-verifySlots
+				wg.Done()
+			}()
+			if err := fn(i); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return firstErr
+}
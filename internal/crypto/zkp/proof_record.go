@@ -0,0 +1,37 @@
+package zkp
+
+import (
+	"ev/internal/crypto/bigint"
+)
+
+// ProofRecord — доказательство допустимости в том виде, в котором оно публикуется вместе с бюллетенем
+type ProofRecord struct {
+	Version uint             `json:"version"`
+	E       []*bigint.BigInt `json:"e"`
+	Z       []*bigint.BigInt `json:"z"`
+	A       []*bigint.BigInt `json:"a"`
+}
+
+// Record возвращает публикуемую форму доказательства
+func (proof *CorrectMessageProof) Record() ProofRecord {
+	return ProofRecord{
+		Version: proof.Version,
+		E:       proof.EVals,
+		Z:       proof.ZVals,
+		A:       proof.AVals,
+	}
+}
+
+// Proof восстанавливает доказательство из опубликованной записи для повторной проверки.
+// Для версии 2 контекст бюллетеня берётся из votingID и label, s — показатель схемы Дамгорда–Юрика
+func (record ProofRecord) Proof(ciphertext *bigint.BigInt, validMessages []*bigint.BigInt, n *bigint.BigInt, s uint, b uint, votingID, label *bigint.BigInt) *CorrectMessageProof {
+	proof := NewCorrectMessageProof(record.E, record.Z, record.A, ciphertext, validMessages, n, s, b)
+	switch record.Version {
+	case ProofVersionContext:
+		proof.WithContext(&ProofContext{VotingID: votingID, Label: label})
+	case 0, ProofVersionLegacy:
+	default:
+		proof.Version = record.Version
+	}
+	return proof
+}
@@ -0,0 +1,91 @@
+package zkp
+
+import (
+	"ev/internal/crypto/bigint"
+	"fmt"
+)
+
+// Ранжированный бюллетень. Ранжирование m вариантов — матрица перестановки: строка места r
+// содержит единицу в столбце варианта o_r. Голосующий шифрует каждую строку отдельно
+// как бюллетень с одним выбором: c_r шифрует 2^(base*o_r), и доказывает это тем же
+// CorrectMessageProof. Произведение Π c_r шифрует Σ_o k_o * 2^(base*o), где k_o — число мест
+// варианта o; при m < 2^base счетчики k_o не переносятся, и единственное допустимое сообщение
+// Σ_o 2^(base*o) доказывает, что каждый вариант занимает ровно одно место, то есть строки
+// образуют перестановку. Бюллетень — Π c_r^(2^(base*m*r)): он шифрует матрицу перестановки
+// целиком, по m*m ячеек base бит. Доказательства хранятся в MultiChoiceProof и MultiChoiceRecord,
+// Choices[r] — строка места r
+
+// RankingMessages возвращает допустимые строки ранжирования m вариантов: 2^(base*o)
+func RankingMessages(m int, base uint) []*bigint.BigInt {
+	messages := make([]*bigint.BigInt, m)
+	for o := range messages {
+		messages[o] = bigint.NewBigIntFromInt(1).Lsh(base * uint(o))
+	}
+	return messages
+}
+
+// RankingTotalMessages возвращает единственное допустимое произведение строк: Σ_o 2^(base*o)
+func RankingTotalMessages(m int, base uint) []*bigint.BigInt {
+	total := bigint.NewBigIntFromInt(0)
+	for _, message := range RankingMessages(m, base) {
+		total = total.Add(message)
+	}
+	return []*bigint.BigInt{total}
+}
+
+// RankingBase возвращает сдвиг строк бюллетеня для CombineChoices: строка занимает m ячеек base бит
+func RankingBase(m int, base uint) uint {
+	return base * uint(m)
+}
+
+// EncryptRanking шифрует строки ранжирования (ranking[r] — вариант на месте r) и возвращает шифротексты и их r
+func EncryptRanking(n *bigint.BigInt, s uint, ranking []int, base uint) (rows, rs []*bigint.BigInt) {
+	messages := RankingMessages(len(ranking), base)
+	rows = make([]*bigint.BigInt, len(ranking))
+	rs = make([]*bigint.BigInt, len(ranking))
+	for place, option := range ranking {
+		rows[place], rs[place] = Encrypt(n, s, messages[option])
+	}
+	return rows, rs
+}
+
+// ProveRanking строит доказательства для зашифрованных EncryptRanking строк.
+// Контекст задаётся по бюллетеню CombineChoices(rows, RankingBase(m, base))
+func ProveRanking(n *bigint.BigInt, s uint, ranking []int, rows, rs []*bigint.BigInt, base uint, b uint, context *ProofContext) *MultiChoiceProof {
+	messages := RankingMessages(len(ranking), base)
+	proof := &MultiChoiceProof{Choices: make([]*CorrectMessageProof, len(ranking))}
+
+	totalR := bigint.NewBigIntFromInt(1)
+	for place, option := range ranking {
+		proof.Choices[place] = ProveEncrypted(n, s, messages, messages[option], rows[place], rs[place], b, context)
+		totalR = totalR.Mul(rs[place]).Mod(n)
+	}
+
+	total := RankingTotalMessages(len(ranking), base)
+	proof.Total = ProveEncrypted(n, s, total, total[0], ChoicesProduct(n, s, rows), totalR, b, context)
+	return proof
+}
+
+// RankingProof восстанавливает доказательства ранжированного бюллетеня с options вариантами
+// из опубликованной записи
+func (record MultiChoiceRecord) RankingProof(options int, base uint, n *bigint.BigInt, s uint, b uint, votingID, label *bigint.BigInt) (*MultiChoiceProof, error) {
+	if len(record.Choices) != options {
+		return nil, fmt.Errorf("ballot has %d rows for %d options", len(record.Choices), options)
+	}
+	if options < 1 || uint64(options) >= uint64(1)<<base {
+		return nil, fmt.Errorf("%d options do not fit into %d-bit ranking cells", options, base)
+	}
+
+	messages := RankingMessages(options, base)
+	proof := &MultiChoiceProof{Choices: make([]*CorrectMessageProof, options)}
+	rows := make([]*bigint.BigInt, options)
+	for place, row := range record.Choices {
+		if row.Ciphertext == nil {
+			return nil, fmt.Errorf("row %d has no ciphertext", place)
+		}
+		rows[place] = row.Ciphertext
+		proof.Choices[place] = row.Proof.Proof(row.Ciphertext, messages, n, s, b, votingID, label)
+	}
+	proof.Total = record.Total.Proof(ChoicesProduct(n, s, rows), RankingTotalMessages(options, base), n, s, b, votingID, label)
+	return proof, nil
+}
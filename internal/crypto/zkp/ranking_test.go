@@ -0,0 +1,99 @@
+package zkp_test
+
+import (
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/paillier"
+	"ev/internal/crypto/zkp"
+	"sync"
+	"testing"
+)
+
+// Ключ на 512 бит достаточен для проверки доказательств и генерируется быстро
+const testKeyBits = 512
+
+// testChallengeBits — длина челленджа доказательств в тестах
+const testChallengeBits = 128
+
+var (
+	testKeyOnce sync.Once
+	testKeyPair *paillier.PaillierKeyPair
+	testKeyErr  error
+)
+
+func testKey(t *testing.T) *paillier.PaillierKeyPair {
+	t.Helper()
+	testKeyOnce.Do(func() {
+		testKeyPair, testKeyErr = paillier.NewPaillierKeyPair(testKeyBits)
+	})
+	if testKeyErr != nil {
+		t.Fatal(testKeyErr)
+	}
+	return testKeyPair
+}
+
+func testContext(votingID, label int64) *zkp.ProofContext {
+	return &zkp.ProofContext{VotingID: bigint.NewBigIntFromInt(votingID), Label: bigint.NewBigIntFromInt(label)}
+}
+
+func TestRankingProofRoundTrip(t *testing.T) {
+	key := testKey(t)
+	const base = 2
+	ranking := []int{2, 0, 1}
+	context := testContext(3, 11)
+
+	rows, rs := zkp.EncryptRanking(key.N, 1, ranking, base)
+	ballot := zkp.CombineChoices(key.N, 1, rows, zkp.RankingBase(len(ranking), base))
+	proof := zkp.ProveRanking(key.N, 1, ranking, rows, rs, base, testChallengeBits, context)
+
+	restored, err := proof.Record().RankingProof(len(ranking), base, key.N, 1, testChallengeBits, context.VotingID, context.Label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = restored.Verify(ballot, zkp.RankingBase(len(ranking), base)); err != nil {
+		t.Fatalf("valid ranking rejected: %v", err)
+	}
+
+	// Бюллетень шифрует матрицу перестановки: единица в ячейке (место, вариант)
+	m, err := paillier.DecryptDJ(ballot, key.Lambda, key.N, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := bigint.NewBigIntFromInt(0)
+	for place, option := range ranking {
+		expected = expected.Add(bigint.NewBigIntFromInt(1).Lsh(base * uint(place*len(ranking)+option)))
+	}
+	if !m.Eq(expected) {
+		t.Fatalf("ballot decrypts to %s, expected %s", m.ToString(), expected.ToString())
+	}
+
+	if _, err = proof.Record().RankingProof(len(ranking)+1, base, key.N, 1, testChallengeBits, context.VotingID, context.Label); err == nil {
+		t.Error("ranking proof accepted for another number of options")
+	}
+}
+
+func TestRankingProofRejectsRepeatedOption(t *testing.T) {
+	key := testKey(t)
+	const base = 2
+	context := testContext(3, 12)
+
+	rows, rs := zkp.EncryptRanking(key.N, 1, []int{0, 1, 2}, base)
+	proof := zkp.ProveRanking(key.N, 1, []int{0, 1, 2}, rows, rs, base, testChallengeBits, context)
+	record := proof.Record()
+
+	// Вторая строка заменена корректно доказанной строкой варианта 0: каждая строка допустима,
+	// но вариант 0 занимает два места, и доказательство произведения строк не проходит
+	messages := zkp.RankingMessages(3, base)
+	row, r := zkp.Encrypt(key.N, 1, messages[0])
+	rowProof := zkp.ProveEncrypted(key.N, 1, messages, messages[0], row, r, testChallengeBits, context)
+	record.Choices[1] = zkp.ChoiceRecord{Ciphertext: row, Proof: rowProof.Record()}
+	rows[1] = row
+
+	restored, err := record.RankingProof(3, base, key.N, 1, testChallengeBits, context.VotingID, context.Label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ballot := zkp.CombineChoices(key.N, 1, rows, zkp.RankingBase(3, base))
+	if err = restored.Verify(ballot, zkp.RankingBase(3, base)); err == nil {
+		t.Fatal("ranking with a repeated option accepted")
+	}
+}
@@ -0,0 +1,212 @@
+package zkp
+
+import (
+	"errors"
+	"ev/internal/crypto/bigint"
+	"fmt"
+)
+
+// Проверяемое перемешивание шифротекстов (Сако–Килиан, неинтерактивно по Фиату–Шамиру).
+// Выход Y[i] = X[π(i)] · ρ_i^(n^s) mod n^(s+1) — перестановка входов с перешифрованием,
+// π и ρ_i знает только перемешивающий. Для каждого из ShuffleRounds раундов он строит теневое
+// перемешивание Z[j] = X[σ(j)] · τ_j^(n^s) и по биту челленджа раскрывает либо связь Z с входами
+// (σ, τ), либо связь выходов с Z: φ = σ⁻¹∘π и υ_i = ρ_i / τ_φ(i), так что Y[i] = Z[φ(i)] · υ_i^(n^s).
+// Раскрытие одной связи ничего не говорит о π, а неверный выход проходит раунд с вероятностью 1/2.
+// Челлендж считается по входам, выходам и всем теневым перемешиваниям; проверяющий восстанавливает
+// теневые перемешивания по раскрытиям и сверяет челлендж
+
+// ShuffleRounds — число раундов: подделка перемешивания требует перебора порядка 2^ShuffleRounds
+// теневых перемешиваний
+const ShuffleRounds = 40
+
+// ShuffleRound — раскрытие одного раунда. При Challenge = 0 Permutation и Randomness — σ и τ
+// теневого перемешивания, при Challenge = 1 — φ и υ
+type ShuffleRound struct {
+	Challenge   uint             `json:"challenge"`
+	Permutation []int            `json:"permutation"`
+	Randomness  []*bigint.BigInt `json:"randomness"`
+}
+
+// ShuffleRecord — выход перемешивания и доказательство его корректности
+type ShuffleRecord struct {
+	Outputs []*bigint.BigInt `json:"outputs"`
+	Rounds  []ShuffleRound   `json:"rounds"`
+}
+
+// randomUnit возвращает случайный обратимый элемент по модулю n
+func randomUnit(n *bigint.BigInt) *bigint.BigInt {
+	one := bigint.NewBigIntFromInt(1)
+	for {
+		r := randomInRange(bigint.NewBigIntFromInt(2), n)
+		if bigint.GCD(r, n).Eq(one) {
+			return r
+		}
+	}
+}
+
+// randomPermutation возвращает случайную перестановку count элементов (Фишер–Йетс)
+func randomPermutation(count int) []int {
+	permutation := make([]int, count)
+	for i := range permutation {
+		permutation[i] = i
+	}
+	for i := count - 1; i > 0; i-- {
+		j := int(randomInRange(bigint.NewBigIntFromInt(0), bigint.NewBigIntFromInt(int64(i+1))).Int64())
+		permutation[i], permutation[j] = permutation[j], permutation[i]
+	}
+	return permutation
+}
+
+// permute возвращает out[i] = in[permutation[i]] · randomness[i]^(n^s) mod n^(s+1)
+func permute(in []*bigint.BigInt, permutation []int, randomness []*bigint.BigInt, ns, nn *bigint.BigInt) []*bigint.BigInt {
+	out := make([]*bigint.BigInt, len(in))
+	parallelFor(len(in), func(i int) error {
+		out[i] = in[permutation[i]].Mul(randomness[i].ModExp(ns, nn)).Mod(nn)
+		return nil
+	})
+	return out
+}
+
+// shuffleChallenge возвращает биты челленджа по входам, выходам и теневым перемешиваниям
+func shuffleChallenge(n *bigint.BigInt, s uint, votingID *bigint.BigInt, inputs, outputs []*bigint.BigInt, shadows [][]*bigint.BigInt) *bigint.BigInt {
+	values := []*bigint.BigInt{
+		n,
+		bigint.NewBigIntFromUint(uint64(exponent(s))),
+		votingID,
+		bigint.NewBigIntFromInt(int64(len(inputs))),
+	}
+	values = append(values, inputs...)
+	values = append(values, outputs...)
+	for _, shadow := range shadows {
+		values = append(values, shadow...)
+	}
+	return ComputeDigest(values).Mod(bigint.NewBigIntFromInt(1).Lsh(ShuffleRounds))
+}
+
+// Shuffle перемешивает и перешифровывает шифротексты inputs голосования votingID
+// и строит доказательство корректности перемешивания
+func Shuffle(n *bigint.BigInt, s uint, votingID *bigint.BigInt, inputs []*bigint.BigInt) *ShuffleRecord {
+	ns, nn := Moduli(n, s)
+	count := len(inputs)
+
+	randomUnits := func() []*bigint.BigInt {
+		units := make([]*bigint.BigInt, count)
+		for i := range units {
+			units[i] = randomUnit(n)
+		}
+		return units
+	}
+
+	pi, rho := randomPermutation(count), randomUnits()
+	outputs := permute(inputs, pi, rho, ns, nn)
+
+	sigmas := make([][]int, ShuffleRounds)
+	taus := make([][]*bigint.BigInt, ShuffleRounds)
+	shadows := make([][]*bigint.BigInt, ShuffleRounds)
+	for k := range shadows {
+		sigmas[k], taus[k] = randomPermutation(count), randomUnits()
+		shadows[k] = permute(inputs, sigmas[k], taus[k], ns, nn)
+	}
+
+	challenge := shuffleChallenge(n, s, votingID, inputs, outputs, shadows)
+
+	record := &ShuffleRecord{Outputs: outputs, Rounds: make([]ShuffleRound, ShuffleRounds)}
+	for k := range record.Rounds {
+		if challenge.Bit(k) == 0 {
+			record.Rounds[k] = ShuffleRound{Challenge: 0, Permutation: sigmas[k], Randomness: taus[k]}
+			continue
+		}
+
+		inverse := make([]int, count)
+		for j, i := range sigmas[k] {
+			inverse[i] = j
+		}
+		round := ShuffleRound{Challenge: 1, Permutation: make([]int, count), Randomness: make([]*bigint.BigInt, count)}
+		for i := range round.Permutation {
+			j := inverse[pi[i]]
+			tauInv, _ := taus[k][j].ModInverse(n)
+			round.Permutation[i] = j
+			round.Randomness[i] = rho[i].Mul(tauInv).Mod(n)
+		}
+		record.Rounds[k] = round
+	}
+	return record
+}
+
+// checkPermutation проверяет, что permutation — перестановка count элементов
+func checkPermutation(permutation []int, count int) error {
+	if len(permutation) != count {
+		return fmt.Errorf("permutation has %d elements for %d ciphertexts", len(permutation), count)
+	}
+	used := make([]bool, count)
+	for _, i := range permutation {
+		if i < 0 || i >= count || used[i] {
+			return errors.New("permutation is not a bijection")
+		}
+		used[i] = true
+	}
+	return nil
+}
+
+// Verify проверяет, что выходы перемешивания — перешифрованная перестановка inputs
+func (record *ShuffleRecord) Verify(n *bigint.BigInt, s uint, votingID *bigint.BigInt, inputs []*bigint.BigInt) error {
+	ns, nn := Moduli(n, s)
+	count := len(inputs)
+
+	if len(record.Outputs) != count {
+		return fmt.Errorf("shuffle has %d outputs for %d inputs", len(record.Outputs), count)
+	}
+	if len(record.Rounds) != ShuffleRounds {
+		return fmt.Errorf("shuffle has %d rounds, expected %d", len(record.Rounds), ShuffleRounds)
+	}
+	for i, output := range record.Outputs {
+		if output == nil || output.Sign() <= 0 || output.Ge(nn) {
+			return fmt.Errorf("output %d is not a ciphertext", i)
+		}
+	}
+
+	shadows := make([][]*bigint.BigInt, ShuffleRounds)
+	for k, round := range record.Rounds {
+		if err := checkPermutation(round.Permutation, count); err != nil {
+			return fmt.Errorf("round %d: %w", k, err)
+		}
+		if len(round.Randomness) != count {
+			return fmt.Errorf("round %d: %d randomness values for %d ciphertexts", k, len(round.Randomness), count)
+		}
+		for _, r := range round.Randomness {
+			if r == nil || r.Sign() <= 0 || r.Ge(n) {
+				return fmt.Errorf("round %d: randomness is out of range", k)
+			}
+		}
+
+		switch round.Challenge {
+		case 0:
+			shadows[k] = permute(inputs, round.Permutation, round.Randomness, ns, nn)
+		case 1:
+			// Z[φ(i)] = Y[i] · υ_i^(-n^s)
+			shadow := make([]*bigint.BigInt, count)
+			err := parallelFor(count, func(i int) error {
+				inverse, err := round.Randomness[i].ModExp(ns, nn).ModInverse(nn)
+				if err != nil {
+					return fmt.Errorf("round %d: randomness is not invertible", k)
+				}
+				shadow[round.Permutation[i]] = record.Outputs[i].Mul(inverse).Mod(nn)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			shadows[k] = shadow
+		default:
+			return fmt.Errorf("round %d: challenge bit %d", k, round.Challenge)
+		}
+	}
+
+	challenge := shuffleChallenge(n, s, votingID, inputs, record.Outputs, shadows)
+	for k, round := range record.Rounds {
+		if challenge.Bit(k) != round.Challenge {
+			return errors.New("shuffle challenge check failed")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package zkp_test
+
+import (
+	"encoding/json"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/paillier"
+	"ev/internal/crypto/zkp"
+	"sort"
+	"testing"
+)
+
+func shuffleInputs(t *testing.T, n *bigint.BigInt, messages []int64) []*bigint.BigInt {
+	t.Helper()
+	inputs := make([]*bigint.BigInt, len(messages))
+	for i, message := range messages {
+		inputs[i], _ = zkp.Encrypt(n, 1, bigint.NewBigIntFromInt(message))
+	}
+	return inputs
+}
+
+func TestShuffleRoundTrip(t *testing.T) {
+	key := testKey(t)
+	votingID := bigint.NewBigIntFromInt(7)
+	messages := []int64{3, 1, 4, 1, 5}
+	inputs := shuffleInputs(t, key.N, messages)
+
+	record := zkp.Shuffle(key.N, 1, votingID, inputs)
+
+	// Доказательство проверяется и после публикации в JSON
+	jsoned, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var published zkp.ShuffleRecord
+	if err = json.Unmarshal(jsoned, &published); err != nil {
+		t.Fatal(err)
+	}
+	if err = published.Verify(key.N, 1, votingID, inputs); err != nil {
+		t.Fatalf("valid shuffle rejected: %v", err)
+	}
+
+	decrypted := make([]int64, len(published.Outputs))
+	for i, output := range published.Outputs {
+		m, err := paillier.DecryptDJ(output, key.Lambda, key.N, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted[i] = m.Int64()
+	}
+	sort.Slice(decrypted, func(i, j int) bool { return decrypted[i] < decrypted[j] })
+	expected := append([]int64(nil), messages...)
+	sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+	for i := range expected {
+		if decrypted[i] != expected[i] {
+			t.Fatalf("shuffled plaintexts %v, expected %v", decrypted, expected)
+		}
+	}
+}
+
+func TestShuffleRejectsTampering(t *testing.T) {
+	key := testKey(t)
+	votingID := bigint.NewBigIntFromInt(7)
+	inputs := shuffleInputs(t, key.N, []int64{2, 7, 1, 8})
+
+	tampered := func(name string, change func(record *zkp.ShuffleRecord)) {
+		record := zkp.Shuffle(key.N, 1, votingID, inputs)
+		change(record)
+		if err := record.Verify(key.N, 1, votingID, inputs); err == nil {
+			t.Errorf("%s: tampered shuffle accepted", name)
+		}
+	}
+
+	tampered("replaced output", func(record *zkp.ShuffleRecord) {
+		record.Outputs[0], _ = zkp.Encrypt(key.N, 1, bigint.NewBigIntFromInt(9))
+	})
+	tampered("dropped output", func(record *zkp.ShuffleRecord) {
+		record.Outputs = record.Outputs[1:]
+	})
+	tampered("changed randomness", func(record *zkp.ShuffleRecord) {
+		r := record.Rounds[0].Randomness
+		r[0], r[1] = r[1], r[0]
+	})
+	tampered("flipped challenge", func(record *zkp.ShuffleRecord) {
+		record.Rounds[0].Challenge ^= 1
+	})
+
+	record := zkp.Shuffle(key.N, 1, votingID, inputs)
+	if err := record.Verify(key.N, 1, bigint.NewBigIntFromInt(8), inputs); err == nil {
+		t.Error("shuffle accepted for another voting")
+	}
+}
@@ -2,17 +2,23 @@ package handlers
 
 import (
 	"context"
+	"fmt"
+	"math/bits"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"ev/internal/ballotlog"
 	"ev/internal/config"
+	"ev/internal/crypto/zkp"
 	"ev/internal/database"
 	"ev/internal/handlers/render"
 	"ev/internal/logger"
 	"ev/internal/models"
+	"ev/internal/tally"
 
+	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -56,7 +62,7 @@ func ShowAdminPage(w http.ResponseWriter, r *http.Request) {
 	regCtx := context.Background()
 
 	var votings []models.Voting
-	rows, err = regDB.Query(regCtx, "SELECT id, name, question, state, start_time, audit_time, end_time FROM votings")
+	rows, err = regDB.Query(regCtx, "SELECT id, name, question, state, voting_type, max_choices, start_time, audit_time, end_time FROM votings")
 	if err != nil {
 		http.Error(w, "Запрос таблицы голосований не удался: "+err.Error(), http.StatusNotFound)
 		return
@@ -68,7 +74,7 @@ func ShowAdminPage(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var voting models.Voting
-		err = rows.Scan(&voting.ID, &voting.Name, &voting.Question, &voting.State, &voting.StartTime, &voting.AuditTime, &voting.EndTime)
+		err = rows.Scan(&voting.ID, &voting.Name, &voting.Question, &voting.State, &voting.Type, &voting.MaxChoices, &voting.StartTime, &voting.AuditTime, &voting.EndTime)
 		if err != nil {
 			http.Error(w, "Перенос данных из таблицы голосований не удался: "+err.Error(), http.StatusNotFound)
 			return
@@ -141,7 +147,7 @@ func ShowAdminPage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var merklieRoots []models.MerklieRoot
-	rows, err = counterDB.Query(counterCtx, "SELECT id, voting_id, root_value, created_at FROM merklie_roots")
+	rows, err = counterDB.Query(counterCtx, "SELECT id, voting_id, root_value, created_at, tree_version FROM merklie_roots")
 	if err != nil {
 		http.Error(w, "Запрос таблицы MerklieRoot не удался: "+err.Error(), http.StatusNotFound)
 		return
@@ -150,7 +156,7 @@ func ShowAdminPage(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var merklieRoot models.MerklieRoot
-		err = rows.Scan(&merklieRoot.ID, &merklieRoot.VotingID, &merklieRoot.RootValue, &merklieRoot.CreatedAt)
+		err = rows.Scan(&merklieRoot.ID, &merklieRoot.VotingID, &merklieRoot.RootValue, &merklieRoot.CreatedAt, &merklieRoot.TreeVersion)
 		if err != nil {
 			http.Error(w, "Перенос данных из таблицы MerklieRoot не удался: "+err.Error(), http.StatusNotFound)
 			return
@@ -290,9 +296,69 @@ func AddNewVoting(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Тип бюллетеня определяет, сколько вариантов может отметить голосующий
+	votingType := r.FormValue("voting_type")
+	maxChoices := 1
+	switch votingType {
+	case "", models.VotingTypeSingle:
+		votingType = models.VotingTypeSingle
+	case models.VotingTypeApproval:
+		maxChoices = len(cleanOptions)
+	case models.VotingTypeMultiChoice:
+		maxChoices, err = strconv.Atoi(r.FormValue("max_choices"))
+		if err != nil || maxChoices < 1 || maxChoices > len(cleanOptions) {
+			http.Error(w, "Число отмечаемых вариантов должно быть от 1 до числа вариантов ответа", http.StatusBadRequest)
+			return
+		}
+	case models.VotingTypeRanked:
+		maxChoices = len(cleanOptions)
+	case models.VotingTypeCumulative:
+		// max_choices — число баллов, которое голосующий распределяет между вариантами
+		maxChoices, err = strconv.Atoi(r.FormValue("max_choices"))
+		if err != nil || maxChoices < 1 || maxChoices > zkp.MaxPoints {
+			http.Error(w, fmt.Sprintf("Число баллов должно быть от 1 до %d", zkp.MaxPoints), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Неизвестный тип голосования", http.StatusBadRequest)
+		return
+	}
+
+	// Список голосующих с весом; не попавшие в список голосуют с весом 1
+	voterWeights, err := parseVoterWeights(r.FormValue("voter_weights"))
+	if err != nil {
+		http.Error(w, "Некорректный список весов голосующих: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+
+	// Размер счетчика варианта подбирается по суммарному весу голосующих: счетчик должен вместить
+	// голоса всех бюллетеней, а с распределением баллов — все баллы всех бюллетеней
+	totalWeight, message, err := eligibleWeight(ctx, voterWeights)
+	if err != nil {
+		log.Error().Err(err).Msg("error counting eligible voters")
+		status := http.StatusInternalServerError
+		if message != "" {
+			status = http.StatusBadRequest
+		} else {
+			message = "Ошибка при подсчете голосующих"
+		}
+		http.Error(w, message, status)
+		return
+	}
+	maxCount, err := tally.MaxCount(votingType, maxChoices, totalWeight)
+	if err != nil {
+		http.Error(w, "Суммарный вес голосующих не помещается в счетчик варианта", http.StatusBadRequest)
+		return
+	}
+	base := tally.SizeBase(maxCount)
+	if votingType == models.VotingTypeRanked {
+		// Ранжированные бюллетени не суммируются: base — размер ячейки матрицы перестановки
+		base = tally.RankBase(len(cleanOptions))
+	}
+
 	// Получаем соединение с БД
 	db := database.GetREGPGConnection()
-	ctx := context.Background()
 
 	// Начинаем транзакцию
 	tx, err := db.Begin(ctx)
@@ -305,14 +371,24 @@ func AddNewVoting(w http.ResponseWriter, r *http.Request) {
 	// Создаем новое голосование
 	var votingID int
 	err = tx.QueryRow(ctx,
-		"INSERT INTO votings (name, question, state, start_time, audit_time, end_time) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
-		name, description, 0, startTime, auditTime, endTime,
+		"INSERT INTO votings (name, question, state, voting_type, max_choices, base, start_time, audit_time, end_time) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
+		name, description, 0, votingType, maxChoices, base, startTime, auditTime, endTime,
 	).Scan(&votingID)
 	if err != nil {
 		http.Error(w, "Ошибка при создании голосования", http.StatusInternalServerError)
 		return
 	}
 
+	// Если ключи голосования уже сгенерированы, счетчики всех вариантов должны поместиться
+	// в открытый текст Paillier; иначе это проверит CheckVotingCapacity при загрузке ключей
+	if params, exists := config.CryptoParams[strconv.Itoa(votingID)]; exists && params.Paillier.N != nil {
+		if err = tally.CheckCapacity(votingType, len(cleanOptions), base, tally.PlaintextBits(params.Paillier.N, params.S())); err != nil {
+			log.Error().Err(err).Int("voting_id", votingID).Msg("counters do not fit into the Paillier modulus")
+			http.Error(w, fmt.Sprintf("Ключ голосования слишком мал: %d вариантов со счетчиками по %d бит", len(cleanOptions), base), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Добавляем варианты ответов
 	for optionIndex, optionName := range cleanOptions {
 		_, err = tx.Exec(ctx,
@@ -326,6 +402,28 @@ func AddNewVoting(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Веса голосующих хранятся в БД IDP, где они попадают в учетные данные TempID. Они фиксируются
+	// до голосования: веса без голосования не используются, а голосование без весов
+	// приняло бы бюллетени этих голосующих с весом 1
+	if len(voterWeights) > 0 {
+		idpTx, err := database.GetIDPPGConnection().Begin(ctx)
+		if err != nil {
+			http.Error(w, "Ошибка при создании транзакции", http.StatusInternalServerError)
+			return
+		}
+		defer idpTx.Rollback(ctx)
+
+		if err = saveVoterWeights(ctx, idpTx, votingID, voterWeights); err != nil {
+			log.Error().Err(err).Msg("error adding voter weights")
+			http.Error(w, "Ошибка при добавлении весов голосующих: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err = idpTx.Commit(ctx); err != nil {
+			http.Error(w, "Ошибка при сохранении весов голосующих", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Подтверждаем транзакцию
 	err = tx.Commit(ctx)
 	if err != nil {
@@ -346,8 +444,8 @@ func AddNewVoting(w http.ResponseWriter, r *http.Request) {
 
 	// Создаем новое голосование
 	err = tx.QueryRow(ctx,
-		"INSERT INTO votings (name, question, state, start_time, audit_time, end_time) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
-		name, description, 0, startTime, auditTime, endTime,
+		"INSERT INTO votings (name, question, state, voting_type, max_choices, base, start_time, audit_time, end_time) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
+		name, description, 0, votingType, maxChoices, base, startTime, auditTime, endTime,
 	).Scan(&votingID)
 	if err != nil {
 		http.Error(w, "Ошибка при создании голосования", http.StatusInternalServerError)
@@ -378,6 +476,108 @@ func AddNewVoting(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
 }
 
+// parseVoterWeights разбирает список весов голосующих: строки «логин вес»
+func parseVoterWeights(text string) (map[string]uint64, error) {
+	weights := make(map[string]uint64)
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("строка %q должна содержать логин и вес", strings.TrimSpace(line))
+		}
+		weight, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil || weight < 1 {
+			return nil, fmt.Errorf("вес %q голосующего %s должен быть натуральным числом", fields[1], fields[0])
+		}
+		weights[fields[0]] = weight
+	}
+	return weights, nil
+}
+
+// eligibleWeight возвращает суммарный вес голосующих: пользователи IDP голосуют с весом 1,
+// если список весов не задаёт другой. Вместе с ошибкой в списке весов возвращается сообщение
+// для администратора
+func eligibleWeight(ctx context.Context, weights map[string]uint64) (uint64, string, error) {
+	idpDB := database.GetIDPPGConnection()
+
+	var users int64
+	if err := idpDB.QueryRow(ctx, "SELECT COUNT(*) FROM users").Scan(&users); err != nil {
+		return 0, "", err
+	}
+
+	total := uint64(users)
+	for login, weight := range weights {
+		var exists bool
+		err := idpDB.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE login = $1)", login).Scan(&exists)
+		if err != nil {
+			return 0, "", err
+		}
+		if !exists {
+			return 0, "Пользователь " + login + " из списка весов не найден", fmt.Errorf("unknown voter %q", login)
+		}
+		var carry uint64
+		total, carry = bits.Add64(total, weight-1, 0)
+		if carry != 0 {
+			return 0, "Суммарный вес голосующих слишком велик", fmt.Errorf("total weight overflows at voter %q", login)
+		}
+	}
+	return total, "", nil
+}
+
+// saveVoterWeights сохраняет веса голосующих голосования в транзакции tx БД IDP
+func saveVoterWeights(ctx context.Context, tx pgx.Tx, votingID int, weights map[string]uint64) error {
+	for login, weight := range weights {
+		tag, err := tx.Exec(ctx,
+			"INSERT INTO voter_weights (user_id, voting_id, weight) SELECT id, $2, $3 FROM users WHERE login = $1",
+			login, votingID, int64(weight),
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("пользователь %s не найден", login)
+		}
+	}
+	return nil
+}
+
+// CheckVotingCapacity проверяет, что ключ каждого голосования из crypto.json вмещает его счетчики.
+// При создании голосования ключей обычно ещё нет, поэтому проверка повторяется при их загрузке
+func CheckVotingCapacity(ctx context.Context) error {
+	db := database.GetCounterPGConnection()
+	rows, err := db.Query(ctx,
+		"SELECT v.id, v.voting_type, v.base, COUNT(o.option_index) FROM votings v "+
+			"JOIN voting_options o ON o.voting_id = v.id GROUP BY v.id, v.voting_type, v.base ORDER BY v.id",
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var votingID, base, options int
+		var votingType string
+		if err = rows.Scan(&votingID, &votingType, &base, &options); err != nil {
+			return err
+		}
+		params, exists := config.CryptoParams[strconv.Itoa(votingID)]
+		if !exists || params.Paillier.N == nil {
+			continue
+		}
+		// У голосований, созданных до подбора размера, счетчик задан в crypto.json
+		counterBits := uint(base)
+		if base == 0 {
+			counterBits = params.Base
+		}
+		if err = tally.CheckCapacity(votingType, options, counterBits, tally.PlaintextBits(params.Paillier.N, params.S())); err != nil {
+			return fmt.Errorf("voting %d: %w", votingID, err)
+		}
+	}
+	return rows.Err()
+}
+
 func DeleteUser(w http.ResponseWriter, r *http.Request, userID string) {
 	log := logger.GetLogger()
 	log.Info().Msg("requested delete user")
@@ -448,7 +648,7 @@ func DeleteVoting(w http.ResponseWriter, r *http.Request, votingID string) {
 	defer regTx.Rollback(ctx)
 
 	// Удаляем временные ID, связанные с голосованием
-	_, err = regTx.Exec(ctx, "DELETE FROM tempIDs WHERE id IN (SELECT id FROM tempIDs WHERE temp_id LIKE $1 || '%')", votingID)
+	_, err = regTx.Exec(ctx, "DELETE FROM tempIDs WHERE voting_id = $1", votingID)
 	if err != nil {
 		log.Error().Err(err).Msg("error deleting temp IDs")
 		http.Error(w, "Ошибка при удалении временных ID", http.StatusInternalServerError)
@@ -495,6 +695,57 @@ func DeleteVoting(w http.ResponseWriter, r *http.Request, votingID string) {
 		return
 	}
 
+	// Удаляем реестр использованных учетных данных
+	_, err = counterTx.Exec(ctx, "DELETE FROM spent_credentials WHERE voting_id = $1", votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("error deleting spent credentials")
+		http.Error(w, "Ошибка при удалении использованных учетных данных", http.StatusInternalServerError)
+		return
+	}
+
+	// Удаляем частичные расшифрования доверенных лиц
+	_, err = counterTx.Exec(ctx, "DELETE FROM partial_decryptions WHERE voting_id = $1", votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("error deleting partial decryptions")
+		http.Error(w, "Ошибка при удалении частичных расшифрований", http.StatusInternalServerError)
+		return
+	}
+
+	// Удаляем перемешивания ранжированных бюллетеней
+	_, err = counterTx.Exec(ctx, "DELETE FROM shuffles WHERE voting_id = $1", votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("error deleting shuffles")
+		http.Error(w, "Ошибка при удалении перемешиваний бюллетеней", http.StatusInternalServerError)
+		return
+	}
+
+	// Удаляем журнал бюллетеней
+	_, err = counterTx.Exec(ctx, "DELETE FROM ballot_log WHERE voting_id = $1", votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("error deleting ballot log")
+		http.Error(w, "Ошибка при удалении журнала бюллетеней", http.StatusInternalServerError)
+		return
+	}
+
+	// Удаляем записи переголосований
+	_, err = counterTx.Exec(ctx, "DELETE FROM revotes WHERE voting_id = $1", votingID)
+	if err == nil {
+		_, err = counterTx.Exec(ctx, "DELETE FROM public_revotes WHERE voting_id = $1", votingID)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("error deleting revotes")
+		http.Error(w, "Ошибка при удалении записей переголосований", http.StatusInternalServerError)
+		return
+	}
+
+	// Удаляем сохранённое дерево журнала
+	_, err = counterTx.Exec(ctx, "DELETE FROM merklie_tree_states WHERE voting_id = $1", votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("error deleting merklie tree state")
+		http.Error(w, "Ошибка при удалении дерева журнала бюллетеней", http.StatusInternalServerError)
+		return
+	}
+
 	// Удаляем корни Меркла
 	_, err = counterTx.Exec(ctx, "DELETE FROM merklie_roots WHERE voting_id = $1", votingID)
 	if err != nil {
@@ -525,6 +776,15 @@ func DeleteVoting(w http.ResponseWriter, r *http.Request, votingID string) {
 		http.Error(w, "Ошибка при сохранении изменений в БД подсчета", http.StatusInternalServerError)
 		return
 	}
+	ballotlog.ForgetTree(votingID)
+
+	// Удаляем веса голосующих из БД IDP
+	_, err = database.GetIDPPGConnection().Exec(ctx, "DELETE FROM voter_weights WHERE voting_id = $1", votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("error deleting voter weights")
+		http.Error(w, "Ошибка при удалении весов голосующих", http.StatusInternalServerError)
+		return
+	}
 
 	// Перенаправляем на страницу администратора
 	http.Redirect(w, r, "/admin", http.StatusSeeOther)
@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"ev/internal/ballotlog"
+	"ev/internal/config"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/merklie"
+	"ev/internal/database"
+	"ev/internal/logger"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Публичный API для наблюдателей: /api/v1/votings/{id}/{resource}.
+// Доказательство включения бюллетеня: /api/v1/votings/{id}/ballots/{label}/proof
+
+type APIErrorData struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	// Code — машиночитаемый код ошибки для клиентов API
+	Code string `json:"code,omitempty"`
+}
+
+// Коды ошибок API
+const (
+	apiErrorInvalidLabel       = "invalid_label"
+	apiErrorBallotNotPublished = "ballot_not_published"
+	apiErrorProofMismatch      = "proof_mismatch"
+	apiErrorInternal           = "internal_error"
+)
+
+type APIRootData struct {
+	ID          int64     `json:"id"`
+	RootValue   string    `json:"root_value"`
+	TreeVersion int       `json:"tree_version"`
+	TreeSize    *int      `json:"tree_size"`
+	CreatedAt   time.Time `json:"created_at"`
+	SignedAt    *int64    `json:"signed_at"`
+	Signature   *string   `json:"signature"`
+	// Корни деревьев, упорядоченных по метке; отсутствуют у корней без журнала
+	BoardRoot      *string `json:"board_root"`
+	BoardSize      *int    `json:"board_size"`
+	RevocationRoot *string `json:"revocation_root"`
+}
+
+type APIRevoteData struct {
+	OldLabel    string    `json:"old_label"`
+	OldNonce    string    `json:"old_nonce"`
+	NewLabel    string    `json:"new_label"`
+	CreatedAt   time.Time `json:"created_at"`
+	MovedIntoAt time.Time `json:"moved_into_at"`
+}
+
+// APIRevocationData доказывает, что бюллетень Label заменён переголосованием:
+// Absence — отсутствие метки на доске, Revocations — цепочка записей замен от Label
+// до действующей метки, Replacement — присутствие действующей метки на доске
+type APIRevocationData struct {
+	Root        APIRootData                `json:"root"`
+	Label       string                     `json:"label"`
+	Absence     *merklie.NonInclusionProof `json:"absence"`
+	Revocations []*merklie.SortedProof     `json:"revocations"`
+	Replacement *merklie.SortedProof       `json:"replacement"`
+}
+
+type APITreeHeadKeyData struct {
+	PublicKey string `json:"public_key"`
+}
+
+type APIConsistencyData struct {
+	First  APIRootData `json:"first"`
+	Second APIRootData `json:"second"`
+	Proof  []string    `json:"proof"`
+}
+
+type APILogEntryData struct {
+	LogIndex      int       `json:"log_index"`
+	Label         string    `json:"label"`
+	EncryptedVote string    `json:"encrypted_vote"`
+	ZKPProof      string    `json:"zkp_proof"`
+	Signature     string    `json:"signature"`
+	Weight        uint64    `json:"weight"`
+	CreatedAt     time.Time `json:"created_at"`
+	ReplacedBy    *int      `json:"replaced_by"`
+}
+
+// errRootNotFound — корень не найден или принадлежит другому голосованию
+var errRootNotFound = errors.New("merkle root not found")
+
+// writeAPIResponse отправляет ответ API в формате JSON
+func writeAPIResponse(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log := logger.GetLogger()
+		log.Error().Err(err).Msg("Error sending response")
+	}
+}
+
+// writeAPIError отправляет ошибку API в формате JSON
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIResponse(w, status, APIErrorData{Success: false, Message: message})
+}
+
+// writeAPIErrorCode отправляет ошибку API с машиночитаемым кодом
+func writeAPIErrorCode(w http.ResponseWriter, status int, code, message string) {
+	writeAPIResponse(w, status, APIErrorData{Success: false, Message: message, Code: code})
+}
+
+// VotingAPI разбирает ресурс голосования и передаёт запрос соответствующему обработчику
+func VotingAPI(w http.ResponseWriter, r *http.Request, votingID, resource string) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "Метод не поддерживается")
+		return
+	}
+	if _, err := strconv.Atoi(votingID); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Неверный идентификатор голосования")
+		return
+	}
+
+	// Метка бюллетеня — base64 и может содержать '/', поэтому путь разбирается по префиксу и суффиксу
+	if strings.HasPrefix(resource, "ballots/") && strings.HasSuffix(resource, "/proof") {
+		label := strings.TrimSuffix(strings.TrimPrefix(resource, "ballots/"), "/proof")
+		GetBallotProof(w, r, votingID, bigint.AddBase64Padding(label))
+		return
+	}
+
+	switch resource {
+	case "roots":
+		GetMerklieRoots(w, r, votingID)
+	case "consistency":
+		GetConsistencyProof(w, r, votingID)
+	case "log":
+		GetBallotLog(w, r, votingID)
+	case "revocation":
+		GetRevocationProof(w, r, votingID)
+	case "revotes":
+		GetRevotes(w, r, votingID)
+	default:
+		writeAPIError(w, http.StatusNotFound, "Ресурс не найден")
+	}
+}
+
+// apiRootColumns — столбцы merklie_roots в порядке полей APIRootData (см. scanRoot)
+const apiRootColumns = "id, root_value, tree_version, tree_size, created_at, signed_at, signature, board_root, board_size, revocation_root"
+
+// scanRoot читает строку со столбцами apiRootColumns
+func scanRoot(row pgx.Row) (APIRootData, error) {
+	var root APIRootData
+	err := row.Scan(&root.ID, &root.RootValue, &root.TreeVersion, &root.TreeSize, &root.CreatedAt, &root.SignedAt, &root.Signature, &root.BoardRoot, &root.BoardSize, &root.RevocationRoot)
+	return root, err
+}
+
+// loadRoot возвращает опубликованный корень голосования по идентификатору
+func loadRoot(ctx context.Context, db *pgxpool.Pool, votingID string, rootID int64) (APIRootData, error) {
+	root, err := scanRoot(db.QueryRow(ctx,
+		"SELECT "+apiRootColumns+" FROM merklie_roots WHERE voting_id = $1 AND id = $2",
+		votingID,
+		rootID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return root, errRootNotFound
+	}
+	return root, err
+}
+
+// GetTreeHeadKey отдаёт открытый ключ Счетчика, которым подписываются опубликованные корни
+func GetTreeHeadKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "Метод не поддерживается")
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, APITreeHeadKeyData{PublicKey: config.Config.TreeHead.PublicKey})
+}
+
+// GetMerklieRoots отдаёт все опубликованные корни голосования в порядке публикации
+func GetMerklieRoots(w http.ResponseWriter, r *http.Request, votingID string) {
+	log := logger.GetLogger()
+	log.Info().Str("voting_id", votingID).Msg("Requested merklie roots")
+
+	db := database.GetCounterPGConnection()
+	ctx := context.Background()
+
+	rows, err := db.Query(ctx, "SELECT "+apiRootColumns+" FROM merklie_roots WHERE voting_id = $1 ORDER BY id", votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting merklie roots")
+		writeAPIError(w, http.StatusInternalServerError, "Ошибка при получении корней")
+		return
+	}
+	defer rows.Close()
+
+	roots := []APIRootData{}
+	for rows.Next() {
+		root, err := scanRoot(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("Error scanning merklie roots")
+			writeAPIError(w, http.StatusInternalServerError, "Ошибка при получении корней")
+			return
+		}
+		roots = append(roots, root)
+	}
+
+	writeAPIResponse(w, http.StatusOK, roots)
+}
+
+// GetConsistencyProof доказывает, что журнал под корнем second продолжает журнал под корнем first.
+// Параметры запроса first и second — идентификаторы корней
+func GetConsistencyProof(w http.ResponseWriter, r *http.Request, votingID string) {
+	log := logger.GetLogger()
+	log.Info().Str("voting_id", votingID).Msg("Requested consistency proof")
+
+	firstID, err := strconv.ParseInt(r.URL.Query().Get("first"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Неверный идентификатор первого корня")
+		return
+	}
+	secondID, err := strconv.ParseInt(r.URL.Query().Get("second"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Неверный идентификатор второго корня")
+		return
+	}
+
+	db := database.GetCounterPGConnection()
+	ctx := context.Background()
+
+	first, err := loadRoot(ctx, db, votingID, firstID)
+	if err == nil {
+		var second APIRootData
+		second, err = loadRoot(ctx, db, votingID, secondID)
+		if err == nil {
+			writeConsistencyProof(ctx, w, db, votingID, first, second)
+			return
+		}
+	}
+	if errors.Is(err, errRootNotFound) {
+		writeAPIError(w, http.StatusNotFound, "Корень не найден")
+		return
+	}
+	log.Error().Err(err).Msg("Error getting merklie root")
+	writeAPIError(w, http.StatusInternalServerError, "Ошибка при получении корня")
+}
+
+// writeConsistencyProof строит доказательство согласованности двух корней журнала
+func writeConsistencyProof(ctx context.Context, w http.ResponseWriter, db *pgxpool.Pool, votingID string, first, second APIRootData) {
+	log := logger.GetLogger()
+
+	// Корни, построенные до появления журнала, не связаны между собой
+	if first.TreeSize == nil || second.TreeSize == nil || first.TreeVersion != merklie.TreeVersion2 || second.TreeVersion != merklie.TreeVersion2 {
+		writeAPIError(w, http.StatusConflict, "Корень построен не над журналом бюллетеней")
+		return
+	}
+	if *first.TreeSize > *second.TreeSize {
+		writeAPIError(w, http.StatusBadRequest, "Первый корень должен быть построен над более коротким журналом")
+		return
+	}
+
+	var proof []string
+	var errLogMismatch = errors.New("ballot log does not match published root")
+	err := ballotlog.WithTree(ctx, db, votingID, func(merkleTree *merklie.MerkleTree) error {
+		for _, root := range []APIRootData{first, second} {
+			rootValue, err := merkleTree.RootAt(*root.TreeSize)
+			if err != nil {
+				return err
+			}
+			if rootValue != root.RootValue {
+				log.Error().Int64("root_id", root.ID).Msg("Ballot log does not match published root")
+				return errLogMismatch
+			}
+		}
+
+		var err error
+		proof, err = merkleTree.ConsistencyProofAt(*first.TreeSize, *second.TreeSize)
+		return err
+	})
+	if errors.Is(err, errLogMismatch) {
+		writeAPIError(w, http.StatusInternalServerError, "Журнал бюллетеней не соответствует опубликованному корню")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error building consistency proof")
+		writeAPIError(w, http.StatusInternalServerError, "Ошибка при построении доказательства")
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIConsistencyData{First: first, Second: second, Proof: proof})
+}
+
+// Размер страницы журнала бюллетеней: записи содержат шифротексты и доказательства,
+// поэтому журнал отдаётся по частям
+const (
+	ballotLogDefaultPage = 100
+	ballotLogMaxPage     = 1000
+)
+
+// GetBallotLog отдаёт записи журнала бюллетеней с номерами [start, end).
+// По умолчанию end = start + ballotLogDefaultPage, диапазон не длиннее ballotLogMaxPage и
+// ограничен tree_size последнего опубликованного корня: записи после него нельзя сверить
+// с подписанным корнем. Параметр unpublished=true снимает ограничение по корню
+func GetBallotLog(w http.ResponseWriter, r *http.Request, votingID string) {
+	log := logger.GetLogger()
+	log.Info().Str("voting_id", votingID).Msg("Requested ballot log")
+
+	start, end := 0, -1
+	var err error
+	if value := r.URL.Query().Get("start"); value != "" {
+		if start, err = strconv.Atoi(value); err != nil || start < 0 {
+			writeAPIError(w, http.StatusBadRequest, "Неверное начало диапазона")
+			return
+		}
+	}
+	if value := r.URL.Query().Get("end"); value != "" {
+		if end, err = strconv.Atoi(value); err != nil || end < start {
+			writeAPIError(w, http.StatusBadRequest, "Неверный конец диапазона")
+			return
+		}
+	}
+	unpublished := false
+	if value := r.URL.Query().Get("unpublished"); value != "" {
+		if unpublished, err = strconv.ParseBool(value); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Неверное значение unpublished")
+			return
+		}
+	}
+
+	if end < 0 {
+		end = start + ballotLogDefaultPage
+	}
+	end = min(end, start+ballotLogMaxPage)
+
+	db := database.GetCounterPGConnection()
+
+	if !unpublished {
+		var publishedSize int
+		err = db.QueryRow(context.Background(),
+			"SELECT COALESCE(MAX(tree_size), 0) FROM merklie_roots WHERE voting_id = $1",
+			votingID,
+		).Scan(&publishedSize)
+		if err != nil {
+			log.Error().Err(err).Msg("Error getting published tree size")
+			writeAPIError(w, http.StatusInternalServerError, "Ошибка при получении журнала бюллетеней")
+			return
+		}
+		end = max(min(end, publishedSize), start)
+	}
+
+	rows, err := db.Query(context.Background(),
+		"SELECT log_index, label, encrypted_vote, zkp_proof, signature, weight, created_at, replaced_by FROM ballot_log WHERE voting_id = $1 AND log_index >= $2 AND log_index < $3 ORDER BY log_index",
+		votingID,
+		start,
+		end,
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting ballot log")
+		writeAPIError(w, http.StatusInternalServerError, "Ошибка при получении журнала бюллетеней")
+		return
+	}
+	defer rows.Close()
+
+	entries := []APILogEntryData{}
+	for rows.Next() {
+		var entry APILogEntryData
+		if err = rows.Scan(&entry.LogIndex, &entry.Label, &entry.EncryptedVote, &entry.ZKPProof, &entry.Signature, &entry.Weight, &entry.CreatedAt, &entry.ReplacedBy); err != nil {
+			log.Error().Err(err).Msg("Error scanning ballot log")
+			writeAPIError(w, http.StatusInternalServerError, "Ошибка при получении журнала бюллетеней")
+			return
+		}
+		entries = append(entries, entry)
+	}
+
+	writeAPIResponse(w, http.StatusOK, entries)
+}
+
+// GetRevocationProof доказывает, что бюллетень с меткой label заменён переголосованием.
+// Параметр root — идентификатор корня; по умолчанию берётся последний корень с доской
+func GetRevocationProof(w http.ResponseWriter, r *http.Request, votingID string) {
+	log := logger.GetLogger()
+	log.Info().Str("voting_id", votingID).Msg("Requested revocation proof")
+
+	label := r.URL.Query().Get("label")
+	if label == "" {
+		writeAPIError(w, http.StatusBadRequest, "Не указана метка бюллетеня")
+		return
+	}
+
+	db := database.GetCounterPGConnection()
+	ctx := context.Background()
+
+	var root APIRootData
+	var err error
+	if value := r.URL.Query().Get("root"); value != "" {
+		rootID, parseErr := strconv.ParseInt(value, 10, 64)
+		if parseErr != nil {
+			writeAPIError(w, http.StatusBadRequest, "Неверный идентификатор корня")
+			return
+		}
+		root, err = loadRoot(ctx, db, votingID, rootID)
+	} else {
+		root, err = scanRoot(db.QueryRow(ctx,
+			"SELECT "+apiRootColumns+" FROM merklie_roots WHERE voting_id = $1 AND board_root IS NOT NULL ORDER BY id DESC LIMIT 1",
+			votingID,
+		))
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = errRootNotFound
+		}
+	}
+	if errors.Is(err, errRootNotFound) {
+		writeAPIError(w, http.StatusNotFound, "Корень не найден")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting merklie root")
+		writeAPIError(w, http.StatusInternalServerError, "Ошибка при получении корня")
+		return
+	}
+	if root.TreeSize == nil || root.BoardRoot == nil || root.BoardSize == nil || root.RevocationRoot == nil {
+		writeAPIError(w, http.StatusConflict, "Для корня не опубликована доска бюллетеней")
+		return
+	}
+
+	board, revocations, err := ballotlog.LoadBoards(ctx, db, votingID, *root.TreeSize)
+	if err != nil {
+		log.Error().Err(err).Msg("Error building ballot boards")
+		writeAPIError(w, http.StatusInternalServerError, "Ошибка при построении доказательства")
+		return
+	}
+	if board.Root() != *root.BoardRoot || board.Size() != *root.BoardSize || revocations.Root() != *root.RevocationRoot {
+		log.Error().Int64("root_id", root.ID).Msg("Ballot log does not match published board")
+		writeAPIError(w, http.StatusInternalServerError, "Журнал бюллетеней не соответствует опубликованной доске")
+		return
+	}
+
+	data := APIRevocationData{Root: root, Label: label, Revocations: []*merklie.SortedProof{}}
+	data.Absence, err = board.NonInclusionProof(label)
+	if errors.Is(err, merklie.ErrKeyPresent) {
+		writeAPIError(w, http.StatusConflict, "Бюллетень не заменен и находится на доске")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error building non-inclusion proof")
+		writeAPIError(w, http.StatusInternalServerError, "Ошибка при построении доказательства")
+		return
+	}
+
+	// Бюллетень мог заменяться несколько раз: идём по записям замен до действующей метки.
+	// Каждая метка заменяется не более одного раза, поэтому цепочка не длиннее числа записей
+	current := label
+	for data.Replacement == nil && len(data.Revocations) < revocations.Size() {
+		revocation, err := revocations.InclusionProof(current)
+		if err != nil {
+			break
+		}
+		data.Revocations = append(data.Revocations, revocation)
+		current = revocation.Leaf.Value
+
+		data.Replacement, err = board.InclusionProof(current)
+		if err != nil && !errors.Is(err, merklie.ErrKeyNotFound) {
+			log.Error().Err(err).Msg("Error building inclusion proof")
+			writeAPIError(w, http.StatusInternalServerError, "Ошибка при построении доказательства")
+			return
+		}
+	}
+	if len(data.Revocations) == 0 {
+		writeAPIError(w, http.StatusNotFound, "Метка не найдена среди замененных бюллетеней")
+		return
+	}
+	if data.Replacement == nil {
+		log.Error().Str("label", label).Msg("Revocation chain does not end on the board")
+		writeAPIError(w, http.StatusInternalServerError, "Цепочка замен не заканчивается на доске")
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, data)
+}
+
+// GetRevotes отдаёт опубликованные записи переголосований. По раскрытому nonce любой может проверить,
+// что метка замененного бюллетеня равна ComputeDigest(nonce, зашифрованный голос)
+func GetRevotes(w http.ResponseWriter, r *http.Request, votingID string) {
+	log := logger.GetLogger()
+	log.Info().Str("voting_id", votingID).Msg("Requested revotes")
+
+	db := database.GetCounterPGConnection()
+	rows, err := db.Query(context.Background(),
+		"SELECT old_label, old_nonce, new_label, created_at, moved_into_at FROM public_revotes WHERE voting_id = $1 ORDER BY created_at",
+		votingID,
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting revotes")
+		writeAPIError(w, http.StatusInternalServerError, "Ошибка при получении записей переголосований")
+		return
+	}
+	defer rows.Close()
+
+	revotes := []APIRevoteData{}
+	for rows.Next() {
+		var revote APIRevoteData
+		if err = rows.Scan(&revote.OldLabel, &revote.OldNonce, &revote.NewLabel, &revote.CreatedAt, &revote.MovedIntoAt); err != nil {
+			log.Error().Err(err).Msg("Error scanning revotes")
+			writeAPIError(w, http.StatusInternalServerError, "Ошибка при получении записей переголосований")
+			return
+		}
+		revotes = append(revotes, revote)
+	}
+
+	writeAPIResponse(w, http.StatusOK, revotes)
+}
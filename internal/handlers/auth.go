@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"html/template"
 	"net/http"
 	"net/url"
@@ -17,6 +18,7 @@ import (
 	"ev/internal/utils"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -426,7 +428,7 @@ func GetUserInfo(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
-// GetTempID возвращает временный ID пользователя на основе токена
+// GetTempID возвращает псевдонимы пользователя для голосования voting_id
 func GetTempID(w http.ResponseWriter, r *http.Request) {
 	log := logger.GetLogger()
 
@@ -439,15 +441,70 @@ func GetTempID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Получаем временный ID из токена
-	tempID, err := utils.GetTempIDFromToken(token)
+	votingID := r.URL.Query().Get("voting_id")
+	if votingID == "" {
+		http.Error(w, "voting_id is required", http.StatusBadRequest)
+		return
+	}
+
+	// Получаем временные ID для голосования
+	tempIDs, err := utils.GetTempIDsFromToken(token, votingID)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get temp ID from token")
 		http.Error(w, "Failed to get temp ID", http.StatusInternalServerError)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{
-		"temp_id": tempID,
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"temp_id":  tempIDs[0],
+		"temp_ids": tempIDs,
 	})
 }
+
+// IssueTempIDCredential выдаёт голосующему подписанный IDP TempID для голосования voting_id.
+// Голосующий передаёт его Регистратору, который проверяет подпись без обращения к IDP
+func IssueTempIDCredential(w http.ResponseWriter, r *http.Request) {
+	log := logger.GetLogger()
+
+	log.Info().Msg("Requested temp ID credential")
+
+	// Получаем и проверяем токен
+	token := extractAndValidateToken(r)
+	if token == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	votingID := r.URL.Query().Get("voting_id")
+	if votingID == "" {
+		http.Error(w, "voting_id is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := utils.GetUserIDFromToken(token)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user ID from token")
+		http.Error(w, "Failed to issue temp ID credential", http.StatusInternalServerError)
+		return
+	}
+
+	// Вес голосующего берётся из списка голосования; голосующий не из списка голосует с весом 1
+	weight := uint64(1)
+	db := database.GetIDPPGConnection()
+	err = db.QueryRow(r.Context(), "SELECT weight FROM voter_weights WHERE user_id = $1 AND voting_id = $2", userID, votingID).Scan(&weight)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Error().Err(err).Msg("Failed to get voter weight")
+		http.Error(w, "Failed to issue temp ID credential", http.StatusInternalServerError)
+		return
+	}
+
+	credential, err := utils.IssueTempIDCredential(token, votingID, weight)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to issue temp ID credential")
+		http.Error(w, "Failed to issue temp ID credential", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(credential)
+}
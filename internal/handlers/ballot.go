@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"ev/internal/config"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/zkp"
+	"ev/internal/models"
+	"ev/internal/tally"
+	"fmt"
+	"math/bits"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Проверка доказательств допустимости бюллетеня при приёме голоса.
+// Функции возвращают сообщение для голосующего вместе с ошибкой для журнала
+
+// BallotChoiceData — шифротекст отметки одного варианта и доказательство, что он шифрует 0 или 1
+type BallotChoiceData struct {
+	Ciphertext   string   `json:"ciphertext"`
+	ZKPProofEVec []string `json:"zkp_proof_e_vec"`
+	ZKPProofZVec []string `json:"zkp_proof_z_vec"`
+	ZKPProofAVec []string `json:"zkp_proof_a_vec"`
+}
+
+// loadVotingType возвращает тип бюллетеня голосования и число вариантов, которое можно отметить
+func loadVotingType(ctx context.Context, db *pgxpool.Pool, votingID interface{}) (string, int, error) {
+	var votingType string
+	var maxChoices int
+	err := db.QueryRow(ctx, "SELECT voting_type, max_choices FROM votings WHERE id = $1", votingID).Scan(&votingType, &maxChoices)
+	return votingType, maxChoices, err
+}
+
+// loadVotingBase возвращает размер счетчика варианта голосования в битах.
+// У голосований, созданных до подбора размера, он берётся из crypto.json
+func loadVotingBase(ctx context.Context, db *pgxpool.Pool, votingID interface{}) (uint, error) {
+	var base int
+	err := db.QueryRow(ctx, "SELECT base FROM votings WHERE id = $1", votingID).Scan(&base)
+	if err != nil {
+		return 0, err
+	}
+	if base == 0 {
+		return config.CryptoParams[fmt.Sprintf("%v", votingID)].Base, nil
+	}
+	return uint(base), nil
+}
+
+// ErrBoardFull — ещё один бюллетень переполнил бы счетчики вариантов голосования
+var ErrBoardFull = errors.New("ballot board reached counter capacity")
+
+// checkBoardCapacity проверяет в транзакции tx, что бюллетень с весом weight не переполнит счетчики
+// размером base бит. Строка голосования блокируется, чтобы параллельные бюллетени проверялись по очереди
+func checkBoardCapacity(ctx context.Context, tx pgx.Tx, votingID int, weight uint64, votingType string, maxChoices int, base uint) error {
+	var locked int
+	if err := tx.QueryRow(ctx, "SELECT id FROM votings WHERE id = $1 FOR UPDATE", votingID).Scan(&locked); err != nil {
+		return err
+	}
+
+	var boardWeight int64
+	err := tx.QueryRow(ctx, "SELECT COALESCE(SUM(weight), 0) FROM encrypted_votes WHERE voting_id = $1", votingID).Scan(&boardWeight)
+	if err != nil {
+		return err
+	}
+
+	total, overflow := bits.Add64(uint64(boardWeight), weight, 0)
+	if overflow != 0 {
+		return ErrBoardFull
+	}
+	// Ранжированные бюллетени не суммируются, голоса их раундов считаются в int64
+	capacity := tally.Capacity(base)
+	if votingType == models.VotingTypeRanked {
+		capacity = tally.Capacity(tally.MaxBase)
+	}
+	maxCount, err := tally.MaxCount(votingType, maxChoices, total)
+	if err != nil || maxCount > capacity {
+		return ErrBoardFull
+	}
+	return nil
+}
+
+// checkProofVersion проверяет, что голосование принимает доказательства версии version
+func checkProofVersion(params config.VotingCryptoConfig, version uint) (string, error) {
+	switch version {
+	case 0, zkp.ProofVersionLegacy:
+		// Голосование, перешедшее на версию 2, не принимает доказательства без контекста;
+		// доказательства для схемы Дамгорда–Юрика существуют только в версии 2
+		if params.ZKPVersion >= zkp.ProofVersionContext || params.S() > 1 {
+			return "Голосование принимает только ZKP proof версии 2", errors.New("legacy ZKP proof rejected")
+		}
+	case zkp.ProofVersionContext:
+	default:
+		return "Неизвестная версия ZKP proof", fmt.Errorf("unknown ZKP proof version %d", version)
+	}
+	return "", nil
+}
+
+// parseProofRecord разбирает векторы доказательства из base64; size — число допустимых сообщений
+func parseProofRecord(version uint, eVec, zVec, aVec []string, size int) (zkp.ProofRecord, string, error) {
+	record := zkp.ProofRecord{Version: version}
+	if len(eVec) != size || len(zVec) != size || len(aVec) != size {
+		return record, "Размер ZKP proof не соответствует количеству вариантов ответа",
+			fmt.Errorf("ZKP proof vector length mismatch: expected %d, got e=%d z=%d a=%d", size, len(eVec), len(zVec), len(aVec))
+	}
+
+	vectors := []struct {
+		name    string
+		encoded []string
+		target  *[]*bigint.BigInt
+	}{
+		{"E", eVec, &record.E},
+		{"Z", zVec, &record.Z},
+		{"A", aVec, &record.A},
+	}
+	for _, vector := range vectors {
+		*vector.target = make([]*bigint.BigInt, size)
+		for i, value := range vector.encoded {
+			parsed, err := bigint.NewBigIntFromBase64(bigint.AddBase64Padding(value))
+			if err != nil {
+				return record, "Ошибка при парсинге ZKP proof " + vector.name + " вектора", err
+			}
+			(*vector.target)[i] = parsed
+		}
+	}
+	return record, "", nil
+}
+
+// verifyBallotProof проверяет доказательства бюллетеня согласно типу голосования
+// и возвращает их в публикуемом виде
+func verifyBallotProof(data *BallotRequestData, ballot, label *bigint.BigInt, votingType string, maxChoices, optionsCount int, base uint) ([]byte, string, error) {
+	params := config.CryptoParams[fmt.Sprintf("%d", data.VotingID)]
+	if message, err := checkProofVersion(params, data.ZKPVersion); err != nil {
+		return nil, message, err
+	}
+	votingID := bigint.NewBigIntFromInt(int64(data.VotingID))
+
+	// Счетчики всех вариантов (для ранжированного бюллетеня — матрица перестановки и вес) должны
+	// помещаться в открытый текст Paillier, иначе итог не расшифруется
+	if err := tally.CheckCapacity(votingType, optionsCount, base, tally.PlaintextBits(params.Paillier.N, params.S())); err != nil {
+		return nil, "Ключ голосования слишком мал для такого числа вариантов", err
+	}
+	slots := optionsCount
+
+	switch votingType {
+	case models.VotingTypeSingle:
+		if len(data.Choices) != 0 {
+			return nil, "Голосование принимает бюллетень с одним вариантом", errors.New("choices submitted for single-choice voting")
+		}
+
+		record, message, err := parseProofRecord(data.ZKPVersion, data.ZKPProofEVec, data.ZKPProofZVec, data.ZKPProofAVec, slots)
+		if err != nil {
+			return nil, message, err
+		}
+		proof := record.Proof(ballot, buildValidMessages(base, slots), params.Paillier.N, params.S(), params.ChallengeBits, votingID, label)
+		if err = proof.Verify(); err != nil {
+			return nil, "Ошибка при верификации ZKP proof: " + err.Error(), err
+		}
+		jsonedProof, err := json.Marshal(proof.Record())
+		return jsonedProof, "Ошибка при сохранении ZKP proof", err
+
+	case models.VotingTypeApproval, models.VotingTypeMultiChoice, models.VotingTypeCumulative, models.VotingTypeRanked:
+		// Отметка, баллы каждого варианта или строка ранжирования зашифрованы отдельно, верхнеуровневые
+		// векторы доказывают допустимость числа отмеченных вариантов, суммы баллов или перестановки
+		choiceSize, totalSize := len(zkp.ChoiceMessages()), maxChoices+1
+		switch votingType {
+		case models.VotingTypeCumulative:
+			choiceSize, totalSize = len(zkp.PointsMessages(maxChoices)), len(zkp.PointsTotalMessages(maxChoices))
+		case models.VotingTypeRanked:
+			choiceSize, totalSize = optionsCount, len(zkp.RankingTotalMessages(optionsCount, base))
+		}
+		if len(data.Choices) != optionsCount {
+			return nil, "Число шифротекстов не соответствует количеству вариантов ответа",
+				fmt.Errorf("expected %d choices, got %d", optionsCount, len(data.Choices))
+		}
+
+		record := zkp.MultiChoiceRecord{Choices: make([]zkp.ChoiceRecord, optionsCount)}
+		for i, choice := range data.Choices {
+			ciphertext, err := bigint.NewBigIntFromBase64(bigint.AddBase64Padding(choice.Ciphertext))
+			if err != nil {
+				return nil, "Ошибка при парсинге шифротекста варианта", err
+			}
+			proofRecord, message, err := parseProofRecord(data.ZKPVersion, choice.ZKPProofEVec, choice.ZKPProofZVec, choice.ZKPProofAVec, choiceSize)
+			if err != nil {
+				return nil, message, err
+			}
+			record.Choices[i] = zkp.ChoiceRecord{Ciphertext: ciphertext, Proof: proofRecord}
+		}
+		total, message, err := parseProofRecord(data.ZKPVersion, data.ZKPProofEVec, data.ZKPProofZVec, data.ZKPProofAVec, totalSize)
+		if err != nil {
+			return nil, message, err
+		}
+		record.Total = total
+
+		var proof *zkp.MultiChoiceProof
+		ballotBase := base
+		switch votingType {
+		case models.VotingTypeCumulative:
+			proof, err = record.PointsProof(optionsCount, maxChoices, params.Paillier.N, params.S(), params.ChallengeBits, votingID, label)
+		case models.VotingTypeRanked:
+			proof, err = record.RankingProof(optionsCount, base, params.Paillier.N, params.S(), params.ChallengeBits, votingID, label)
+			ballotBase = zkp.RankingBase(optionsCount, base)
+		default:
+			proof, err = record.Proof(optionsCount, maxChoices, params.Paillier.N, params.S(), params.ChallengeBits, votingID, label)
+		}
+		if err == nil {
+			err = proof.Verify(ballot, ballotBase)
+		}
+		if err != nil {
+			return nil, "Ошибка при верификации ZKP proof: " + err.Error(), err
+		}
+		jsonedProof, err := json.Marshal(proof.Record())
+		return jsonedProof, "Ошибка при сохранении ZKP proof", err
+
+	default:
+		return nil, "Неизвестный тип голосования", fmt.Errorf("unknown voting type %q", votingType)
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"ev/internal/crypto/bigint"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrCredentialAlreadyUsed — метка или подпись Регистратора уже были использованы в этом голосовании
+var ErrCredentialAlreadyUsed = errors.New("credential already used")
+
+// spendCredential помечает пару (метка, подпись) использованной в рамках транзакции tx.
+// Уникальные ограничения таблицы гарантируют, что одна подпись принимается только один раз
+// даже при параллельных запросах
+func spendCredential(ctx context.Context, tx pgx.Tx, votingID int, label, signature *bigint.BigInt) error {
+	tag, err := tx.Exec(ctx,
+		"INSERT INTO spent_credentials (voting_id, label, signature, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+		votingID,
+		bigint.AddBase64Padding(label.ToBase64()),
+		bigint.AddBase64Padding(signature.ToBase64()),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCredentialAlreadyUsed
+	}
+	return nil
+}
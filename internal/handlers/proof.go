@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"ev/internal/ballotlog"
+	"ev/internal/crypto/merklie"
+	"ev/internal/database"
+	"ev/internal/logger"
+	"ev/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Доказательство включения бюллетеня под последним опубликованным корнем.
+// Используется страницей отслеживания и API /api/v1/votings/{id}/ballots/{label}/proof
+
+var (
+	// errBallotNotPublished — бюллетень ещё не попал ни под один опубликованный корень
+	errBallotNotPublished = errors.New("ballot is not published under any merkle root")
+	// errProofMismatch — доказательство не сходится к опубликованному корню
+	errProofMismatch = errors.New("merkle proof does not match published root")
+)
+
+// Направление соседнего узла в пути доказательства
+const (
+	proofDirectionLeft  = "left"
+	proofDirectionRight = "right"
+)
+
+type APIProofNode struct {
+	Hash      string `json:"hash"`
+	Direction string `json:"direction"`
+}
+
+// APIBallotProofData — доказательство включения бюллетеня. Корень вычисляется от LeafHash:
+// узел с направлением right хешируется справа от текущего хеша, left — слева
+type APIBallotProofData struct {
+	Label         string            `json:"label"`
+	EncryptedVote string            `json:"encrypted_vote"`
+	LeafHash      string            `json:"leaf_hash"`
+	LeafIndex     int               `json:"leaf_index"`
+	Path          []APIProofNode    `json:"path"`
+	RootID        int64             `json:"root_id"`
+	RootValue     string            `json:"root_value"`
+	TreeVersion   int               `json:"tree_version"`
+	TreeSize      int               `json:"tree_size"`
+	CreatedAt     time.Time         `json:"created_at"`
+	TreeHead      *merklie.TreeHead `json:"tree_head"`
+}
+
+// ballotProof дополняет доказательство данными бюллетеня для страницы отслеживания
+type ballotProof struct {
+	APIBallotProofData
+	ZKPProof  string
+	Signature string
+}
+
+// buildBallotProof строит доказательство включения бюллетеня label под последним корнем,
+// в снимок которого он попал, и проверяет, что доказательство сходится к этому корню
+func buildBallotProof(ctx context.Context, db *pgxpool.Pool, votingID, label string) (*ballotProof, error) {
+	result := &ballotProof{}
+	result.Label = label
+
+	var root models.MerklieRoot
+	err := db.QueryRow(ctx,
+		"SELECT mr.id, mr.root_value, mr.created_at, mr.tree_version, mr.tree_size, mr.signed_at, mr.signature, mr.board_root, mr.board_size, mr.revocation_root, pev.encrypted_vote, pev.zkp_proof, pev.signature "+
+			"FROM merklie_roots mr JOIN public_encrypted_votes pev ON mr.id = pev.corresponds_to_merklie_root "+
+			"WHERE pev.voting_id = $1 AND pev.label = $2 ORDER BY mr.created_at DESC, mr.id DESC LIMIT 1",
+		votingID,
+		label,
+	).Scan(&result.RootID, &result.RootValue, &result.CreatedAt, &result.TreeVersion, &root.TreeSize, &root.SignedAt, &root.Signature, &root.BoardRoot, &root.BoardSize, &root.RevocationRoot, &result.EncryptedVote, &result.ZKPProof, &result.Signature)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errBallotNotPublished
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	root.TreeVersion, root.RootValue = result.TreeVersion, result.RootValue
+	result.TreeHead = signedTreeHead(votingID, root)
+	treeSize := root.TreeSize
+	result.LeafHash = merklie.HashLeaf(result.TreeVersion, result.EncryptedVote)
+
+	var proof []merklie.MerklieTreePublicNode
+	found := false
+	if treeSize != nil {
+		// Корень построен над префиксом журнала бюллетеней: доказательство берётся
+		// из закешированного дерева за O(log n), без чтения всего реестра
+		result.TreeSize = *treeSize
+		err = ballotlog.WithTree(ctx, db, votingID, func(merkleTree *merklie.MerkleTree) error {
+			index, exists := merkleTree.LeafIndex(result.LeafHash)
+			if !exists || index >= result.TreeSize {
+				return nil
+			}
+			var err error
+			proof, err = merkleTree.ProofAt(index, result.TreeSize)
+			result.LeafIndex, found = index, err == nil
+			return err
+		})
+	} else {
+		// Корни, построенные до появления журнала, пересчитываются по снимку реестра
+		proof, found, err = legacyBallotProof(ctx, db, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errProofMismatch
+	}
+
+	// У дерева из одного листа путь пуст, а корень совпадает с хешем листа
+	calculatedRoot := result.LeafHash
+	if len(proof) > 0 {
+		if calculatedRoot, err = merklie.CalculateRootFromProof(result.TreeVersion, proof, result.LeafHash); err != nil {
+			return nil, err
+		}
+	}
+	if calculatedRoot != result.RootValue {
+		return nil, errProofMismatch
+	}
+
+	result.Path = make([]APIProofNode, len(proof))
+	for i, node := range proof {
+		result.Path[i] = APIProofNode{Hash: node.Hash, Direction: proofDirectionLeft}
+		if node.IsRight {
+			result.Path[i].Direction = proofDirectionRight
+		}
+	}
+
+	return result, nil
+}
+
+// legacyBallotProof пересчитывает дерево по снимку реестра под корнем без журнала
+func legacyBallotProof(ctx context.Context, db *pgxpool.Pool, result *ballotProof) ([]merklie.MerklieTreePublicNode, bool, error) {
+	rows, err := db.Query(ctx, "SELECT encrypted_vote FROM public_encrypted_votes WHERE corresponds_to_merklie_root = $1 ORDER BY created_at, label", result.RootID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	merkleTree, err := merklie.NewMerkleTreeWithVersion(result.TreeVersion)
+	if err != nil {
+		return nil, false, err
+	}
+	for rows.Next() {
+		var encryptedVote string
+		if err = rows.Scan(&encryptedVote); err != nil {
+			return nil, false, err
+		}
+		merkleTree.AddLeaf(encryptedVote)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	result.TreeSize = merkleTree.Size()
+	index, exists := merkleTree.LeafIndex(result.LeafHash)
+	if !exists {
+		return nil, false, nil
+	}
+	result.LeafIndex = index
+	proof, ok := merkleTree.GetProof(result.LeafHash)
+	return proof, ok, nil
+}
+
+// GetBallotProof отдаёт доказательство включения бюллетеня с меткой label
+func GetBallotProof(w http.ResponseWriter, r *http.Request, votingID, label string) {
+	log := logger.GetLogger()
+	log.Info().Str("voting_id", votingID).Str("label", label).Msg("Requested ballot proof")
+
+	if label == "" {
+		writeAPIErrorCode(w, http.StatusBadRequest, apiErrorInvalidLabel, "Не указана метка бюллетеня")
+		return
+	}
+
+	proof, err := buildBallotProof(context.Background(), database.GetCounterPGConnection(), votingID, label)
+	if errors.Is(err, errBallotNotPublished) {
+		writeAPIErrorCode(w, http.StatusNotFound, apiErrorBallotNotPublished, "Бюллетень не опубликован ни под одним корнем")
+		return
+	}
+	if errors.Is(err, errProofMismatch) {
+		log.Error().Str("voting_id", votingID).Str("label", label).Msg("Merkle proof does not match published root")
+		writeAPIErrorCode(w, http.StatusInternalServerError, apiErrorProofMismatch, "Доказательство не сходится к опубликованному корню")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error building ballot proof")
+		writeAPIErrorCode(w, http.StatusInternalServerError, apiErrorInternal, "Ошибка при построении доказательства")
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, proof.APIBallotProofData)
+}
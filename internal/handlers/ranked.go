@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"ev/internal/config"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/paillier"
+	"ev/internal/crypto/zkp"
+	"ev/internal/logger"
+	"ev/internal/tally"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Подсчет ранжированного голосования. Бюллетени не расшифровываются по одному: Счетчик перемешивает
+// их с доказательством (zkp.Shuffle), и расшифровываются только перемешанные бюллетени.
+// Перемешивание строится один раз для зашифрованной суммы и хранится в shuffles, чтобы доверенные лица
+// частично расшифровывали одни и те же выходы
+
+// loadRankedInputs возвращает перемешиваемые шифротексты бюллетеней (tally.RankedInput) в порядке меток:
+// порядок входов перемешивания должен однозначно восстанавливаться по реестру
+func loadRankedInputs(ctx context.Context, db *pgxpool.Pool, votingID string, options int) ([]*bigint.BigInt, error) {
+	base, err := loadVotingBase(ctx, db, votingID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, "SELECT label, encrypted_vote, weight FROM encrypted_votes WHERE voting_id = $1", votingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type rankedBallot struct {
+		label  string
+		vote   *bigint.BigInt
+		weight uint64
+	}
+	ballots := []rankedBallot{}
+	for rows.Next() {
+		var label, encryptedVote string
+		var weight uint64
+		if err = rows.Scan(&label, &encryptedVote, &weight); err != nil {
+			return nil, err
+		}
+		vote, err := bigint.NewBigIntFromBase64(bigint.AddBase64Padding(encryptedVote))
+		if err != nil {
+			return nil, err
+		}
+		ballots = append(ballots, rankedBallot{label: label, vote: vote, weight: weight})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Сортировка в Go не зависит от правил сравнения строк базы
+	sort.Slice(ballots, func(i, j int) bool { return ballots[i].label < ballots[j].label })
+
+	params := config.CryptoParams[votingID]
+	inputs := make([]*bigint.BigInt, len(ballots))
+	for i, ballot := range ballots {
+		inputs[i] = tally.RankedInput(params.Paillier.N, params.S(), ballot.vote, ballot.weight, base, options)
+	}
+	return inputs, nil
+}
+
+// loadShuffle возвращает перемешивание бюллетеней для зашифрованной суммы sum. Если его ещё нет,
+// оно строится и сохраняется; при одновременном построении сохраняется первое
+func loadShuffle(ctx context.Context, db *pgxpool.Pool, votingID string, sum *bigint.BigInt, inputs []*bigint.BigInt) (*zkp.ShuffleRecord, error) {
+	cryptedResult := bigint.AddBase64Padding(sum.ToBase64())
+
+	selectShuffle := func() (*zkp.ShuffleRecord, error) {
+		var jsonedShuffle string
+		err := db.QueryRow(ctx,
+			"SELECT shuffle FROM shuffles WHERE voting_id = $1 AND crypted_result = $2",
+			votingID,
+			cryptedResult,
+		).Scan(&jsonedShuffle)
+		if err != nil {
+			return nil, err
+		}
+		var shuffle zkp.ShuffleRecord
+		if err = json.Unmarshal([]byte(jsonedShuffle), &shuffle); err != nil {
+			return nil, err
+		}
+		return &shuffle, nil
+	}
+
+	shuffle, err := selectShuffle()
+	if err == nil || !errors.Is(err, pgx.ErrNoRows) {
+		return shuffle, err
+	}
+
+	votingIDBigint, err := bigint.NewBigIntFromString(votingID)
+	if err != nil {
+		return nil, fmt.Errorf("voting ID %q is not a number", votingID)
+	}
+	params := config.CryptoParams[votingID]
+	shuffle = zkp.Shuffle(params.Paillier.N, params.S(), votingIDBigint, inputs)
+
+	jsonedShuffle, err := json.Marshal(shuffle)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(ctx,
+		"INSERT INTO shuffles (voting_id, crypted_result, shuffle, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+		votingID,
+		cryptedResult,
+		string(jsonedShuffle),
+		time.Now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return selectShuffle()
+}
+
+// loadRankedShuffle возвращает перемешивание бюллетеней ранжированного голосования для суммы sum
+func loadRankedShuffle(ctx context.Context, db *pgxpool.Pool, votingID string, sum *bigint.BigInt) (*zkp.ShuffleRecord, error) {
+	var options int
+	if err := db.QueryRow(ctx, "SELECT COUNT(*) FROM voting_options WHERE voting_id = $1", votingID).Scan(&options); err != nil {
+		return nil, err
+	}
+	inputs, err := loadRankedInputs(ctx, db, votingID, options)
+	if err != nil {
+		return nil, err
+	}
+	return loadShuffle(ctx, db, votingID, sum, inputs)
+}
+
+// verifyRankedPartials проверяет частичные расшифрования одним доверенным лицом всех выходов перемешивания
+func verifyRankedPartials(threshold *paillier.ThresholdPublicKey, outputs []*bigint.BigInt, partials []*paillier.PartialDecryption) error {
+	if len(partials) != len(outputs) {
+		return fmt.Errorf("%d partial decryptions for %d shuffled ballots", len(partials), len(outputs))
+	}
+	for i, partial := range partials {
+		if partial == nil {
+			return fmt.Errorf("shuffled ballot %d has no partial decryption", i)
+		}
+		if partial.Index != partials[0].Index {
+			return errors.New("partial decryptions come from different trustees")
+		}
+		if err := paillier.VerifyPartialDecryption(threshold, outputs[i], partial); err != nil {
+			return fmt.Errorf("shuffled ballot %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// loadRankedPartials возвращает проверенные частичные расшифрования выходов перемешивания по доверенным лицам
+func loadRankedPartials(ctx context.Context, db *pgxpool.Pool, votingID string, sum *bigint.BigInt, outputs []*bigint.BigInt) ([][]*paillier.PartialDecryption, error) {
+	log := logger.GetLogger()
+	threshold := config.CryptoParams[votingID].Threshold
+
+	rows, err := db.Query(ctx,
+		"SELECT partial_decryption FROM partial_decryptions WHERE voting_id = $1 AND crypted_result = $2 ORDER BY trustee_index",
+		votingID,
+		bigint.AddBase64Padding(sum.ToBase64()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trustees := [][]*paillier.PartialDecryption{}
+	for rows.Next() {
+		var jsonedPartials string
+		if err = rows.Scan(&jsonedPartials); err != nil {
+			return nil, err
+		}
+
+		var partials []*paillier.PartialDecryption
+		if err = json.Unmarshal([]byte(jsonedPartials), &partials); err != nil {
+			log.Error().Err(err).Msg("Error unmarshalling partial decryptions of shuffled ballots")
+			continue
+		}
+
+		if err = verifyRankedPartials(threshold, outputs, partials); err != nil {
+			log.Error().Err(err).Msg("Stored partial decryptions of shuffled ballots are invalid")
+			continue
+		}
+		trustees = append(trustees, partials)
+	}
+
+	return trustees, rows.Err()
+}
+
+// tallyRanked перемешивает бюллетени ранжированного голосования и расшифровывает перемешанные бюллетени.
+// При пороговом ключе waiting сообщает, что частичных расшифрований ещё меньше порога
+func tallyRanked(ctx context.Context, db *pgxpool.Pool, votingID string, sum *bigint.BigInt) (proof *tally.RankedProof, waiting bool, err error) {
+	shuffle, err := loadRankedShuffle(ctx, db, votingID, sum)
+	if err != nil {
+		return nil, false, err
+	}
+
+	params := config.CryptoParams[votingID]
+	proof = &tally.RankedProof{Shuffle: shuffle, Plaintexts: make([]*bigint.BigInt, len(shuffle.Outputs))}
+
+	if threshold := params.Threshold; threshold != nil {
+		trustees, err := loadRankedPartials(ctx, db, votingID, sum, shuffle.Outputs)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(trustees) < threshold.Threshold {
+			return nil, true, nil
+		}
+		proof.Partials = trustees[:threshold.Threshold]
+
+		for i := range shuffle.Outputs {
+			partials := make([]*paillier.PartialDecryption, len(proof.Partials))
+			for t, trustee := range proof.Partials {
+				partials[t] = trustee[i]
+			}
+			if proof.Plaintexts[i], err = paillier.CombinePartialDecryptions(threshold, partials); err != nil {
+				return nil, false, fmt.Errorf("shuffled ballot %d: %w", i, err)
+			}
+		}
+		return proof, false, nil
+	}
+
+	proof.Decryptions = make([]*paillier.DecryptionProof, len(shuffle.Outputs))
+	for i, output := range shuffle.Outputs {
+		if proof.Plaintexts[i], err = paillier.DecryptDJ(output, params.Paillier.Lambda, params.Paillier.N, params.S()); err != nil {
+			return nil, false, fmt.Errorf("shuffled ballot %d: %w", i, err)
+		}
+		if proof.Decryptions[i], err = paillier.ProveDecryptionDJ(output, proof.Plaintexts[i], params.Paillier.Lambda, params.Paillier.N, params.S()); err != nil {
+			return nil, false, fmt.Errorf("shuffled ballot %d: %w", i, err)
+		}
+	}
+	return proof, false, nil
+}
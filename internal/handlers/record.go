@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"ev/internal/ballotlog"
+	"ev/internal/config"
+	"ev/internal/database"
+	"ev/internal/logger"
+	"ev/internal/record"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// errNoResults — по голосованию ещё не опубликован итог
+var errNoResults = errors.New("voting has no published results")
+
+// buildElectionRecord собирает выгрузку голосования из базы Счетчика и открытых параметров
+func buildElectionRecord(ctx context.Context, db *pgxpool.Pool, votingID string) (*record.ElectionRecord, error) {
+	cryptoParams, exists := config.CryptoParams[votingID]
+	if !exists {
+		return nil, errors.New("voting crypto parameters not found")
+	}
+
+	rec := &record.ElectionRecord{
+		Version:  record.RecordVersion,
+		VotingID: votingID,
+		Parameters: record.Parameters{
+			PaillierN:          cryptoParams.Paillier.N,
+			RSAN:               cryptoParams.RSA.N,
+			RSAE:               cryptoParams.RSA.E,
+			Threshold:          cryptoParams.Threshold,
+			ChallengeBits:      cryptoParams.ChallengeBits,
+			ReVotingMultiplier: cryptoParams.ReVotingMultiplier,
+			ZKPVersion:         cryptoParams.ZKPVersion,
+			TreeHeadPublicKey:  config.Config.TreeHead.PublicKey,
+			WeightClasses:      []record.WeightClass{},
+			DamgardJurikS:      cryptoParams.DamgardJurikS,
+		},
+		Options:      []record.Option{},
+		Ballots:      []record.Ballot{},
+		MerklieRoots: []record.MerklieRoot{},
+		Revotes:      []record.Revote{},
+	}
+
+	// Открытые ключи классов веса нужны для проверки подписей взвешенных бюллетеней
+	for _, class := range cryptoParams.WeightClasses {
+		rec.Parameters.WeightClasses = append(rec.Parameters.WeightClasses, record.WeightClass{
+			Weight: class.Weight,
+			RSAN:   class.RSA.N,
+			RSAE:   class.RSA.E,
+		})
+	}
+
+	err := db.QueryRow(ctx,
+		"SELECT name, question, state, voting_type, max_choices, start_time, audit_time, end_time FROM votings WHERE id = $1",
+		votingID,
+	).Scan(&rec.Voting.Name, &rec.Voting.Question, &rec.Voting.State, &rec.Voting.Type, &rec.Voting.MaxChoices, &rec.Voting.StartTime, &rec.Voting.AuditTime, &rec.Voting.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Parameters.Base, err = loadVotingBase(ctx, db, votingID); err != nil {
+		return nil, err
+	}
+
+	var jsonedResultedCount string
+	var jsonedRounds *string
+	err = db.QueryRow(ctx,
+		"SELECT corresponds_to_merklie_root, crypted_result, unencrypted_result, resulted_count, result_proof, rounds, created_at FROM results WHERE voting_id = $1 ORDER BY created_at DESC LIMIT 1",
+		votingID,
+	).Scan(&rec.Result.MerklieRootID, &rec.Result.CryptedResult, &rec.Result.UnencryptedResult, &jsonedResultedCount, &rec.Result.ResultProof, &jsonedRounds, &rec.Result.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errNoResults
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(jsonedResultedCount), &rec.Result.ResultedCount); err != nil {
+		return nil, err
+	}
+	if jsonedRounds != nil {
+		if err = json.Unmarshal([]byte(*jsonedRounds), &rec.Result.Rounds); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := db.Query(ctx, "SELECT option_index, option_text FROM voting_options WHERE voting_id = $1 ORDER BY option_index", votingID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var option record.Option
+		if err = rows.Scan(&option.Index, &option.Text); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rec.Options = append(rec.Options, option)
+	}
+	rows.Close()
+
+	rows, err = db.Query(ctx, "SELECT id, root_value, created_at, tree_version, tree_size, signed_at, COALESCE(signature, ''), board_root, board_size, revocation_root FROM merklie_roots WHERE voting_id = $1 ORDER BY id", votingID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var root record.MerklieRoot
+		if err = rows.Scan(&root.ID, &root.RootValue, &root.CreatedAt, &root.TreeVersion, &root.TreeSize, &root.SignedAt, &root.Signature, &root.BoardRoot, &root.BoardSize, &root.RevocationRoot); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rec.MerklieRoots = append(rec.MerklieRoots, root)
+	}
+	rows.Close()
+
+	entries, err := ballotlog.Load(ctx, db, votingID, -1)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		rec.BallotLog = append(rec.BallotLog, record.LogEntry{
+			LogIndex:      entry.LogIndex,
+			Label:         entry.Label,
+			EncryptedVote: entry.EncryptedVote,
+			ZKPProof:      entry.ZKPProof,
+			Signature:     entry.Signature,
+			Weight:        entry.Weight,
+			CreatedAt:     entry.CreatedAt,
+			ReplacedBy:    entry.ReplacedBy,
+		})
+	}
+
+	rows, err = db.Query(ctx, "SELECT old_label, old_nonce, new_label, created_at FROM public_revotes WHERE voting_id = $1 ORDER BY created_at", votingID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var revote record.Revote
+		if err = rows.Scan(&revote.OldLabel, &revote.OldNonce, &revote.NewLabel, &revote.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rec.Revotes = append(rec.Revotes, revote)
+	}
+	rows.Close()
+
+	// Бюллетени идут в порядке дерева: по индексу журнала, а для корней без журнала — в порядке
+	// поступления, в котором они добавлялись в дерево при подсчете
+	rows, err = db.Query(ctx,
+		"SELECT pev.label, pev.encrypted_vote, pev.zkp_proof, pev.signature, pev.weight, pev.created_at FROM public_encrypted_votes pev "+
+			"LEFT JOIN ballot_log bl ON bl.voting_id = pev.voting_id AND bl.label = pev.label "+
+			"WHERE pev.voting_id = $1 AND pev.corresponds_to_merklie_root = $2 "+
+			"ORDER BY bl.log_index, pev.created_at, pev.label",
+		votingID,
+		rec.Result.MerklieRootID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ballot record.Ballot
+		if err = rows.Scan(&ballot.Label, &ballot.EncryptedVote, &ballot.ZKPProof, &ballot.Signature, &ballot.Weight, &ballot.CreatedAt); err != nil {
+			return nil, err
+		}
+		rec.Ballots = append(rec.Ballots, ballot)
+	}
+
+	return rec, rows.Err()
+}
+
+// ExportElectionRecord записывает в w подписанный архив выгрузки голосования (см. record.WriteBundle)
+func ExportElectionRecord(ctx context.Context, db *pgxpool.Pool, votingID string, w io.Writer) error {
+	privateKey, err := base64.StdEncoding.DecodeString(config.Config.Record.PrivateKey)
+	if err != nil || len(privateKey) != ed25519.PrivateKeySize {
+		return errors.New("record signing key is not configured")
+	}
+
+	rec, err := buildElectionRecord(ctx, db, votingID)
+	if err != nil {
+		return err
+	}
+
+	return record.WriteBundle(w, rec, ed25519.PrivateKey(privateKey))
+}
+
+// GetElectionRecord отдаёт выгрузку голосования для автономной проверки (ev-verify)
+func GetElectionRecord(w http.ResponseWriter, r *http.Request, votingID string) {
+	log := logger.GetLogger()
+	log.Info().Str("voting_id", votingID).Msg("Requested election record")
+
+	if _, err := strconv.Atoi(votingID); err != nil {
+		http.Error(w, "Неверный идентификатор голосования", http.StatusBadRequest)
+		return
+	}
+
+	rec, err := buildElectionRecord(context.Background(), database.GetCounterPGConnection(), votingID)
+	if errors.Is(err, errNoResults) {
+		http.Error(w, "Результаты голосования еще не опубликованы", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error building election record")
+		http.Error(w, "Ошибка при формировании выгрузки голосования", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=election_"+votingID+".json")
+	if err = json.NewEncoder(w).Encode(rec); err != nil {
+		log.Error().Err(err).Msg("Error sending response")
+	}
+}
+
+// ExportElectionRecordBundle отдаёт подписанный архив выгрузки голосования для аудиторов
+func ExportElectionRecordBundle(w http.ResponseWriter, r *http.Request, votingID string) {
+	log := logger.GetLogger()
+	log.Info().Str("voting_id", votingID).Msg("Requested election record bundle")
+
+	if _, err := strconv.Atoi(votingID); err != nil {
+		http.Error(w, "Неверный идентификатор голосования", http.StatusBadRequest)
+		return
+	}
+
+	// Архив собирается в памяти, чтобы при ошибке не отдать клиенту обрезанный файл
+	var bundle bytes.Buffer
+	err := ExportElectionRecord(context.Background(), database.GetCounterPGConnection(), votingID, &bundle)
+	if errors.Is(err, errNoResults) {
+		http.Error(w, "Результаты голосования еще не опубликованы", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error exporting election record bundle")
+		http.Error(w, "Ошибка при формировании архива голосования", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=election_"+votingID+".zip")
+	if _, err = w.Write(bundle.Bytes()); err != nil {
+		log.Error().Err(err).Msg("Error sending response")
+	}
+}
@@ -10,9 +10,9 @@ import (
 	"ev/internal/handlers/render"
 	"ev/internal/logger"
 	"ev/internal/models"
+	"ev/internal/utils"
 	"io"
 	"net/http"
-	"strconv"
 )
 
 type ProfilePageData struct {
@@ -65,9 +65,18 @@ type VotingPageCryptParams struct {
 	RsaN               string
 	RsaE               string
 	PaillierN          string
+	DamgardJurikS      uint
 	ChallengeBits      uint
 	Base               uint
 	ReVotingMultiplier uint64
+	WeightClasses      []VotingPageWeightClass
+}
+
+// VotingPageWeightClass — открытый ключ Регистратора для бюллетеней с весом Weight
+type VotingPageWeightClass struct {
+	Weight uint64
+	RsaN   string
+	RsaE   string
 }
 
 type VotingPageData struct {
@@ -86,12 +95,12 @@ func ShowVotingPage(w http.ResponseWriter, r *http.Request, votingID string) {
 	// Получаем данные голосования
 	var voting models.Voting
 	err := db.QueryRow(ctx,
-		`SELECT v.id, v.name, v.question
+		`SELECT v.id, v.name, v.question, v.voting_type, v.max_choices
 		FROM votings v
 		WHERE v.id = $1 AND state <> 0`,
 		votingID,
 	).Scan(
-		&voting.ID, &voting.Name, &voting.Question,
+		&voting.ID, &voting.Name, &voting.Question, &voting.Type, &voting.MaxChoices,
 	)
 	if err != nil {
 		http.Error(w, "Голосование не найдено", http.StatusNotFound)
@@ -127,6 +136,23 @@ func ShowVotingPage(w http.ResponseWriter, r *http.Request, votingID string) {
 		return
 	}
 
+	weightClasses := make([]VotingPageWeightClass, 0, len(cryptoParams.WeightClasses))
+	for _, class := range cryptoParams.WeightClasses {
+		weightClasses = append(weightClasses, VotingPageWeightClass{
+			Weight: class.Weight,
+			RsaN:   bigint.AddBase64Padding(class.RSA.N.ToBase64()),
+			RsaE:   bigint.AddBase64Padding(class.RSA.E.ToBase64()),
+		})
+	}
+
+	// Размер счетчика подобран при создании голосования
+	base, err := loadVotingBase(ctx, db, votingID)
+	if err != nil {
+		log.Error().Err(err).Str("votingID", votingID).Msg("error getting voting counter size")
+		http.Error(w, "Ошибка при получении криптографических параметров", http.StatusInternalServerError)
+		return
+	}
+
 	// Рендерим шаблон
 	render.RenderTemplate(w, "voting", VotingPageData{
 		Voting:  voting,
@@ -135,60 +161,21 @@ func ShowVotingPage(w http.ResponseWriter, r *http.Request, votingID string) {
 			RsaN:               bigint.AddBase64Padding(cryptoParams.RSA.N.ToBase64()),
 			RsaE:               bigint.AddBase64Padding(cryptoParams.RSA.E.ToBase64()),
 			PaillierN:          bigint.AddBase64Padding(cryptoParams.Paillier.N.ToBase64()),
+			DamgardJurikS:      cryptoParams.S(),
 			ChallengeBits:      cryptoParams.ChallengeBits,
-			Base:               cryptoParams.Base,
+			Base:               base,
 			ReVotingMultiplier: cryptoParams.ReVotingMultiplier,
+			WeightClasses:      weightClasses,
 		},
 	})
 
 	log.Info().Msg("Rendered voting page")
 }
 
-type UserTempID struct {
-	TempID string `json:"temp_id"`
-}
-
-func getUserTempID(r *http.Request) (string, error) {
-	// Создаем URL для запроса, используя тот же хост
-	//TODO: тут может быть использование HTTPS, нужно ставить проверку
-	url := "http://" + config.Config.Server.Host + ":" + strconv.Itoa(config.Config.Server.Port) + "/auth/temp-id"
-
-	// Создаем новый запрос к /auth/user-info
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-
-	// Копируем куки из оригинального запроса
-	for _, cookie := range r.Cookies() {
-		req.AddCookie(cookie)
-	}
-
-	// Выполняем запрос
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	// Проверяем статус ответа
-	if resp.StatusCode != http.StatusOK {
-		return "", err
-	}
-
-	// Декодируем ответ
-	var tempID UserTempID
-	if err := json.NewDecoder(resp.Body).Decode(&tempID); err != nil {
-		return "", err
-	}
-
-	return tempID.TempID, nil
-}
-
 type RequestData struct {
-	VotingID      string `json:"voting_id"`
-	BlindedBallot string `json:"blinded_ballot"`
+	VotingID      string                        `json:"voting_id"`
+	BlindedBallot string                        `json:"blinded_ballot"`
+	Credential    *utils.SignedTempIDCredential `json:"credential"`
 }
 
 type ResponseData struct {
@@ -203,52 +190,72 @@ func RegisterVote(w http.ResponseWriter, r *http.Request) {
 	log.Info().Msg("Requested vote registration")
 	w.Header().Set("Content-Type", "application/json")
 
-	tempID, err := getUserTempID(r)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		err = json.NewEncoder(w).Encode(ResponseData{
 			Signature: "",
 			Success:   false,
-			Message:   "Ошибка при получении временного ID",
+			Message:   "Ошибка при чтении тела запроса",
 		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			log.Error().Err(err).Msg("Error sending response")
+
 		}
 		return
 	}
 
-	log.Info().Msg("User temp ID found in User's request")
-
-	body, err := io.ReadAll(r.Body)
+	var data RequestData
+	err = json.Unmarshal(body, &data)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		err = json.NewEncoder(w).Encode(ResponseData{
 			Signature: "",
 			Success:   false,
-			Message:   "Ошибка при чтении тела запроса",
+			Message:   "Ошибка при парсинге JSON данных бюллетеня",
 		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			log.Error().Err(err).Msg("Error sending response")
+		}
+		return
+	}
 
+	// Подпись IDP проверяется локально открытым ключом IDP
+	credential, err := utils.VerifyTempIDCredential(data.Credential, data.VotingID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		log.Error().Err(err).Msg("Temp ID credential rejected")
+		err = json.NewEncoder(w).Encode(ResponseData{
+			Signature: "",
+			Success:   false,
+			Message:   "Ошибка при проверке подписи временного ID",
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error().Err(err).Msg("Error sending response")
 		}
 		return
 	}
+	tempIDs := credential.TempIDs
 
-	var data RequestData
-	err = json.Unmarshal(body, &data)
+	log.Info().Msg("User temp ID credential verified")
+
+	// Вес голосующего удостоверяется ключом подписи его класса веса
+	rsaN, _, rsaD, err := config.CryptoParams[data.VotingID].SigningKey(credential.Weight)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		err = json.NewEncoder(w).Encode(ResponseData{
 			Signature: "",
 			Success:   false,
-			Message:   "Ошибка при парсинге JSON данных бюллетеня",
+			Message:   "Для веса голосующего нет ключа подписи",
 		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			log.Error().Err(err).Msg("Error sending response")
 		}
+		log.Error().Uint64("weight", credential.Weight).Msg("No signing key for voter weight")
 		return
 	}
 
@@ -287,8 +294,8 @@ func RegisterVote(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	rows, err = db.Query(ctx,
-		"SELECT id FROM tempIDs WHERE temp_id = $1 AND voting_id = $2",
-		tempID,
+		"SELECT id FROM tempIDs WHERE temp_id = ANY($1) AND voting_id = $2",
+		tempIDs,
 		data.VotingID,
 	)
 
@@ -318,7 +325,7 @@ func RegisterVote(w http.ResponseWriter, r *http.Request) {
 	if !isReVoted {
 		_, err = db.Exec(ctx,
 			"INSERT INTO tempIDs (temp_id, voting_id) VALUES ($1, $2)",
-			tempID,
+			tempIDs[0],
 			data.VotingID,
 		)
 		if err != nil {
@@ -365,10 +372,10 @@ func RegisterVote(w http.ResponseWriter, r *http.Request) {
 	var signature *bigint.BigInt
 
 	if isReVoted {
-		signature = bs.SignBlinded(blindedBallot.Mul(bigint.NewBigIntFromUint(config.CryptoParams[votingIDStr].ReVotingMultiplier)), config.CryptoParams[votingIDStr].RSA.D, config.CryptoParams[votingIDStr].RSA.N)
+		signature = bs.SignBlinded(blindedBallot.Mul(bigint.NewBigIntFromUint(config.CryptoParams[votingIDStr].ReVotingMultiplier)), rsaD, rsaN)
 		log.Info().Msg("Re-voted signature generated")
 	} else {
-		signature = bs.SignBlinded(blindedBallot, config.CryptoParams[votingIDStr].RSA.D, config.CryptoParams[votingIDStr].RSA.N)
+		signature = bs.SignBlinded(blindedBallot, rsaD, rsaN)
 		log.Info().Msg("Signature generated")
 	}
 
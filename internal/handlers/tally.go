@@ -3,6 +3,8 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"ev/internal/ballotlog"
 	"ev/internal/config"
 	"ev/internal/crypto/bigint"
 	"ev/internal/crypto/blind_signature"
@@ -13,11 +15,15 @@ import (
 	"ev/internal/handlers/render"
 	"ev/internal/logger"
 	"ev/internal/models"
+	"ev/internal/record"
+	"ev/internal/tally"
 	"fmt"
-	"html/template"
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type BallotRequestData struct {
@@ -26,10 +32,16 @@ type BallotRequestData struct {
 	ZKPProofEVec    []string `json:"zkp_proof_e_vec"`
 	ZKPProofZVec    []string `json:"zkp_proof_z_vec"`
 	ZKPProofAVec    []string `json:"zkp_proof_a_vec"`
+	ZKPVersion      uint     `json:"zkp_version"`
 	Signature       string   `json:"signature"`
 	Label           string   `json:"label"`
 	OldLabel        string   `json:"old_label"`
 	OldNonce        string   `json:"old_nonce"`
+	// Choices — отметки вариантов бюллетеня с выбором нескольких вариантов;
+	// в этом случае ZKPProof*Vec доказывают допустимость числа отмеченных вариантов
+	Choices []BallotChoiceData `json:"choices"`
+	// Weight — вес бюллетеня из учетных данных голосующего; подпись проверяется ключом этого веса
+	Weight uint64 `json:"weight,omitempty"`
 }
 
 type BallotResponseData struct {
@@ -44,6 +56,22 @@ func addPadding(s string) string {
 	return s
 }
 
+// loadOptionsCount возвращает количество вариантов ответа голосования
+func loadOptionsCount(ctx context.Context, db *pgxpool.Pool, votingID int) (int, error) {
+	var count int
+	err := db.QueryRow(ctx, "SELECT COUNT(*) FROM voting_options WHERE voting_id = $1", votingID).Scan(&count)
+	return count, err
+}
+
+// buildValidMessages строит допустимые открытые тексты 2^(base*i) для каждого из count вариантов
+func buildValidMessages(base uint, count int) []*bigint.BigInt {
+	validMessages := make([]*bigint.BigInt, count)
+	for i := 0; i < count; i++ {
+		validMessages[i] = bigint.NewBigIntFromInt(1).Lsh(base * uint(i))
+	}
+	return validMessages
+}
+
 func SubmitVote(w http.ResponseWriter, r *http.Request) {
 	log := logger.GetLogger()
 	log.Info().Msg("Requested vote submission")
@@ -96,7 +124,9 @@ func SubmitVote(w http.ResponseWriter, r *http.Request) {
 	}
 
 	votingIDStr := fmt.Sprintf("%d", data.VotingID)
-	if ballot.Gt(config.CryptoParams[votingIDStr].RSA.N) {
+	// Шифротекст лежит в Z_(n^(s+1)); для Paillier s = 1
+	_, ciphertextModulus := zkp.Moduli(config.CryptoParams[votingIDStr].Paillier.N, config.CryptoParams[votingIDStr].S())
+	if ballot.Ge(ciphertextModulus) {
 		w.WriteHeader(http.StatusBadRequest)
 		err = json.NewEncoder(w).Encode(BallotResponseData{
 			Success: false,
@@ -106,7 +136,7 @@ func SubmitVote(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusInternalServerError)
 			log.Error().Err(err).Msg("Error sending response")
 		}
-		log.Error().Err(err).Str("ballot", ballot.ToBase64()).Str("n", config.CryptoParams[votingIDStr].RSA.N.ToBase64()).Msg("Found ballot is greater than n")
+		log.Error().Err(err).Str("ballot", ballot.ToBase64()).Str("modulus", ciphertextModulus.ToBase64()).Msg("Found ballot is not less than ciphertext modulus")
 		return
 	}
 
@@ -176,11 +206,31 @@ func SubmitVote(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Подпись ключом класса веса удостоверяет вес бюллетеня
+	if data.Weight == 0 {
+		data.Weight = 1
+	}
+	rsaN, rsaE, _, err := config.CryptoParams[votingIDStr].SigningKey(data.Weight)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		err = json.NewEncoder(w).Encode(BallotResponseData{
+			Success: false,
+			Message: "Неизвестный вес бюллетеня",
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error().Err(err).Msg("Error sending response")
+		}
+		log.Error().Uint64("weight", data.Weight).Msg("No signing key for ballot weight")
+		return
+	}
+
 	var isReVoted bool = false
 	var oldLabel *bigint.BigInt = nil
+	var oldNonce *bigint.BigInt = nil
 
-	if !bs.Verify(label, signature, config.CryptoParams[votingIDStr].RSA.E, config.CryptoParams[votingIDStr].RSA.N) {
-		if !bs.Verify(label.Mul(bigint.NewBigIntFromUint(config.CryptoParams[votingIDStr].ReVotingMultiplier)), signature, config.CryptoParams[votingIDStr].RSA.E, config.CryptoParams[votingIDStr].RSA.N) {
+	if !bs.Verify(label, signature, rsaE, rsaN) {
+		if !bs.Verify(label.Mul(bigint.NewBigIntFromUint(config.CryptoParams[votingIDStr].ReVotingMultiplier)), signature, rsaE, rsaN) {
 
 			w.WriteHeader(http.StatusBadRequest)
 			err = json.NewEncoder(w).Encode(BallotResponseData{
@@ -193,8 +243,8 @@ func SubmitVote(w http.ResponseWriter, r *http.Request) {
 			}
 			log.Error().Msg("signature: " + signature.ToBase64())
 			log.Error().Msg("ballot: " + label.ToBase64())
-			log.Error().Msg("e: " + config.CryptoParams[votingIDStr].RSA.E.ToBase64())
-			log.Error().Msg("n: " + config.CryptoParams[votingIDStr].RSA.N.ToBase64())
+			log.Error().Msg("e: " + rsaE.ToBase64())
+			log.Error().Msg("n: " + rsaN.ToBase64())
 			return
 		} else {
 			log.Error().Msg("Re-voted signature verified")
@@ -230,7 +280,7 @@ func SubmitVote(w http.ResponseWriter, r *http.Request) {
 				log.Error().Msg("Error parsing old label")
 				return
 			}
-			oldNonce, err := bigint.NewBigIntFromBase64(bigint.AddBase64Padding(data.OldNonce))
+			oldNonce, err = bigint.NewBigIntFromBase64(bigint.AddBase64Padding(data.OldNonce))
 			if err != nil {
 				w.WriteHeader(http.StatusBadRequest)
 				err = json.NewEncoder(w).Encode(BallotResponseData{
@@ -315,108 +365,201 @@ func SubmitVote(w http.ResponseWriter, r *http.Request) {
 	log.Info().Msg("Signature verified")
 	log.Info().Msg("ZKP format verification started")
 
-	zkpProofEVec := make([]*bigint.BigInt, len(data.ZKPProofEVec))
-	zkpProofZVec := make([]*bigint.BigInt, len(data.ZKPProofZVec))
-	zkpProofAVec := make([]*bigint.BigInt, len(data.ZKPProofAVec))
+	// Количество вариантов и тип бюллетеня определяет Счетчик, а не клиент
+	optionsCount, err := loadOptionsCount(ctx, db, data.VotingID)
+	var votingType string
+	var maxChoices int
+	var base uint
+	if err == nil {
+		votingType, maxChoices, err = loadVotingType(ctx, db, data.VotingID)
+	}
+	if err == nil {
+		base, err = loadVotingBase(ctx, db, data.VotingID)
+	}
+	if err != nil || optionsCount == 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+		err = json.NewEncoder(w).Encode(BallotResponseData{
+			Success: false,
+			Message: "Ошибка при получении вариантов ответа",
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error().Err(err).Msg("Error sending response")
+		}
+		log.Error().Err(err).Msg("Error getting voting options count")
+		return
+	}
 
-	for i, e := range data.ZKPProofEVec {
-		zkpProofEVec[i], err = bigint.NewBigIntFromBase64(bigint.AddBase64Padding(e))
+	jsonedProof, message, proofErr := verifyBallotProof(&data, ballot, label, votingType, maxChoices, optionsCount, base)
+	if proofErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		err = json.NewEncoder(w).Encode(BallotResponseData{
+			Success: false,
+			Message: message,
+		})
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			err = json.NewEncoder(w).Encode(BallotResponseData{
-				Success: false,
-				Message: "Ошибка при парсинге ZKP proof E вектора",
-			})
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				log.Error().Err(err).Msg("Error sending response")
-			}
-			log.Error().Err(err).Msg("Error parsing ZKP proof E vector")
-			return
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error().Err(err).Msg("Error sending response")
 		}
+		log.Error().Err(proofErr).Str("voting_type", votingType).Msg("Error verifying ZKP proof")
+		return
 	}
 
-	for i, z := range data.ZKPProofZVec {
-		zkpProofZVec[i], err = bigint.NewBigIntFromBase64(bigint.AddBase64Padding(z))
+	log.Info().Msg("ZKP format verified")
+
+	// Списание учетных данных, удаление старого бюллетеня и добавление нового — одна транзакция
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		err = json.NewEncoder(w).Encode(BallotResponseData{
+			Success: false,
+			Message: "Ошибка при добавлении бюллетеня",
+		})
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error().Err(err).Msg("Error sending response")
+		}
+		log.Error().Err(err).Msg("Failed to start transaction")
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	err = spendCredential(ctx, tx, data.VotingID, label, signature)
+	if errors.Is(err, ErrCredentialAlreadyUsed) {
+		w.WriteHeader(http.StatusConflict)
+		err = json.NewEncoder(w).Encode(BallotResponseData{
+			Success: false,
+			Message: "Подпись или метка бюллетеня уже использованы",
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error().Err(err).Msg("Error sending response")
+		}
+		log.Error().Str("label", label.ToBase64()).Msg("Credential already used")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		err = json.NewEncoder(w).Encode(BallotResponseData{
+			Success: false,
+			Message: "Ошибка при проверке учетных данных",
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			log.Error().Err(err).Msg("Error sending response")
+		}
+		log.Error().Err(err).Msg("Error spending credential")
+		return
+	}
+
+	if isReVoted {
+		//Удаляем старый бюллетень
+		log.Info().Msg("Deleting old ballot")
+		tag, err := tx.Exec(ctx,
+			"DELETE FROM encrypted_votes WHERE voting_id = $1 AND label = $2",
+			data.VotingID,
+			oldLabel.ToBase64(),
+		)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
 			err = json.NewEncoder(w).Encode(BallotResponseData{
 				Success: false,
-				Message: "Ошибка при парсинге ZKP proof Z вектора",
+				Message: "Ошибка при удалении старого бюллетеня",
 			})
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				log.Error().Err(err).Msg("Error sending response")
 			}
-			log.Error().Err(err).Msg("Error parsing ZKP proof Z vector")
+			log.Error().Err(err).Msg("Error deleting old ballot")
 			return
 		}
-	}
-
-	for i, a := range data.ZKPProofAVec {
-		zkpProofAVec[i], err = bigint.NewBigIntFromBase64(bigint.AddBase64Padding(a))
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+		// Старый бюллетень мог быть заменен параллельным запросом
+		if tag.RowsAffected() == 0 {
+			w.WriteHeader(http.StatusConflict)
 			err = json.NewEncoder(w).Encode(BallotResponseData{
 				Success: false,
-				Message: "Ошибка при парсинге ZKP proof A вектора",
+				Message: "Старый бюллетень уже заменен",
 			})
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				log.Error().Err(err).Msg("Error sending response")
 			}
-			log.Error().Err(err).Msg("Error parsing ZKP proof A vector")
+			log.Error().Msg("Old ballot already replaced")
 			return
 		}
+		log.Info().Msg("Old ballot deleted")
 	}
 
-	validMessages := make([]*bigint.BigInt, len(data.ZKPProofEVec))
-
-	for i := range data.ZKPProofEVec {
-		validMessages[i] = bigint.NewBigIntFromInt(int64(2)).Pow(bigint.NewBigIntFromInt(int64(int(config.CryptoParams[votingIDStr].Base) * i)))
-	}
-
-	zkp := zkp.NewCorrectMessageProof(zkpProofEVec, zkpProofZVec, zkpProofAVec, ballot, validMessages, config.CryptoParams[votingIDStr].Paillier.N, config.CryptoParams[votingIDStr].ChallengeBits)
-	err = zkp.Verify()
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+	// Счетчик не принимает бюллетени сверх ёмкости счетчиков: иначе итог молча перенесётся в соседний вариант
+	if capacityErr := checkBoardCapacity(ctx, tx, data.VotingID, data.Weight, votingType, maxChoices, base); capacityErr != nil {
+		status, message := http.StatusInternalServerError, "Ошибка при проверке ёмкости счетчиков"
+		if errors.Is(capacityErr, ErrBoardFull) {
+			status, message = http.StatusConflict, "Голосование приняло наибольшее число бюллетеней, которое вмещают счетчики"
+		}
+		w.WriteHeader(status)
 		err = json.NewEncoder(w).Encode(BallotResponseData{
 			Success: false,
-			Message: "Ошибка при верификации ZKP proof: " + err.Error(),
+			Message: message,
 		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			log.Error().Err(err).Msg("Error sending response")
 		}
-		log.Error().Err(err).Msg("Error verifying ZKP proof")
+		log.Error().Err(capacityErr).Uint64("weight", data.Weight).Uint("base", base).Msg("Ballot rejected by counter capacity check")
 		return
 	}
 
-	log.Info().Msg("ZKP format verified")
-
-	if isReVoted {
-		//Посылаем запрос на удаление старого бюллетеня
-		log.Info().Msg("Deleting old ballot")
-		_, err = db.Exec(ctx,
-			"DELETE FROM encrypted_votes WHERE voting_id = $1 AND label = $2",
-			data.VotingID,
-			oldLabel.ToBase64(),
+	// Доказательство и подпись публикуются вместе с бюллетенем для повторной проверки
+	entry := models.BallotLogEntry{
+		VotingID:      data.VotingID,
+		Label:         bigint.AddBase64Padding(label.ToBase64()),
+		EncryptedVote: bigint.AddBase64Padding(ballot.ToBase64()),
+		ZKPProof:      string(jsonedProof),
+		Signature:     bigint.AddBase64Padding(signature.ToBase64()),
+		Weight:        data.Weight,
+		CreatedAt:     time.Now(),
+	}
+	if err == nil {
+		_, err = tx.Exec(ctx,
+			"INSERT INTO encrypted_votes (voting_id, label, encrypted_vote, zkp_proof, signature, weight, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			entry.VotingID,
+			entry.Label,
+			entry.EncryptedVote,
+			entry.ZKPProof,
+			entry.Signature,
+			entry.Weight,
+			entry.CreatedAt,
 		)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Error().Err(err).Msg("Error sending response")
+	}
+	if err == nil {
+		// Бюллетень попадает и в журнал; замененный бюллетень остаётся в журнале с отметкой replaced_by
+		replacedLabel := ""
+		if isReVoted {
+			replacedLabel = oldLabel.ToBase64()
 		}
-		log.Error().Err(err).Msg("Error deleting old ballot")
-		log.Info().Msg("Old ballot deleted")
+		_, err = ballotlog.Append(ctx, tx, entry, replacedLabel)
+	}
+	if err == nil && isReVoted {
+		// Раскрытый nonce публикуется, чтобы наблюдатели могли проверить, что бюллетень заменил его владелец
+		revote := models.Revote{
+			VotingID:  data.VotingID,
+			OldLabel:  oldLabel.ToBase64(),
+			OldNonce:  bigint.AddBase64Padding(oldNonce.ToBase64()),
+			NewLabel:  entry.Label,
+			CreatedAt: entry.CreatedAt,
+		}
+		_, err = tx.Exec(ctx,
+			"INSERT INTO revotes (voting_id, old_label, old_nonce, new_label, created_at) VALUES ($1, $2, $3, $4, $5)",
+			revote.VotingID,
+			revote.OldLabel,
+			revote.OldNonce,
+			revote.NewLabel,
+			revote.CreatedAt,
+		)
+	}
+	if err == nil {
+		err = tx.Commit(ctx)
 	}
-
-	_, err = db.Exec(ctx,
-		"INSERT INTO encrypted_votes (voting_id, label, encrypted_vote, created_at) VALUES ($1, $2, $3, $4)",
-		data.VotingID,
-		bigint.AddBase64Padding(label.ToBase64()),
-		bigint.AddBase64Padding(ballot.ToBase64()),
-		time.Now(),
-	)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		err = json.NewEncoder(w).Encode(BallotResponseData{
@@ -447,6 +590,14 @@ func SubmitVote(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// RoundView — раунд мгновенного второго тура с названиями вариантов
+type RoundView struct {
+	Number     int
+	Counts     map[string]int64
+	Eliminated string
+	Winner     string
+}
+
 type ResultsPageData struct {
 	Voting *models.Voting
 	Result struct {
@@ -459,9 +610,31 @@ type ResultsPageData struct {
 		ResultProof       string
 		CreatedAt         time.Time
 	}
+	Rounds               []RoundView
 	MerklieRoot          models.MerklieRoot
+	TreeHead             *merklie.TreeHead
 	PublicEncryptedVotes []models.PublicEncryptedVote
 	PaillierN            string
+	DamgardJurikS        uint
+	Threshold            *paillier.ThresholdPublicKey
+}
+
+// signedTreeHead собирает подписанный корень для проверки на странице; nil, если корень не подписан
+func signedTreeHead(votingID string, root models.MerklieRoot) *merklie.TreeHead {
+	if root.TreeSize == nil || root.SignedAt == nil || root.Signature == nil {
+		return nil
+	}
+	return &merklie.TreeHead{
+		VotingID:       votingID,
+		TreeVersion:    root.TreeVersion,
+		TreeSize:       *root.TreeSize,
+		RootValue:      root.RootValue,
+		BoardRoot:      root.BoardRoot,
+		BoardSize:      root.BoardSize,
+		RevocationRoot: root.RevocationRoot,
+		Timestamp:      *root.SignedAt,
+		Signature:      *root.Signature,
+	}
 }
 
 func ShowResultsPage(w http.ResponseWriter, r *http.Request, votingID string) {
@@ -471,7 +644,7 @@ func ShowResultsPage(w http.ResponseWriter, r *http.Request, votingID string) {
 	db := database.GetCounterPGConnection()
 	ctx := context.Background()
 
-	rows, err := db.Query(ctx, "SELECT * FROM votings WHERE id = $1", votingID)
+	rows, err := db.Query(ctx, "SELECT id, name, question, state, voting_type, max_choices, start_time, audit_time, end_time FROM votings WHERE id = $1", votingID)
 	if err != nil {
 		log.Error().Err(err).Msg("Error getting votings")
 		return
@@ -482,7 +655,7 @@ func ShowResultsPage(w http.ResponseWriter, r *http.Request, votingID string) {
 
 	if rows.Next() {
 		voting = &models.Voting{}
-		err = rows.Scan(&voting.ID, &voting.Name, &voting.Question, &voting.State, &voting.StartTime, &voting.AuditTime, &voting.EndTime)
+		err = rows.Scan(&voting.ID, &voting.Name, &voting.Question, &voting.State, &voting.Type, &voting.MaxChoices, &voting.StartTime, &voting.AuditTime, &voting.EndTime)
 		if err != nil {
 			log.Error().Err(err).Msg("Error scanning votings")
 		}
@@ -509,7 +682,7 @@ func ShowResultsPage(w http.ResponseWriter, r *http.Request, votingID string) {
 
 	rows.Close()
 
-	rows, err = db.Query(ctx, "SELECT * FROM results WHERE voting_id = $1", votingID)
+	rows, err = db.Query(ctx, "SELECT id, voting_id, corresponds_to_merklie_root, crypted_result, unencrypted_result, resulted_count, result_proof, rounds, created_at FROM results WHERE voting_id = $1", votingID)
 	if err != nil {
 		log.Error().Err(err).Msg("Error getting results")
 		return
@@ -533,9 +706,10 @@ func ShowResultsPage(w http.ResponseWriter, r *http.Request, votingID string) {
 	integeredResult := map[int]int64{}
 
 	var jsonedResultedCount string
+	var jsonedRounds *string
 
 	if rows.Next() {
-		err = rows.Scan(&result.ID, &result.VotingID, &result.MerklieRootID, &result.CryptedResult, &result.UnencryptedResult, &jsonedResultedCount, &result.ResultProof, &result.CreatedAt)
+		err = rows.Scan(&result.ID, &result.VotingID, &result.MerklieRootID, &result.CryptedResult, &result.UnencryptedResult, &jsonedResultedCount, &result.ResultProof, &jsonedRounds, &result.CreatedAt)
 		if err != nil {
 			log.Error().Err(err).Msg("Error scanning results")
 		}
@@ -556,6 +730,13 @@ func ShowResultsPage(w http.ResponseWriter, r *http.Request, votingID string) {
 	log.Info().Msg("result.CryptedResult: " + result.CryptedResult)
 	log.Info().Msg("result.ResultProof: " + result.ResultProof)
 
+	optionNames := make(map[int]string, len(votingOptions))
+	for _, option := range votingOptions {
+		optionNames[option.OptionIndex] = option.OptionText
+	}
+
+	rounds := []RoundView{}
+
 	for _, option := range votingOptions {
 
 		if val, ok := integeredResult[option.OptionIndex]; ok {
@@ -565,9 +746,31 @@ func ShowResultsPage(w http.ResponseWriter, r *http.Request, votingID string) {
 		}
 	}
 
+	// У ранжированного голосования итог по вариантам — голоса первого раунда, а победителя определяют раунды
+	if voting != nil && voting.IsRanked() && jsonedRounds != nil {
+		tallyRounds := []tally.Round{}
+		err = json.Unmarshal([]byte(*jsonedRounds), &tallyRounds)
+		if err != nil {
+			log.Error().Err(err).Msg("Error unmarshalling rounds")
+		}
+		for i, round := range tallyRounds {
+			view := RoundView{Number: i + 1, Counts: make(map[string]int64, len(round.Counts))}
+			for option, count := range round.Counts {
+				view.Counts[optionNames[option]] = count
+			}
+			if round.Eliminated != nil {
+				view.Eliminated = optionNames[*round.Eliminated]
+			}
+			if round.Winner != nil {
+				view.Winner = optionNames[*round.Winner]
+			}
+			rounds = append(rounds, view)
+		}
+	}
+
 	log.Info().Msg("result.ResultedCount: " + fmt.Sprintf("%v", result.ResultedCount))
 
-	rows, err = db.Query(ctx, "SELECT * FROM merklie_roots WHERE id = $1", result.MerklieRootID)
+	rows, err = db.Query(ctx, "SELECT id, voting_id, root_value, created_at, tree_version, tree_size, signed_at, signature, board_root, board_size, revocation_root FROM merklie_roots WHERE id = $1", result.MerklieRootID)
 	if err != nil {
 		log.Error().Err(err).Msg("Error getting merklie roots")
 		return
@@ -577,14 +780,14 @@ func ShowResultsPage(w http.ResponseWriter, r *http.Request, votingID string) {
 	merklieRoot := models.MerklieRoot{}
 
 	if rows.Next() {
-		err = rows.Scan(&merklieRoot.ID, &merklieRoot.VotingID, &merklieRoot.RootValue, &merklieRoot.CreatedAt)
+		err = rows.Scan(&merklieRoot.ID, &merklieRoot.VotingID, &merklieRoot.RootValue, &merklieRoot.CreatedAt, &merklieRoot.TreeVersion, &merklieRoot.TreeSize, &merklieRoot.SignedAt, &merklieRoot.Signature, &merklieRoot.BoardRoot, &merklieRoot.BoardSize, &merklieRoot.RevocationRoot)
 		if err != nil {
 			log.Error().Err(err).Msg("Error scanning merklie roots")
 		}
 	}
 	rows.Close()
 
-	rows, err = db.Query(ctx, "SELECT * FROM public_encrypted_votes WHERE voting_id = $1 AND corresponds_to_merklie_root = $2", votingID, result.MerklieRootID)
+	rows, err = db.Query(ctx, "SELECT voting_id, label, corresponds_to_merklie_root, encrypted_vote, zkp_proof, signature, weight, created_at, moved_into_at FROM public_encrypted_votes WHERE voting_id = $1 AND corresponds_to_merklie_root = $2", votingID, result.MerklieRootID)
 	if err != nil {
 		log.Error().Err(err).Msg("Error getting public encrypted votes")
 		return
@@ -595,7 +798,7 @@ func ShowResultsPage(w http.ResponseWriter, r *http.Request, votingID string) {
 
 	for rows.Next() {
 		var publicEncryptedVote models.PublicEncryptedVote
-		err = rows.Scan(&publicEncryptedVote.VotingID, &publicEncryptedVote.Label, &publicEncryptedVote.CorrespondsToMerklieRootID, &publicEncryptedVote.EncryptedVote, &publicEncryptedVote.CreatedAt, &publicEncryptedVote.MovedIntoAt)
+		err = rows.Scan(&publicEncryptedVote.VotingID, &publicEncryptedVote.Label, &publicEncryptedVote.CorrespondsToMerklieRootID, &publicEncryptedVote.EncryptedVote, &publicEncryptedVote.ZKPProof, &publicEncryptedVote.Signature, &publicEncryptedVote.Weight, &publicEncryptedVote.CreatedAt, &publicEncryptedVote.MovedIntoAt)
 		if err != nil {
 			log.Error().Err(err).Msg("Error scanning public encrypted votes")
 		}
@@ -609,9 +812,13 @@ func ShowResultsPage(w http.ResponseWriter, r *http.Request, votingID string) {
 	render.RenderTemplate(w, "results", ResultsPageData{
 		Voting:               voting,
 		Result:               result,
+		Rounds:               rounds,
 		MerklieRoot:          merklieRoot,
+		TreeHead:             signedTreeHead(votingID, merklieRoot),
 		PublicEncryptedVotes: publicEncryptedVotes,
 		PaillierN:            bigint.AddBase64Padding(config.CryptoParams[votingID].Paillier.N.ToBase64()),
+		DamgardJurikS:        config.CryptoParams[votingID].S(),
+		Threshold:            config.CryptoParams[votingID].Threshold,
 	})
 
 }
@@ -644,7 +851,7 @@ func CalculateVoting(w http.ResponseWriter, r *http.Request, votingID string) {
 
 	rows.Close()
 
-	rows, err = db.Query(ctx, "SELECT * FROM encrypted_votes WHERE voting_id = $1", votingID)
+	rows, err = db.Query(ctx, "SELECT voting_id, label, encrypted_vote, zkp_proof, signature, weight, created_at FROM encrypted_votes WHERE voting_id = $1 ORDER BY created_at, label", votingID)
 	if err != nil {
 		log.Error().Err(err).Msg("Error getting encrypted votes")
 		return
@@ -655,7 +862,7 @@ func CalculateVoting(w http.ResponseWriter, r *http.Request, votingID string) {
 
 	for rows.Next() {
 		var encryptedVote models.EncryptedVote
-		err = rows.Scan(&encryptedVote.VotingID, &encryptedVote.Label, &encryptedVote.EncryptedVote, &encryptedVote.CreatedAt)
+		err = rows.Scan(&encryptedVote.VotingID, &encryptedVote.Label, &encryptedVote.EncryptedVote, &encryptedVote.ZKPProof, &encryptedVote.Signature, &encryptedVote.Weight, &encryptedVote.CreatedAt)
 		if err != nil {
 			log.Error().Err(err).Msg("Error scanning encrypted votes")
 		}
@@ -663,17 +870,10 @@ func CalculateVoting(w http.ResponseWriter, r *http.Request, votingID string) {
 	}
 
 	rows.Close()
-	merkleTree := merklie.NewMerkleTree()
-
-	// Добавляем голоса в дерево
-	for _, vote := range encryptedVotes {
-		merkleTree.AddLeaf(vote.EncryptedVote)
-	}
-
-	// Получаем корень дерева
-	rootHash := merkleTree.GetRoot()
 
 	cryptoValues := []*bigint.BigInt{}
+	weights := []uint64{}
+	var totalWeight uint64
 
 	for _, vote := range encryptedVotes {
 		encryptedVoteBigint, err := bigint.NewBigIntFromBase64(bigint.AddBase64Padding(vote.EncryptedVote))
@@ -682,63 +882,172 @@ func CalculateVoting(w http.ResponseWriter, r *http.Request, votingID string) {
 			return
 		}
 		cryptoValues = append(cryptoValues, encryptedVoteBigint)
+		weights = append(weights, vote.Weight)
+		totalWeight += vote.Weight
 	}
 
-	sum := paillier.CountSum(cryptoValues, config.CryptoParams[votingID].Paillier.N)
+	// Каждый бюллетень входит в сумму с весом, удостоверенным подписью Регистратора
+	params := config.CryptoParams[votingID]
+	sum := paillier.CountWeightedSumDJ(cryptoValues, weights, params.Paillier.N, params.S())
 
-	decryptedSum, err := paillier.Decrypt(sum, config.CryptoParams[votingID].Paillier.N.Add(bigint.NewBigIntFromInt(1)), config.CryptoParams[votingID].Paillier.Lambda, config.CryptoParams[votingID].Paillier.N)
+	votingType, maxChoices, err := loadVotingType(ctx, db, votingID)
 	if err != nil {
-		log.Error().Err(err).Msg("Error decrypting sum")
+		log.Error().Err(err).Msg("Error getting voting type")
+		return
+	}
+	base, err := loadVotingBase(ctx, db, votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting voting counter size")
 		return
 	}
 
-	binaryString := decryptedSum.ToBinaryString()
-	base64result := bigint.AddBase64Padding(decryptedSum.ToBase64())
 	base64sum := bigint.AddBase64Padding(sum.ToBase64())
 
-	log.Info().Msg("Decrypted sum: " + binaryString)
+	var base64result string
+	var proof_string string
+	var numbers []int64
+	var ballots []tally.Ballot
 
-	chunks := decryptedSum.SplitIntoChunks(uint(config.CryptoParams[votingID].Base))
-	//экививалентно следующему коду
-	/*
-			if chunkSize == 0 {
-			return nil
+	if votingType == models.VotingTypeRanked {
+		// Сумма ранжированных бюллетеней не расшифровывается: она лишь фиксирует набор бюллетеней,
+		// а расшифровываются перемешанные бюллетени, не связанные с метками
+		proof, waiting, err := tallyRanked(ctx, db, votingID, sum)
+		if err != nil {
+			log.Error().Err(err).Msg("Error tallying ranked ballots")
+			return
+		}
+		if waiting {
+			log.Info().Msg("Waiting for trustees' partial decryptions of shuffled ballots")
+			err = json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "Ожидаются частичные расшифрования доверенных лиц",
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("Error sending response")
+			}
+			return
 		}
 
-		var chunks []*BigInt
-		tmp := a.Copy()
-		mask := NewBigIntFromUint(1).Lsh(chunkSize).Sub(NewBigIntFromUint(1)) // Маска: (1 << chunkSize) - 1
+		ballots, err = proof.Ballots(base, len(votingOptions))
+		if err != nil {
+			log.Error().Err(err).Uint("base", base).Msg("Shuffled ballots do not decode into rankings")
+			err = json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "Перемешанные бюллетени не раскладываются на ранжирования",
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("Error sending response")
+			}
+			return
+		}
 
-		for tmp.bn.Sign() != 0 { // Пока число не стало нулём
-			chunk := tmp.And(mask) // Берём младшие chunkSize бит
-			chunks = append(chunks, chunk)
-			tmp = tmp.Rsh(chunkSize) // Сдвигаем вправо на chunkSize бит
+		// Итог по вариантам — голоса первого раунда
+		firstPreferences := tally.FirstPreferences(len(votingOptions), ballots)
+		numbers = make([]int64, len(votingOptions))
+		for o := range numbers {
+			numbers[o] = firstPreferences[o]
 		}
 
-		return chunks*/
+		jsonedProof, err := json.Marshal(proof)
+		if err != nil {
+			log.Error().Err(err).Msg("Error marshalling ranked result proof")
+			return
+		}
+		proof_string = string(jsonedProof)
+	} else {
+		var decryptedSum *bigint.BigInt
 
-	numbers := []int64{}
+		if threshold := config.CryptoParams[votingID].Threshold; threshold != nil {
+			// Ключ разделён между доверенными лицами - расшифровываем только при наличии порога
+			partials, err := loadPartialDecryptions(ctx, db, votingID, sum)
+			if err != nil {
+				log.Error().Err(err).Msg("Error getting partial decryptions")
+				return
+			}
 
-	for _, chunk := range chunks {
-		numbers = append(numbers, chunk.Int64())
-	}
+			if len(partials) < threshold.Threshold {
+				log.Info().
+					Int("partials", len(partials)).
+					Int("threshold", threshold.Threshold).
+					Msg("Waiting for trustees' partial decryptions")
+				err = json.NewEncoder(w).Encode(map[string]interface{}{
+					"success": false,
+					"message": "Ожидаются частичные расшифрования доверенных лиц",
+				})
+				if err != nil {
+					log.Error().Err(err).Msg("Error sending response")
+				}
+				return
+			}
 
-	log.Info().Msg("Numbers: " + fmt.Sprintf("%v", numbers))
+			partials = partials[:threshold.Threshold]
+			decryptedSum, err = paillier.CombinePartialDecryptions(threshold, partials)
+			if err != nil {
+				log.Error().Err(err).Msg("Error combining partial decryptions")
+				return
+			}
 
-	for len(votingOptions) != len(numbers) {
-		numbers = append(numbers, 0)
-	}
+			jsonedPartials, err := json.Marshal(partials)
+			if err != nil {
+				log.Error().Err(err).Msg("Error marshalling partial decryptions")
+				return
+			}
+			proof_string = string(jsonedPartials)
+		} else {
+			// При s = 1 схема Дамгорда–Юрика совпадает с Paillier
+			decryptedSum, err = paillier.DecryptDJ(sum, params.Paillier.Lambda, params.Paillier.N, params.S())
+			if err != nil {
+				log.Error().Err(err).Msg("Error decrypting sum")
+				return
+			}
+
+			proof, err := paillier.ProveDecryptionDJ(sum, decryptedSum, params.Paillier.Lambda, params.Paillier.N, params.S())
+			if err != nil {
+				log.Error().Err(err).Msg("Error creating decryption proof")
+				return
+			}
 
-	// for _, number := range numbers {
-	// 	if number > int64(len(votingOptions)) {
-	// 		log.Error().Msg("Number is greater than the number of voting options")
-	// 		return
-	// 	}
-	// }
+			jsonedProof, err := json.Marshal(proof)
+			if err != nil {
+				log.Error().Err(err).Msg("Error marshalling decryption proof")
+				return
+			}
+			proof_string = string(jsonedProof)
+		}
+
+		binaryString := decryptedSum.ToBinaryString()
+		base64result = bigint.AddBase64Padding(decryptedSum.ToBase64())
+
+		log.Info().Msg("Decrypted sum: " + binaryString)
+
+		numbers, err = tally.DecodeCounts(decryptedSum, base, len(votingOptions))
+		if err != nil {
+			log.Error().Err(err).Uint("base", base).Msg("Decrypted sum does not decode into option counters")
+			err = json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "Расшифрованная сумма не раскладывается на счетчики вариантов",
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("Error sending response")
+			}
+			return
+		}
+	}
 
 	log.Info().Msg("Numbers: " + fmt.Sprintf("%v", numbers))
 
-	log.Info().Msg("Root hash: " + rootHash)
+	// Итоги должны быть возможны для принятых бюллетеней: иначе счётчики вариантов переполнили разряды
+	if err = record.CheckCounts(votingType, maxChoices, numbers, totalWeight); err != nil {
+		log.Error().Err(err).Str("voting_type", votingType).Msg("Decrypted counts are inconsistent with accepted ballots")
+		err = json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Итоги не соответствуют числу принятых бюллетеней",
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Error sending response")
+		}
+		return
+	}
 
 	tx, err := db.Begin(ctx)
 	if err != nil {
@@ -749,11 +1058,41 @@ func CalculateVoting(w http.ResponseWriter, r *http.Request, votingID string) {
 		return
 	}
 
+	// Повторный подсчет той же зашифрованной суммы (например, от нескольких доверенных лиц сверх
+	// порога) не публикует второй итог: подсчеты сериализуются блокировкой голосования
+	if _, err = tx.Exec(ctx, "SELECT id FROM votings WHERE id = $1 FOR UPDATE", votingID); err != nil {
+		tx.Rollback(ctx)
+		log.Error().Err(err).Str("voting_id", votingID).Msg("Failed to lock voting")
+		return
+	}
+	var published bool
+	err = tx.QueryRow(ctx,
+		"SELECT EXISTS(SELECT 1 FROM results WHERE voting_id = $1 AND crypted_result = $2)",
+		votingID,
+		base64sum,
+	).Scan(&published)
+	if err != nil {
+		tx.Rollback(ctx)
+		log.Error().Err(err).Str("voting_id", votingID).Msg("Failed to check published results")
+		return
+	}
+	if published {
+		tx.Rollback(ctx)
+		log.Info().Str("voting_id", votingID).Msg("Results for this encrypted sum are already published")
+		err = json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Results already calculated",
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Error sending response")
+		}
+		return
+	}
+
 	currentTime := time.Now()
 
-	// Сохраняем корень в базу данных
-	var insertedID int64
-	err = tx.QueryRow(ctx, "INSERT INTO merklie_roots (voting_id, root_value, created_at) VALUES ($1, $2, $3) RETURNING id", votingID, rootHash, currentTime).Scan(&insertedID)
+	// Итог привязывается к корню всего журнала бюллетеней
+	insertedID, rootHash, treeSize, err := ballotlog.PublishRoot(ctx, tx, votingID, currentTime)
 	if err != nil {
 		tx.Rollback(ctx)
 		log.Error().
@@ -763,25 +1102,37 @@ func CalculateVoting(w http.ResponseWriter, r *http.Request, votingID string) {
 		return
 	}
 
-	for _, vote := range encryptedVotes {
-		_, err = tx.Exec(ctx, "INSERT INTO public_encrypted_votes (voting_id, label, corresponds_to_merklie_root, encrypted_vote, created_at, moved_into_at) VALUES ($1, $2, $3, $4, $5, $6)",
-			vote.VotingID, vote.Label, insertedID, vote.EncryptedVote, vote.CreatedAt, currentTime)
-		if err != nil {
-			tx.Rollback(ctx)
-			log.Error().
-				Err(err).
-				Str("voting_id", votingID).
-				Msg("Failed to insert vote into public_encrypted_votes")
-			return
-		}
-	}
+	log.Info().Int("tree_size", treeSize).Msg("Root hash: " + rootHash)
 
 	//Вставка результатов голосования в базу данных
 
 	mapResult := make(map[int]int64)
 
-	for _, option := range votingOptions {
-		mapResult[option.OptionIndex] = numbers[option.OptionIndex]
+	var jsonedRounds *string
+	if votingType == models.VotingTypeRanked {
+		// Раунды мгновенного второго тура считаются по расшифрованным перемешанным бюллетеням
+		for i := range numbers {
+			mapResult[i] = numbers[i]
+		}
+
+		rounds, err := tally.InstantRunoff(len(votingOptions), ballots)
+		if err != nil {
+			tx.Rollback(ctx)
+			log.Error().Err(err).Msg("Error running instant runoff")
+			return
+		}
+		jsoned, err := json.Marshal(rounds)
+		if err != nil {
+			tx.Rollback(ctx)
+			log.Error().Err(err).Msg("Error marshalling rounds")
+			return
+		}
+		roundsString := string(jsoned)
+		jsonedRounds = &roundsString
+	} else {
+		for _, option := range votingOptions {
+			mapResult[option.OptionIndex] = numbers[option.OptionIndex]
+		}
 	}
 
 	jsonedResult, err := json.Marshal(mapResult)
@@ -790,18 +1141,16 @@ func CalculateVoting(w http.ResponseWriter, r *http.Request, votingID string) {
 		return
 	}
 
-	proof := paillier.CreateValueVerify(sum, config.CryptoParams[votingID].Paillier.Lambda, config.CryptoParams[votingID].Paillier.N)
-	proof_string := bigint.AddBase64Padding(proof.ToBase64())
-
 	log.Info().Msg("proof_string: " + proof_string)
 
-	_, err = tx.Exec(ctx, "INSERT INTO results (voting_id, corresponds_to_merklie_root, crypted_result, unencrypted_result, resulted_count, result_proof, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+	_, err = tx.Exec(ctx, "INSERT INTO results (voting_id, corresponds_to_merklie_root, crypted_result, unencrypted_result, resulted_count, result_proof, rounds, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
 		votingID,
 		insertedID,
 		base64sum,
 		base64result,
 		string(jsonedResult),
 		proof_string,
+		jsonedRounds,
 		currentTime,
 	)
 	if err != nil {
@@ -872,149 +1221,58 @@ func TrackVoting(w http.ResponseWriter, r *http.Request, votingID, trackingValue
 	}
 	defer rows.Close()
 
-	rows, err = db.Query(ctx, "SELECT mr.id, mr.root_value, mr.created_at FROM merklie_roots mr JOIN public_encrypted_votes pev ON mr.id = pev.corresponds_to_merklie_root WHERE pev.label = $1 ORDER BY mr.created_at DESC LIMIT 1", trackingValue)
-	if err != nil {
-		log.Error().Err(err).Msg("Error getting merklie roots")
-		http.Error(w, "Error getting merklie roots", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	if !rows.Next() {
-		log.Error().Msg("Merklie root not found - looks like it wasn't created yet")
-		render.RenderTemplate(w, "tracking", map[string]interface{}{
-			"voting_id":           votingID,
-			"tracking_value_hash": "",
-			"found_root_hash":     "",
-			"hashes":              "[]",
-			"created_at":          "",
-			"tracking_value":      "",
-			"root_found":          false,
-		})
-		return
-	}
-
-	var merklieRootID int64
-	var merklieRoot string
-	var merklieRootCreatedAt time.Time
-	err = rows.Scan(&merklieRootID, &merklieRoot, &merklieRootCreatedAt)
-	if err != nil {
-		log.Error().Err(err).Msg("Error scanning merklie root")
-		http.Error(w, "Error scanning merklie root", http.StatusInternalServerError)
+	// Замененный бюллетень остаётся под старыми корнями; избирателю показывается ссылка на доказательство замены
+	var replacedBy *int
+	err = db.QueryRow(ctx, "SELECT replaced_by FROM ballot_log WHERE voting_id = $1 AND label = $2", votingID, trackingValue).Scan(&replacedBy)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Error().Err(err).Msg("Error getting ballot log entry")
+		http.Error(w, "Error getting ballot log", http.StatusInternalServerError)
 		return
 	}
 
-	rows.Close()
-
-	log.Info().Msg("Found MerklieRoot")
-
-	rows, err = db.Query(ctx, "SELECT * FROM public_encrypted_votes WHERE corresponds_to_merklie_root = $1", merklieRootID)
-	if err != nil {
-		log.Error().Err(err).Msg("Error getting public encrypted votes")
-		http.Error(w, "Error getting public encrypted votes", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	publicEncryptedVotes := []models.PublicEncryptedVote{}
-
-	for rows.Next() {
-		var publicEncryptedVote models.PublicEncryptedVote
-		err = rows.Scan(&publicEncryptedVote.VotingID, &publicEncryptedVote.Label, &publicEncryptedVote.CorrespondsToMerklieRootID, &publicEncryptedVote.EncryptedVote, &publicEncryptedVote.CreatedAt, &publicEncryptedVote.MovedIntoAt)
-		if err != nil {
-			log.Error().Err(err).Msg("Error scanning public encrypted votes")
-		}
-		publicEncryptedVotes = append(publicEncryptedVotes, publicEncryptedVote)
-	}
-
-	var trueValue string = ""
-	for _, vote := range publicEncryptedVotes {
-		if vote.Label == trackingValue {
-			trueValue = vote.EncryptedVote
-			break
+	proof, err := buildBallotProof(ctx, db, votingID, trackingValue)
+	if errors.Is(err, errBallotNotPublished) || errors.Is(err, errProofMismatch) {
+		if errors.Is(err, errBallotNotPublished) {
+			log.Error().Msg("Merklie root not found - looks like it wasn't created yet")
+		} else {
+			log.Error().Msg("Merkle proof does not match published root")
 		}
-	}
-
-	log.Info().Msg("True value: " + trueValue)
-
-	merkleTree := merklie.NewMerkleTree()
-
-	for _, vote := range publicEncryptedVotes {
-		merkleTree.AddLeaf(vote.EncryptedVote)
-	}
-	//means existing error
-	proof, ok := merkleTree.GetProof(merklie.Hash(trueValue))
-	if !ok {
-		log.Error().Msg("Error getting proof")
 		render.RenderTemplate(w, "tracking", map[string]interface{}{
-			"voting_id":           votingID,
-			"tracking_value_hash": merklie.Hash(trueValue),
-			"found_root_hash":     merklieRoot,
-			"hashes":              template.JS("[]"),
-			"created_at":          merklieRootCreatedAt.Format(time.RFC3339),
-			"tracking_value":      trueValue,
-			"root_found":          true,
-			"paillier_n":          bigint.AddBase64Padding(config.CryptoParams[votingID].Paillier.N.ToBase64()),
+			"voting_id":      votingID,
+			"root_found":     false,
+			"proof_mismatch": errors.Is(err, errProofMismatch),
+			"replaced":       replacedBy != nil,
+			"tracking_label": trackingValue,
 		})
 		return
 	}
-
-	log.Info().Msg("True value hash:  " + merklie.Hash(trueValue))
-
-	log.Info().Msg("Proof: " + fmt.Sprintf("%v", proof))
-
-	log.Info().Msg("Merklie root: " + merklieRoot)
-
-	calculatedRoot, err := merklie.CalculateRootFromProof(proof, merklie.Hash(trueValue))
-	if err != nil {
-		log.Error().Err(err).Msg("Error calculating root from proof")
-		http.Error(w, "Error calculating root from proof", http.StatusInternalServerError)
-		return
-	}
-
-	if calculatedRoot == "" {
-		calculatedRoot = merklie.Hash(trueValue)
-	}
-
-	log.Info().Msg("Calculated root: " + calculatedRoot)
-
-	if calculatedRoot != merklieRoot {
-		log.Error().Msg("Calculated root does not match merklie root")
-		return
-	}
-
-	proof2 := []merklie.MerklieTreePublicNode{}
-	if proof[0].IsRight {
-		proof2 = append(proof2, merklie.MerklieTreePublicNode{
-			Hash:    merklie.Hash(trueValue),
-			IsRight: false,
-		})
-	} else {
-		proof2 = append(proof2, merklie.MerklieTreePublicNode{
-			Hash:    merklie.Hash(trueValue),
-			IsRight: true,
-		})
-	}
-
-	proof = append(proof2, proof...)
-
-	jsonedProof, err := json.Marshal(proof)
 	if err != nil {
-		log.Error().Err(err).Msg("Error marshalling proof")
+		log.Error().Err(err).Msg("Error building ballot proof")
+		http.Error(w, "Error building ballot proof", http.StatusInternalServerError)
 		return
 	}
 
-	log.Info().Msg("Jsoned proof: " + string(jsonedProof))
+	log.Info().
+		Int64("root_id", proof.RootID).
+		Str("leaf_hash", proof.LeafHash).
+		Int("tree_size", proof.TreeSize).
+		Msg("Merkle proof verified against published root")
 
 	render.RenderTemplate(w, "tracking", map[string]interface{}{
 		"voting_id":           votingID,
-		"tracking_value_hash": merklie.Hash(trueValue),
-		"found_root_hash":     merklieRoot,
-		"hashes":              template.JS(string(jsonedProof)),
-		"created_at":          merklieRootCreatedAt.Format(time.RFC3339),
-		"tracking_value":      trueValue,
+		"tracking_value_hash": proof.LeafHash,
+		"found_root_hash":     proof.RootValue,
+		"proof":               proof.APIBallotProofData,
+		"created_at":          proof.CreatedAt.Format(time.RFC3339),
+		"tracking_value":      proof.EncryptedVote,
 		"root_found":          true,
+		"tree_version":        proof.TreeVersion,
+		"tree_head":           proof.TreeHead,
+		"zkp_proof":           proof.ZKPProof,
+		"signature":           proof.Signature,
+		"replaced":            replacedBy != nil,
+		"tracking_label":      trackingValue,
 		"paillier_n":          bigint.AddBase64Padding(config.CryptoParams[votingID].Paillier.N.ToBase64()),
+		"damgard_jurik_s":     config.CryptoParams[votingID].S(),
 	})
-
 }
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"ev/internal/config"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/paillier"
+	"ev/internal/crypto/zkp"
+	"ev/internal/database"
+	"ev/internal/logger"
+	"ev/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EncryptedSumResponseData — зашифрованная сумма для частичного расшифрования. У ранжированного
+// голосования сумма не расшифровывается: доверенные лица расшифровывают каждый шифротекст Ciphertexts
+// (выходы перемешивания) и отправляют массив частичных расшифрований в том же порядке
+type EncryptedSumResponseData struct {
+	VotingID      string   `json:"voting_id"`
+	CryptedResult string   `json:"crypted_result"`
+	Ciphertexts   []string `json:"ciphertexts,omitempty"`
+}
+
+type PartialDecryptionResponseData struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// loadEncryptedSum перемножает все принятые бюллетени голосования с учётом их весов
+func loadEncryptedSum(ctx context.Context, db *pgxpool.Pool, votingID string) (*bigint.BigInt, error) {
+	rows, err := db.Query(ctx, "SELECT encrypted_vote, weight FROM encrypted_votes WHERE voting_id = $1", votingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cryptoValues := []*bigint.BigInt{}
+	weights := []uint64{}
+	for rows.Next() {
+		var encryptedVote string
+		var weight uint64
+		if err = rows.Scan(&encryptedVote, &weight); err != nil {
+			return nil, err
+		}
+		encryptedVoteBigint, err := bigint.NewBigIntFromBase64(bigint.AddBase64Padding(encryptedVote))
+		if err != nil {
+			return nil, err
+		}
+		cryptoValues = append(cryptoValues, encryptedVoteBigint)
+		weights = append(weights, weight)
+	}
+
+	return paillier.CountWeightedSum(cryptoValues, weights, config.CryptoParams[votingID].Paillier.N), nil
+}
+
+// loadPartialDecryptions возвращает проверенные частичные расшифрования суммы sum
+func loadPartialDecryptions(ctx context.Context, db *pgxpool.Pool, votingID string, sum *bigint.BigInt) ([]*paillier.PartialDecryption, error) {
+	log := logger.GetLogger()
+	threshold := config.CryptoParams[votingID].Threshold
+
+	rows, err := db.Query(ctx,
+		"SELECT partial_decryption FROM partial_decryptions WHERE voting_id = $1 AND crypted_result = $2 ORDER BY trustee_index",
+		votingID,
+		bigint.AddBase64Padding(sum.ToBase64()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partials := []*paillier.PartialDecryption{}
+	for rows.Next() {
+		var jsonedPartial string
+		if err = rows.Scan(&jsonedPartial); err != nil {
+			return nil, err
+		}
+
+		var partial paillier.PartialDecryption
+		if err = json.Unmarshal([]byte(jsonedPartial), &partial); err != nil {
+			log.Error().Err(err).Msg("Error unmarshalling partial decryption")
+			continue
+		}
+
+		if err = paillier.VerifyPartialDecryption(threshold, sum, &partial); err != nil {
+			log.Error().Err(err).Int("trustee_index", partial.Index).Msg("Stored partial decryption is invalid")
+			continue
+		}
+		partials = append(partials, &partial)
+	}
+
+	return partials, nil
+}
+
+// GetEncryptedSum отдаёт доверенным лицам гомоморфную сумму бюллетеней для частичного расшифрования
+func GetEncryptedSum(w http.ResponseWriter, r *http.Request, votingID string) {
+	log := logger.GetLogger()
+	log.Info().Str("voting_id", votingID).Msg("Requested encrypted sum")
+	w.Header().Set("Content-Type", "application/json")
+
+	cryptoParams, exists := config.CryptoParams[votingID]
+	if !exists || cryptoParams.Threshold == nil {
+		http.Error(w, "Голосование не использует пороговое расшифрование", http.StatusNotFound)
+		return
+	}
+
+	db := database.GetCounterPGConnection()
+	ctx := context.Background()
+
+	var state int
+	err := db.QueryRow(ctx, "SELECT state FROM votings WHERE id = $1", votingID).Scan(&state)
+	if err != nil {
+		http.Error(w, "Голосование не найдено", http.StatusNotFound)
+		return
+	}
+	if state != 2 {
+		http.Error(w, "Принятие голосов еще не завершено", http.StatusConflict)
+		return
+	}
+
+	sum, err := loadEncryptedSum(ctx, db, votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error counting encrypted sum")
+		http.Error(w, "Ошибка при подсчете зашифрованной суммы", http.StatusInternalServerError)
+		return
+	}
+
+	response := EncryptedSumResponseData{
+		VotingID:      votingID,
+		CryptedResult: bigint.AddBase64Padding(sum.ToBase64()),
+	}
+
+	votingType, _, err := loadVotingType(ctx, db, votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting voting type")
+		http.Error(w, "Ошибка при подсчете зашифрованной суммы", http.StatusInternalServerError)
+		return
+	}
+	if votingType == models.VotingTypeRanked {
+		shuffle, err := loadRankedShuffle(ctx, db, votingID, sum)
+		if err != nil {
+			log.Error().Err(err).Msg("Error shuffling ranked ballots")
+			http.Error(w, "Ошибка при перемешивании бюллетеней", http.StatusInternalServerError)
+			return
+		}
+		response.Ciphertexts = make([]string, len(shuffle.Outputs))
+		for i, output := range shuffle.Outputs {
+			response.Ciphertexts[i] = bigint.AddBase64Padding(output.ToBase64())
+		}
+	}
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Error sending response")
+	}
+}
+
+// SubmitPartialDecryption принимает частичное расшифрование от доверенного лица.
+// Как только набирается порог, запускается публикация результатов
+func SubmitPartialDecryption(w http.ResponseWriter, r *http.Request, votingID string) {
+	log := logger.GetLogger()
+	log.Info().Str("voting_id", votingID).Msg("Requested partial decryption submission")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не поддерживается", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cryptoParams, exists := config.CryptoParams[votingID]
+	if !exists || cryptoParams.Threshold == nil {
+		http.Error(w, "Голосование не использует пороговое расшифрование", http.StatusNotFound)
+		return
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		err = json.NewEncoder(w).Encode(PartialDecryptionResponseData{
+			Success: false,
+			Message: "Ошибка при парсинге частичного расшифрования",
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Error sending response")
+		}
+		return
+	}
+
+	db := database.GetCounterPGConnection()
+	ctx := context.Background()
+
+	var state int
+	err := db.QueryRow(ctx, "SELECT state FROM votings WHERE id = $1", votingID).Scan(&state)
+	if err != nil || state != 2 {
+		w.WriteHeader(http.StatusConflict)
+		err = json.NewEncoder(w).Encode(PartialDecryptionResponseData{
+			Success: false,
+			Message: "Голосование не находится на стадии подсчета",
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Error sending response")
+		}
+		return
+	}
+
+	sum, err := loadEncryptedSum(ctx, db, votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error counting encrypted sum")
+		http.Error(w, "Ошибка при подсчете зашифрованной суммы", http.StatusInternalServerError)
+		return
+	}
+
+	votingType, _, err := loadVotingType(ctx, db, votingID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error getting voting type")
+		http.Error(w, "Ошибка при подсчете зашифрованной суммы", http.StatusInternalServerError)
+		return
+	}
+
+	// Ранжированное голосование расшифровывается по выходам перемешивания: доверенное лицо
+	// присылает массив частичных расшифрований, по одному на перемешанный бюллетень
+	var trusteeIndex int
+	var stored interface{}
+	if votingType == models.VotingTypeRanked {
+		var partials []*paillier.PartialDecryption
+		if err = json.Unmarshal(body, &partials); err == nil && len(partials) > 0 && partials[0] != nil {
+			trusteeIndex = partials[0].Index
+		}
+		if err == nil {
+			var shuffle *zkp.ShuffleRecord
+			shuffle, err = loadRankedShuffle(ctx, db, votingID, sum)
+			if err != nil {
+				log.Error().Err(err).Msg("Error shuffling ranked ballots")
+				http.Error(w, "Ошибка при перемешивании бюллетеней", http.StatusInternalServerError)
+				return
+			}
+			err = verifyRankedPartials(cryptoParams.Threshold, shuffle.Outputs, partials)
+		}
+		stored = partials
+	} else {
+		var partial paillier.PartialDecryption
+		if err = json.Unmarshal(body, &partial); err == nil {
+			trusteeIndex = partial.Index
+			err = paillier.VerifyPartialDecryption(cryptoParams.Threshold, sum, &partial)
+		}
+		stored = partial
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		err = json.NewEncoder(w).Encode(PartialDecryptionResponseData{
+			Success: false,
+			Message: "Ошибка при проверке частичного расшифрования: " + err.Error(),
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Error sending response")
+		}
+		log.Error().Int("trustee_index", trusteeIndex).Msg("Partial decryption rejected")
+		return
+	}
+
+	jsonedPartial, err := json.Marshal(stored)
+	if err != nil {
+		log.Error().Err(err).Msg("Error marshalling partial decryption")
+		http.Error(w, "Ошибка при сохранении частичного расшифрования", http.StatusInternalServerError)
+		return
+	}
+
+	// Прием и подсчет частичных расшифрований сериализуются блокировкой голосования,
+	// иначе два доверенных лица, пришедшие одновременно, видят одно и то же число принятых
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Error starting transaction")
+		http.Error(w, "Ошибка при сохранении частичного расшифрования", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, "SELECT id FROM votings WHERE id = $1 FOR UPDATE", votingID); err != nil {
+		log.Error().Err(err).Msg("Error locking voting")
+		http.Error(w, "Ошибка при сохранении частичного расшифрования", http.StatusInternalServerError)
+		return
+	}
+
+	tag, err := tx.Exec(ctx,
+		"INSERT INTO partial_decryptions (voting_id, trustee_index, crypted_result, partial_decryption, created_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING",
+		votingID,
+		trusteeIndex,
+		bigint.AddBase64Padding(sum.ToBase64()),
+		string(jsonedPartial),
+		time.Now(),
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Error saving partial decryption")
+		http.Error(w, "Ошибка при сохранении частичного расшифрования", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		w.WriteHeader(http.StatusConflict)
+		err = json.NewEncoder(w).Encode(PartialDecryptionResponseData{
+			Success: false,
+			Message: "Частичное расшифрование от этого доверенного лица уже принято",
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Error sending response")
+		}
+		return
+	}
+
+	var accepted int
+	err = tx.QueryRow(ctx,
+		"SELECT COUNT(*) FROM partial_decryptions WHERE voting_id = $1 AND crypted_result = $2",
+		votingID,
+		bigint.AddBase64Padding(sum.ToBase64()),
+	).Scan(&accepted)
+	if err != nil {
+		log.Error().Err(err).Msg("Error counting partial decryptions")
+		http.Error(w, "Ошибка при сохранении частичного расшифрования", http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Error().Err(err).Msg("Error committing partial decryption")
+		http.Error(w, "Ошибка при сохранении частичного расшифрования", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Int("trustee_index", trusteeIndex).Int("accepted", accepted).Msg("Partial decryption accepted")
+
+	// Подсчет запускается каждым частичным расшифрованием сверх порога: итог для одной
+	// зашифрованной суммы записывается один раз (см. CalculateVoting)
+	if accepted >= cryptoParams.Threshold.Threshold {
+		CalculateVotingResults(votingID)
+	}
+
+	err = json.NewEncoder(w).Encode(PartialDecryptionResponseData{
+		Success: true,
+		Message: "Частичное расшифрование принято",
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error sending response")
+	}
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// BallotLogEntry — запись журнала бюллетеней. ReplacedBy — номер записи переголосования,
+// заменившей этот бюллетень
+type BallotLogEntry struct {
+	VotingID      int
+	LogIndex      int
+	Label         string
+	EncryptedVote string
+	ZKPProof      string
+	Signature     string
+	Weight        uint64
+	CreatedAt     time.Time
+	ReplacedBy    *int
+}
@@ -6,5 +6,8 @@ type EncryptedVote struct {
 	VotingID      int
 	Label         string
 	EncryptedVote string
+	ZKPProof      string
+	Signature     string
+	Weight        uint64
 	CreatedAt     time.Time
 }
@@ -3,8 +3,20 @@ package models
 import "time"
 
 type MerklieRoot struct {
-	ID        int
-	VotingID  int
-	RootValue string
-	CreatedAt time.Time
+	ID          int
+	VotingID    int
+	RootValue   string
+	CreatedAt   time.Time
+	TreeVersion int
+	// TreeSize — количество записей журнала бюллетеней под корнем; nil у корней,
+	// построенных до появления журнала
+	TreeSize *int
+	// SignedAt (мс Unix) и Signature — подпись корня ключом Счетчика (merklie.TreeHead)
+	SignedAt  *int64
+	Signature *string
+	// BoardRoot и RevocationRoot — корни деревьев действующих бюллетеней и записей замен,
+	// упорядоченных по метке (ballotlog.Boards); BoardSize — число действующих бюллетеней
+	BoardRoot      *string
+	BoardSize      *int
+	RevocationRoot *string
 }
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type PartialDecryption struct {
+	ID                int
+	VotingID          int
+	TrusteeIndex      int
+	CryptedResult     string
+	PartialDecryption string
+	CreatedAt         time.Time
+}
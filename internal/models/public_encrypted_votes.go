@@ -7,6 +7,9 @@ type PublicEncryptedVote struct {
 	CorrespondsToMerklieRootID int
 	Label                      string
 	EncryptedVote              string
+	ZKPProof                   string
+	Signature                  string
+	Weight                     uint64
 	CreatedAt                  time.Time
 	MovedIntoAt                time.Time
 }
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Revote — замена бюллетеня OldLabel бюллетенем NewLabel. OldNonce раскрывается избирателем
+// при переголосовании и доказывает, что старый бюллетень принадлежал ему
+type Revote struct {
+	VotingID  int
+	OldLabel  string
+	OldNonce  string
+	NewLabel  string
+	CreatedAt time.Time
+}
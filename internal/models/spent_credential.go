@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type SpentCredential struct {
+	ID        int
+	VotingID  int
+	Label     string
+	Signature string
+	CreatedAt time.Time
+}
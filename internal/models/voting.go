@@ -2,13 +2,44 @@ package models
 
 import "time"
 
+// Типы бюллетеня голосования
+const (
+	// VotingTypeSingle — выбирается ровно один вариант
+	VotingTypeSingle = "single"
+	// VotingTypeApproval — отмечается любое подмножество вариантов
+	VotingTypeApproval = "approval"
+	// VotingTypeMultiChoice — отмечается не больше MaxChoices вариантов
+	VotingTypeMultiChoice = "multi_choice"
+	// VotingTypeRanked — варианты упорядочиваются, итог подводится мгновенным вторым туром
+	VotingTypeRanked = "ranked"
+	// VotingTypeCumulative — ровно MaxChoices баллов распределяются между вариантами
+	VotingTypeCumulative = "cumulative"
+)
+
 type Voting struct {
-	ID        int            `json:"id"`
-	Name      string         `json:"name"`
-	Question  string         `json:"question"`
-	State     int            `json:"state"`
-	Options   []VotingOption `json:"options"`
-	StartTime time.Time      `json:"start_time"`
-	AuditTime time.Time      `json:"audit_time"`
-	EndTime   time.Time      `json:"end_time"`
+	ID         int            `json:"id"`
+	Name       string         `json:"name"`
+	Question   string         `json:"question"`
+	State      int            `json:"state"`
+	Type       string         `json:"voting_type"`
+	MaxChoices int            `json:"max_choices"`
+	Options    []VotingOption `json:"options"`
+	StartTime  time.Time      `json:"start_time"`
+	AuditTime  time.Time      `json:"audit_time"`
+	EndTime    time.Time      `json:"end_time"`
+}
+
+// IsMultiChoice сообщает, отмечает ли голосующий каждый вариант отдельно
+func (v Voting) IsMultiChoice() bool {
+	return v.Type == VotingTypeApproval || v.Type == VotingTypeMultiChoice
+}
+
+// IsCumulative сообщает, распределяет ли голосующий баллы между вариантами
+func (v Voting) IsCumulative() bool {
+	return v.Type == VotingTypeCumulative
+}
+
+// IsRanked сообщает, упорядочивает ли голосующий варианты
+func (v Voting) IsRanked() bool {
+	return v.Type == VotingTypeRanked
 }
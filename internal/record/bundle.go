@@ -0,0 +1,230 @@
+package record
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// BundleVersion — версия формата архива
+const BundleVersion = 1
+
+const (
+	manifestFile  = "manifest.json"
+	signatureFile = "manifest.sig"
+)
+
+// ManifestFile — файл архива и его SHA-256
+type ManifestFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest описывает содержимое архива. Подписывается ключом Счетчика,
+// поэтому подпись манифеста покрывает все перечисленные файлы
+type Manifest struct {
+	BundleVersion int            `json:"bundle_version"`
+	RecordVersion int            `json:"record_version"`
+	VotingID      string         `json:"voting_id"`
+	CreatedAt     time.Time      `json:"created_at"`
+	PublicKey     string         `json:"public_key"`
+	Files         []ManifestFile `json:"files"`
+}
+
+// bundleVotingFile — описание голосования и варианты ответа
+type bundleVotingFile struct {
+	Version  int      `json:"version"`
+	VotingID string   `json:"voting_id"`
+	Voting   Voting   `json:"voting"`
+	Options  []Option `json:"options"`
+}
+
+// bundleParts раскладывает выгрузку по файлам архива
+func bundleParts(rec *ElectionRecord) (map[string]interface{}, error) {
+	if rec.Parameters.PaillierN == nil || rec.Parameters.RSAN == nil || rec.Parameters.RSAE == nil {
+		return nil, errors.New("record parameters are incomplete")
+	}
+
+	return map[string]interface{}{
+		"voting.json": bundleVotingFile{
+			Version:  rec.Version,
+			VotingID: rec.VotingID,
+			Voting:   rec.Voting,
+			Options:  rec.Options,
+		},
+		"parameters.json":    rec.Parameters,
+		"board.json":         rec.Ballots,
+		"merklie_roots.json": rec.MerklieRoots,
+		"ballot_log.json":    rec.BallotLog,
+		"revotes.json":       rec.Revotes,
+		"tally.json":         rec.Result,
+	}, nil
+}
+
+// WriteBundle записывает подписанный архив выгрузки. В архив попадают только
+// открытые параметры (Parameters), закрытые ключи RSA.D и Paillier.Lambda в нём не хранятся
+func WriteBundle(w io.Writer, rec *ElectionRecord, privateKey ed25519.PrivateKey) error {
+	parts, err := bundleParts(rec)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(parts))
+	for name := range parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	manifest := Manifest{
+		BundleVersion: BundleVersion,
+		RecordVersion: rec.Version,
+		VotingID:      rec.VotingID,
+		CreatedAt:     time.Now().UTC(),
+		PublicKey:     base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+	}
+
+	contents := make(map[string][]byte, len(parts)+2)
+	for _, name := range names {
+		data, err := json.MarshalIndent(parts[name], "", "    ")
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256(data)
+		contents[name] = data
+		manifest.Files = append(manifest.Files, ManifestFile{Name: name, SHA256: hex.EncodeToString(digest[:])})
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	contents[manifestFile] = manifestData
+	contents[signatureFile] = []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, manifestData)))
+
+	archive := zip.NewWriter(w)
+	for _, name := range append([]string{manifestFile, signatureFile}, names...) {
+		file, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = file.Write(contents[name]); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// ReadBundle проверяет подпись манифеста и хеши файлов и собирает выгрузку.
+// Если publicKey не задан, подпись проверяется ключом из манифеста — это защищает
+// только от повреждения, но не от подмены архива целиком
+func ReadBundle(data []byte, publicKey ed25519.PublicKey) (*ElectionRecord, *Manifest, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	contents := make(map[string][]byte, len(archive.File))
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		contents[file.Name] = content
+	}
+
+	manifestData, ok := contents[manifestFile]
+	if !ok {
+		return nil, nil, errors.New("bundle has no manifest")
+	}
+	var manifest Manifest
+	if err = json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("error parsing manifest: %w", err)
+	}
+	if manifest.BundleVersion != BundleVersion {
+		return nil, nil, fmt.Errorf("unsupported bundle version %d", manifest.BundleVersion)
+	}
+
+	if publicKey == nil {
+		publicKey, err = base64.StdEncoding.DecodeString(manifest.PublicKey)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			return nil, nil, errors.New("manifest public key is invalid")
+		}
+	}
+	signature, err := base64.StdEncoding.DecodeString(string(contents[signatureFile]))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing manifest signature: %w", err)
+	}
+	if !ed25519.Verify(publicKey, manifestData, signature) {
+		return nil, nil, errors.New("manifest signature is invalid")
+	}
+
+	for _, file := range manifest.Files {
+		content, ok := contents[file.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("file %s listed in manifest is missing", file.Name)
+		}
+		digest := sha256.Sum256(content)
+		if hex.EncodeToString(digest[:]) != file.SHA256 {
+			return nil, nil, fmt.Errorf("file %s does not match manifest hash", file.Name)
+		}
+	}
+
+	unmarshal := func(name string, target interface{}) {
+		if err != nil {
+			return
+		}
+		listed := false
+		for _, file := range manifest.Files {
+			listed = listed || file.Name == name
+		}
+		if !listed {
+			err = fmt.Errorf("file %s is not covered by the manifest", name)
+			return
+		}
+		if jsonErr := json.Unmarshal(contents[name], target); jsonErr != nil {
+			err = fmt.Errorf("error parsing %s: %w", name, jsonErr)
+		}
+	}
+
+	var votingFile bundleVotingFile
+	rec := &ElectionRecord{}
+	unmarshal("voting.json", &votingFile)
+	unmarshal("parameters.json", &rec.Parameters)
+	unmarshal("board.json", &rec.Ballots)
+	unmarshal("merklie_roots.json", &rec.MerklieRoots)
+	unmarshal("ballot_log.json", &rec.BallotLog)
+	unmarshal("revotes.json", &rec.Revotes)
+	unmarshal("tally.json", &rec.Result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rec.Version = votingFile.Version
+	rec.VotingID = votingFile.VotingID
+	rec.Voting = votingFile.Voting
+	rec.Options = votingFile.Options
+
+	if rec.Version != RecordVersion || rec.Version != manifest.RecordVersion {
+		return nil, nil, fmt.Errorf("unsupported election record version %d", rec.Version)
+	}
+	if rec.VotingID != manifest.VotingID {
+		return nil, nil, errors.New("manifest voting ID does not match the record")
+	}
+
+	return rec, &manifest, nil
+}
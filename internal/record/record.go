@@ -0,0 +1,187 @@
+package record
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/paillier"
+	"ev/internal/tally"
+	"fmt"
+	"os"
+	"time"
+)
+
+// RecordVersion — версия формата выгрузки голосования
+const RecordVersion = 1
+
+// Parameters — открытые криптографические параметры голосования
+type Parameters struct {
+	PaillierN          *bigint.BigInt               `json:"paillier_n"`
+	RSAN               *bigint.BigInt               `json:"rsa_n"`
+	RSAE               *bigint.BigInt               `json:"rsa_e"`
+	Threshold          *paillier.ThresholdPublicKey `json:"threshold,omitempty"`
+	ChallengeBits      uint                         `json:"challenge_bits"`
+	Base               uint                         `json:"base"`
+	ReVotingMultiplier uint64                       `json:"re_voting_multiplier"`
+	ZKPVersion         uint                         `json:"zkp_version,omitempty"`
+	// TreeHeadPublicKey — открытый ключ Счетчика для подписей корней (base64)
+	TreeHeadPublicKey string `json:"tree_head_public_key,omitempty"`
+	// WeightClasses — открытые ключи подписи бюллетеней с весом больше 1
+	WeightClasses []WeightClass `json:"weight_classes,omitempty"`
+	// DamgardJurikS > 1 — шифротексты схемы Дамгорда–Юрика по модулю n^(s+1)
+	DamgardJurikS uint `json:"damgard_jurik_s,omitempty"`
+}
+
+// S возвращает показатель s схемы Дамгорда–Юрика; для Paillier s = 1
+func (p Parameters) S() uint {
+	return max(p.DamgardJurikS, 1)
+}
+
+// WeightClass — открытый ключ Регистратора, которым подписываются бюллетени веса Weight
+type WeightClass struct {
+	Weight uint64         `json:"weight"`
+	RSAN   *bigint.BigInt `json:"rsa_n"`
+	RSAE   *bigint.BigInt `json:"rsa_e"`
+}
+
+// SignatureKey возвращает открытый ключ RSA для бюллетеней с весом weight; вес 0 означает вес 1
+func (p Parameters) SignatureKey(weight uint64) (n, e *bigint.BigInt, err error) {
+	if weight <= 1 {
+		return p.RSAN, p.RSAE, nil
+	}
+	for _, class := range p.WeightClasses {
+		if class.Weight == weight {
+			return class.RSAN, class.RSAE, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("no signature key for weight %d", weight)
+}
+
+// Voting — описание голосования
+type Voting struct {
+	Name     string `json:"name"`
+	Question string `json:"question"`
+	State    int    `json:"state"`
+	// Type — тип бюллетеня (см. models.VotingTypeSingle); в старых выгрузках отсутствует,
+	// что означает бюллетень с одним вариантом
+	Type       string    `json:"voting_type,omitempty"`
+	MaxChoices int       `json:"max_choices,omitempty"`
+	StartTime  time.Time `json:"start_time"`
+	AuditTime  time.Time `json:"audit_time"`
+	EndTime    time.Time `json:"end_time"`
+}
+
+// Option — вариант ответа
+type Option struct {
+	Index int    `json:"index"`
+	Text  string `json:"text"`
+}
+
+// Ballot — бюллетень публичного реестра в том виде, в котором он хранится у Счетчика.
+// Weight — вес бюллетеня; в старых выгрузках отсутствует, что означает вес 1
+type Ballot struct {
+	Label         string    `json:"label"`
+	EncryptedVote string    `json:"encrypted_vote"`
+	ZKPProof      string    `json:"zkp_proof"`
+	Signature     string    `json:"signature"`
+	Weight        uint64    `json:"weight,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// MerklieRoot — опубликованный корень дерева Меркла
+type MerklieRoot struct {
+	ID        int       `json:"id"`
+	RootValue string    `json:"root_value"`
+	CreatedAt time.Time `json:"created_at"`
+	// TreeVersion — версия дерева Меркла (см. merklie.TreeVersion1); в старых выгрузках отсутствует
+	TreeVersion int `json:"tree_version,omitempty"`
+	// TreeSize — размер префикса журнала бюллетеней под корнем; отсутствует у корней,
+	// построенных до появления журнала
+	TreeSize *int `json:"tree_size,omitempty"`
+	// SignedAt (мс Unix) и Signature — подпись корня Счетчиком, см. merklie.TreeHead
+	SignedAt  *int64 `json:"signed_at,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// Корни доски действующих бюллетеней и записей замен, упорядоченных по метке
+	BoardRoot      *string `json:"board_root,omitempty"`
+	BoardSize      *int    `json:"board_size,omitempty"`
+	RevocationRoot *string `json:"revocation_root,omitempty"`
+}
+
+// LogEntry — запись журнала бюллетеней
+type LogEntry struct {
+	LogIndex      int       `json:"log_index"`
+	Label         string    `json:"label"`
+	EncryptedVote string    `json:"encrypted_vote"`
+	ZKPProof      string    `json:"zkp_proof"`
+	Signature     string    `json:"signature"`
+	Weight        uint64    `json:"weight,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	ReplacedBy    *int      `json:"replaced_by,omitempty"`
+}
+
+// Revote — опубликованная запись переголосования: OldLabel = ComputeDigest(OldNonce, старый голос)
+type Revote struct {
+	OldLabel  string    `json:"old_label"`
+	OldNonce  string    `json:"old_nonce"`
+	NewLabel  string    `json:"new_label"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Result — опубликованный итог голосования
+type Result struct {
+	MerklieRootID     int           `json:"merklie_root_id"`
+	CryptedResult     string        `json:"crypted_result"`
+	UnencryptedResult string        `json:"unencrypted_result"`
+	ResultedCount     map[int]int64 `json:"resulted_count"`
+	ResultProof       string        `json:"result_proof"`
+	// Rounds — раунды мгновенного второго тура ранжированного голосования
+	Rounds    []tally.Round `json:"rounds,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// ElectionRecord — всё, что нужно для проверки голосования без обращения к серверу.
+// Ballots — бюллетени публичного реестра, соответствующие корню Result.MerklieRootID, в порядке дерева.
+// BallotLog — журнал бюллетеней, над префиксами которого построены корни с TreeSize.
+// Revotes — записи переголосований, заменивших бюллетени журнала
+type ElectionRecord struct {
+	Version      int           `json:"version"`
+	VotingID     string        `json:"voting_id"`
+	Voting       Voting        `json:"voting"`
+	Parameters   Parameters    `json:"parameters"`
+	Options      []Option      `json:"options"`
+	Ballots      []Ballot      `json:"ballots"`
+	MerklieRoots []MerklieRoot `json:"merklie_roots"`
+	BallotLog    []LogEntry    `json:"ballot_log,omitempty"`
+	Revotes      []Revote      `json:"revotes,omitempty"`
+	Result       Result        `json:"result"`
+}
+
+// Load читает выгрузку голосования из JSON-файла.
+// Подписанные архивы (см. ReadBundle) распознаются по сигнатуре zip и проверяются только
+// закреплённым ключом Счетчика publicKey: ключу из самого архива Load не доверяет
+func Load(path string, publicKey ed25519.PublicKey) (*ElectionRecord, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(file, []byte("PK\x03\x04")) {
+		if len(publicKey) != ed25519.PublicKeySize {
+			return nil, errors.New("signed bundle requires the Counter record public key")
+		}
+		rec, _, err := ReadBundle(file, publicKey)
+		return rec, err
+	}
+
+	var rec ElectionRecord
+	if err = json.Unmarshal(file, &rec); err != nil {
+		return nil, fmt.Errorf("error parsing election record: %w", err)
+	}
+	if rec.Version != RecordVersion {
+		return nil, fmt.Errorf("unsupported election record version %d", rec.Version)
+	}
+
+	return &rec, nil
+}
@@ -0,0 +1,781 @@
+package record
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/blind_signature"
+	"ev/internal/crypto/merklie"
+	"ev/internal/crypto/paillier"
+	"ev/internal/crypto/zkp"
+	"ev/internal/models"
+	"ev/internal/tally"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Check — результат одной проверки выгрузки
+type Check struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// Verify выполняет все проверки выгрузки и возвращает результат по каждой
+func Verify(rec *ElectionRecord) []Check {
+	checks := []struct {
+		name string
+		run  func(*ElectionRecord) (string, error)
+	}{
+		{"merkle root", checkMerkleRoot},
+		{"ballot log", checkBallotLog},
+		{"tree head signatures", checkTreeHeads},
+		{"ballot boards", checkBoards},
+		{"revotes", checkRevotes},
+		{"encrypted sum", checkEncryptedSum},
+		{"decryption proof", checkDecryptionProof},
+		{"result chunks", checkResultChunks},
+		{"instant runoff", checkInstantRunoff},
+		{"unique credentials", checkUniqueCredentials},
+		{"ballot proofs", checkBallotProofs},
+		{"ballot signatures", checkBallotSignatures},
+	}
+
+	results := make([]Check, 0, len(checks))
+	for _, check := range checks {
+		detail, err := check.run(rec)
+		if err != nil {
+			results = append(results, Check{Name: check.name, Passed: false, Detail: err.Error()})
+			continue
+		}
+		results = append(results, Check{Name: check.name, Passed: true, Detail: detail})
+	}
+
+	return results
+}
+
+// checkMerkleRoot пересчитывает корень дерева по бюллетеням и сравнивает с корнем итога
+func checkMerkleRoot(rec *ElectionRecord) (string, error) {
+	var published *MerklieRoot
+	for i := range rec.MerklieRoots {
+		if rec.MerklieRoots[i].ID == rec.Result.MerklieRootID {
+			published = &rec.MerklieRoots[i]
+			break
+		}
+	}
+	if published == nil {
+		return "", fmt.Errorf("merkle root %d referenced by the result is missing", rec.Result.MerklieRootID)
+	}
+
+	if published.TreeSize != nil {
+		return checkLogSnapshot(rec, published)
+	}
+
+	version := published.TreeVersion
+	if version == 0 {
+		version = merklie.TreeVersion1
+	}
+	merkleTree, err := merklie.NewMerkleTreeWithVersion(version)
+	if err != nil {
+		return "", err
+	}
+	for _, ballot := range rec.Ballots {
+		merkleTree.AddLeaf(ballot.EncryptedVote)
+	}
+
+	if merkleTree.GetRoot() != published.RootValue {
+		return "", fmt.Errorf("recomputed root %s does not match published root %s", merkleTree.GetRoot(), published.RootValue)
+	}
+
+	return fmt.Sprintf("%d ballots, tree v%d, root %s", len(rec.Ballots), version, published.RootValue), nil
+}
+
+// logTree строит дерево над всем журналом; корни префиксов берутся через RootAt
+func logTree(rec *ElectionRecord) *merklie.MerkleTree {
+	merkleTree, _ := merklie.NewMerkleTreeWithVersion(merklie.TreeVersion2)
+	for _, entry := range rec.BallotLog {
+		merkleTree.AddLeaf(entry.EncryptedVote)
+	}
+	return merkleTree
+}
+
+// checkLogSnapshot проверяет, что бюллетени итога — это ровно те записи журнала,
+// которые действовали под корнем итога, а сам корень построен над этим префиксом журнала
+func checkLogSnapshot(rec *ElectionRecord, published *MerklieRoot) (string, error) {
+	size := *published.TreeSize
+	root, err := logTree(rec).RootAt(size)
+	if err != nil {
+		return "", err
+	}
+	if root != published.RootValue {
+		return "", fmt.Errorf("recomputed log root %s does not match published root %s", root, published.RootValue)
+	}
+
+	active := map[string]string{}
+	for _, entry := range rec.BallotLog[:size] {
+		if entry.ReplacedBy == nil || *entry.ReplacedBy >= size {
+			active[entry.Label] = entry.EncryptedVote
+		}
+	}
+	if len(active) != len(rec.Ballots) {
+		return "", fmt.Errorf("%d ballots are active in the log, but %d are published", len(active), len(rec.Ballots))
+	}
+	for _, ballot := range rec.Ballots {
+		if encryptedVote, ok := active[ballot.Label]; !ok || encryptedVote != ballot.EncryptedVote {
+			return "", fmt.Errorf("ballot %s is not an active log entry", ballot.Label)
+		}
+	}
+
+	return fmt.Sprintf("%d ballots, %d log entries, root %s", len(rec.Ballots), size, published.RootValue), nil
+}
+
+// checkBallotLog проверяет, что журнал только дополнялся: каждый корень с TreeSize
+// пересчитывается по префиксу одного и того же журнала, а замены ссылаются только вперёд
+func checkBallotLog(rec *ElectionRecord) (string, error) {
+	replaced := map[int]bool{}
+	for i, entry := range rec.BallotLog {
+		if entry.LogIndex != i {
+			return "", fmt.Errorf("log entry %d has index %d", i, entry.LogIndex)
+		}
+		if entry.ReplacedBy == nil {
+			continue
+		}
+		by := *entry.ReplacedBy
+		if by <= i || by >= len(rec.BallotLog) {
+			return "", fmt.Errorf("log entry %d is replaced by invalid entry %d", i, by)
+		}
+		if replaced[by] {
+			return "", fmt.Errorf("log entry %d replaces more than one ballot", by)
+		}
+		replaced[by] = true
+	}
+
+	merkleTree := logTree(rec)
+	logRoots, previousSize := 0, 0
+	for _, root := range rec.MerklieRoots {
+		if root.TreeSize == nil {
+			continue
+		}
+		if root.TreeVersion != merklie.TreeVersion2 {
+			return "", fmt.Errorf("log root %d has tree version %d", root.ID, root.TreeVersion)
+		}
+		if *root.TreeSize < previousSize {
+			return "", fmt.Errorf("log root %d covers %d entries, fewer than the previous root", root.ID, *root.TreeSize)
+		}
+		rootValue, err := merkleTree.RootAt(*root.TreeSize)
+		if err != nil {
+			return "", fmt.Errorf("root %d: %w", root.ID, err)
+		}
+		if rootValue != root.RootValue {
+			return "", fmt.Errorf("root %d does not match the ballot log prefix of %d entries", root.ID, *root.TreeSize)
+		}
+		previousSize = *root.TreeSize
+		logRoots++
+	}
+
+	return fmt.Sprintf("%d entries, %d replaced, %d roots consistent", len(rec.BallotLog), len(replaced), logRoots), nil
+}
+
+// checkBoards пересчитывает корни доски действующих бюллетеней и записей замен
+// (см. ballotlog.Boards) по префиксу журнала под каждым корнем
+func checkBoards(rec *ElectionRecord) (string, error) {
+	boards := 0
+	for _, root := range rec.MerklieRoots {
+		if root.BoardRoot == nil {
+			continue
+		}
+		if root.TreeSize == nil || root.BoardSize == nil || root.RevocationRoot == nil {
+			return "", fmt.Errorf("root %d: board is published without tree size or revocations", root.ID)
+		}
+		size := *root.TreeSize
+		if size > len(rec.BallotLog) {
+			return "", fmt.Errorf("root %d covers %d entries, but the log has %d", root.ID, size, len(rec.BallotLog))
+		}
+
+		active := []merklie.SortedLeaf{}
+		replaced := []merklie.SortedLeaf{}
+		for _, entry := range rec.BallotLog[:size] {
+			if entry.ReplacedBy != nil && *entry.ReplacedBy >= 0 && *entry.ReplacedBy < size {
+				replaced = append(replaced, merklie.SortedLeaf{Key: entry.Label, Value: rec.BallotLog[*entry.ReplacedBy].Label})
+				continue
+			}
+			active = append(active, merklie.SortedLeaf{Key: entry.Label, Value: entry.EncryptedVote})
+		}
+
+		board, err := merklie.NewSortedTree(active)
+		if err != nil {
+			return "", fmt.Errorf("root %d: %w", root.ID, err)
+		}
+		revocations, err := merklie.NewSortedTree(replaced)
+		if err != nil {
+			return "", fmt.Errorf("root %d: %w", root.ID, err)
+		}
+		if board.Root() != *root.BoardRoot || board.Size() != *root.BoardSize {
+			return "", fmt.Errorf("root %d: board does not match the ballot log prefix of %d entries", root.ID, size)
+		}
+		if revocations.Root() != *root.RevocationRoot {
+			return "", fmt.Errorf("root %d: revocations do not match the ballot log prefix of %d entries", root.ID, size)
+		}
+		boards++
+	}
+
+	if boards == 0 {
+		return "no published boards", nil
+	}
+	return fmt.Sprintf("%d boards consistent", boards), nil
+}
+
+// parseBase64 разбирает число в кодировке base64 десятичной строки
+func parseBase64(value string) (*bigint.BigInt, error) {
+	return bigint.NewBigIntFromBase64(bigint.AddBase64Padding(value))
+}
+
+// ballotWeight возвращает вес бюллетеня; в выгрузках без весов он равен 1
+func ballotWeight(weight uint64) uint64 {
+	if weight == 0 {
+		return 1
+	}
+	return weight
+}
+
+// totalWeight возвращает суммарный вес бюллетеней реестра
+func totalWeight(rec *ElectionRecord) uint64 {
+	var total uint64
+	for _, ballot := range rec.Ballots {
+		total += ballotWeight(ballot.Weight)
+	}
+	return total
+}
+
+// checkEncryptedSum перемножает шифротексты в степенях их весов и сравнивает с опубликованной суммой
+func checkEncryptedSum(rec *ElectionRecord) (string, error) {
+	ciphertexts := make([]*bigint.BigInt, 0, len(rec.Ballots))
+	weights := make([]uint64, 0, len(rec.Ballots))
+	for _, ballot := range rec.Ballots {
+		c, err := parseBase64(ballot.EncryptedVote)
+		if err != nil {
+			return "", fmt.Errorf("ballot %s: %w", ballot.Label, err)
+		}
+		ciphertexts = append(ciphertexts, c)
+		weights = append(weights, ballotWeight(ballot.Weight))
+	}
+
+	published, err := parseBase64(rec.Result.CryptedResult)
+	if err != nil {
+		return "", err
+	}
+
+	if !paillier.CountWeightedSumDJ(ciphertexts, weights, rec.Parameters.PaillierN, rec.Parameters.S()).Eq(published) {
+		return "", errors.New("product of ballots does not match published encrypted sum")
+	}
+
+	return "", nil
+}
+
+// rankedInputs возвращает перемешиваемые шифротексты бюллетеней ранжированного голосования (tally.RankedInput)
+// в порядке меток, как их перемешивает Счетчик
+func rankedInputs(rec *ElectionRecord) ([]*bigint.BigInt, error) {
+	ballots := append(rec.Ballots[:0:0], rec.Ballots...)
+	sort.Slice(ballots, func(i, j int) bool { return ballots[i].Label < ballots[j].Label })
+
+	inputs := make([]*bigint.BigInt, len(ballots))
+	for i, ballot := range ballots {
+		c, err := parseBase64(ballot.EncryptedVote)
+		if err != nil {
+			return nil, fmt.Errorf("ballot %s: %w", ballot.Label, err)
+		}
+		inputs[i] = tally.RankedInput(rec.Parameters.PaillierN, rec.Parameters.S(), c, ballotWeight(ballot.Weight), rec.Parameters.Base, len(rec.Options))
+	}
+	return inputs, nil
+}
+
+// rankedProof разбирает доказательство итога ранжированного голосования
+func rankedProof(rec *ElectionRecord) (*tally.RankedProof, error) {
+	var proof tally.RankedProof
+	if err := json.Unmarshal([]byte(rec.Result.ResultProof), &proof); err != nil {
+		return nil, fmt.Errorf("error parsing ranked result proof: %w", err)
+	}
+	return &proof, nil
+}
+
+// rankedBallots возвращает расшифрованные перемешанные бюллетени ранжированного голосования
+func rankedBallots(rec *ElectionRecord) ([]tally.Ballot, error) {
+	proof, err := rankedProof(rec)
+	if err != nil {
+		return nil, err
+	}
+	return proof.Ballots(rec.Parameters.Base, len(rec.Options))
+}
+
+// checkRankedDecryption проверяет перемешивание бюллетеней ранжированного голосования
+// и расшифрование каждого перемешанного бюллетеня
+func checkRankedDecryption(rec *ElectionRecord) (string, error) {
+	votingID, err := bigint.NewBigIntFromString(rec.VotingID)
+	if err != nil {
+		return "", fmt.Errorf("voting ID %q is not a number", rec.VotingID)
+	}
+	inputs, err := rankedInputs(rec)
+	if err != nil {
+		return "", err
+	}
+	proof, err := rankedProof(rec)
+	if err != nil {
+		return "", err
+	}
+	if err = proof.Verify(rec.Parameters.PaillierN, rec.Parameters.S(), rec.Parameters.Threshold, votingID, inputs); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d shuffled ballots decrypted", len(proof.Plaintexts)), nil
+}
+
+// checkDecryptionProof проверяет доказательство того, что сумма расшифрована верно.
+// Сумма ранжированных бюллетеней не расшифровывается, вместо неё проверяется перемешивание
+func checkDecryptionProof(rec *ElectionRecord) (string, error) {
+	if rec.Voting.Type == models.VotingTypeRanked {
+		return checkRankedDecryption(rec)
+	}
+
+	c, err := parseBase64(rec.Result.CryptedResult)
+	if err != nil {
+		return "", err
+	}
+	m, err := parseBase64(rec.Result.UnencryptedResult)
+	if err != nil {
+		return "", err
+	}
+
+	if rec.Parameters.Threshold != nil {
+		if rec.Parameters.S() > 1 {
+			return "", errors.New("threshold decryption does not support Damgård–Jurik ciphertexts")
+		}
+		var partials []*paillier.PartialDecryption
+		if err = json.Unmarshal([]byte(rec.Result.ResultProof), &partials); err != nil {
+			return "", fmt.Errorf("error parsing partial decryptions: %w", err)
+		}
+		if err = paillier.VerifyThresholdDecryption(rec.Parameters.Threshold, c, m, partials); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d partial decryptions", len(partials)), nil
+	}
+
+	var proof paillier.DecryptionProof
+	if err = json.Unmarshal([]byte(rec.Result.ResultProof), &proof); err != nil {
+		return "", fmt.Errorf("error parsing decryption proof: %w", err)
+	}
+
+	return "", paillier.VerifyDecryptionDJ(c, m, rec.Parameters.PaillierN, rec.Parameters.S(), &proof)
+}
+
+// checkResultChunks раскладывает расшифрованную сумму на счетчики вариантов.
+// Итог ранжированного голосования — голоса первого раунда по перемешанным бюллетеням
+func checkResultChunks(rec *ElectionRecord) (string, error) {
+	var counts []int64
+	if rec.Voting.Type == models.VotingTypeRanked {
+		ballots, err := rankedBallots(rec)
+		if err != nil {
+			return "", err
+		}
+		if len(ballots) != len(rec.Ballots) {
+			return "", fmt.Errorf("%d shuffled ballots for %d ballots", len(ballots), len(rec.Ballots))
+		}
+		firstPreferences := tally.FirstPreferences(len(rec.Options), ballots)
+		for _, option := range rec.Options {
+			counts = append(counts, firstPreferences[option.Index])
+		}
+	} else {
+		m, err := parseBase64(rec.Result.UnencryptedResult)
+		if err != nil {
+			return "", err
+		}
+		chunks, err := tally.DecodeCounts(m, rec.Parameters.Base, len(rec.Options))
+		if err != nil {
+			return "", err
+		}
+		for _, option := range rec.Options {
+			if option.Index < 0 || option.Index >= len(chunks) {
+				return "", fmt.Errorf("option index %d is out of range for %d counters", option.Index, len(chunks))
+			}
+			counts = append(counts, chunks[option.Index])
+		}
+	}
+
+	var total int64
+	for i, option := range rec.Options {
+		if published := rec.Result.ResultedCount[option.Index]; published != counts[i] {
+			return "", fmt.Errorf("option %d: decoded %d, published %d", option.Index, counts[i], published)
+		}
+		total += counts[i]
+	}
+
+	if err := CheckCounts(rec.Voting.Type, rec.Voting.MaxChoices, counts, totalWeight(rec)); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d votes", total), nil
+}
+
+// checkInstantRunoff пересчитывает раунды мгновенного второго тура по расшифрованным перемешанным бюллетеням
+func checkInstantRunoff(rec *ElectionRecord) (string, error) {
+	if rec.Voting.Type != models.VotingTypeRanked {
+		if len(rec.Result.Rounds) != 0 {
+			return "", errors.New("rounds are published for a voting that is not ranked")
+		}
+		return "not a ranked voting", nil
+	}
+
+	ballots, err := rankedBallots(rec)
+	if err != nil {
+		return "", err
+	}
+	rounds, err := tally.InstantRunoff(len(rec.Options), ballots)
+	if err != nil {
+		return "", err
+	}
+
+	if len(rounds) != len(rec.Result.Rounds) {
+		return "", fmt.Errorf("expected %d rounds, published %d", len(rounds), len(rec.Result.Rounds))
+	}
+	for i := range rounds {
+		if !reflect.DeepEqual(rounds[i], rec.Result.Rounds[i]) {
+			return "", fmt.Errorf("round %d does not match published", i+1)
+		}
+	}
+
+	if len(rounds) == 0 {
+		return "no ballots", nil
+	}
+	return fmt.Sprintf("option %d wins in round %d", *rounds[len(rounds)-1].Winner, len(rounds)), nil
+}
+
+// CheckCounts проверяет, что итоги по вариантам возможны для бюллетеней данного типа с суммарным весом
+// totalWeight (без весов — числом бюллетеней): бюллетень с одним вариантом даёт ровно один голос,
+// с несколькими — не больше maxChoices, с распределением баллов — ровно maxChoices баллов,
+// умноженных на вес бюллетеня
+func CheckCounts(votingType string, maxChoices int, counts []int64, totalWeight uint64) error {
+	weight := int64(totalWeight)
+
+	// Бюллетень с распределением баллов может отдать одному варианту все maxChoices баллов
+	perBallot := int64(1)
+	if votingType == models.VotingTypeCumulative {
+		perBallot = int64(maxChoices)
+	}
+
+	var total int64
+	for i, count := range counts {
+		if count < 0 || count > perBallot*weight {
+			return fmt.Errorf("option %d: decoded %d votes for ballots of total weight %d", i, count, weight)
+		}
+		total += count
+	}
+
+	switch votingType {
+	case "", models.VotingTypeSingle, models.VotingTypeRanked:
+		// Первое место ранжированного бюллетеня занимает ровно один вариант
+		if total != weight {
+			return fmt.Errorf("decoded %d votes for ballots of total weight %d", total, weight)
+		}
+	case models.VotingTypeApproval, models.VotingTypeMultiChoice:
+		if total > int64(maxChoices)*weight {
+			return fmt.Errorf("decoded %d votes for ballots of total weight %d with at most %d choices", total, weight, maxChoices)
+		}
+	case models.VotingTypeCumulative:
+		if total != int64(maxChoices)*weight {
+			return fmt.Errorf("decoded %d points for ballots of total weight %d with %d points each", total, weight, maxChoices)
+		}
+	default:
+		return fmt.Errorf("unknown voting type %q", votingType)
+	}
+	return nil
+}
+
+// checkUniqueCredentials проверяет, что метки и подписи не повторяются
+func checkUniqueCredentials(rec *ElectionRecord) (string, error) {
+	labels := make(map[string]bool)
+	signatures := make(map[string]bool)
+	for _, ballot := range rec.Ballots {
+		if labels[ballot.Label] {
+			return "", fmt.Errorf("label %s is used twice", ballot.Label)
+		}
+		labels[ballot.Label] = true
+
+		if signatures[ballot.Signature] {
+			return "", fmt.Errorf("signature of ballot %s is used twice", ballot.Label)
+		}
+		signatures[ballot.Signature] = true
+	}
+
+	return "", nil
+}
+
+// checkBallotProofs проверяет ZKP-доказательства допустимости каждого бюллетеня
+func checkBallotProofs(rec *ElectionRecord) (string, error) {
+	votingID, err := bigint.NewBigIntFromString(rec.VotingID)
+	if err != nil {
+		return "", fmt.Errorf("voting ID %q is not a number", rec.VotingID)
+	}
+
+	validMessages := make([]*bigint.BigInt, len(rec.Options))
+	for i := range validMessages {
+		validMessages[i] = bigint.NewBigIntFromInt(1).Lsh(rec.Parameters.Base * uint(i))
+	}
+
+	// Бюллетень с несколькими вариантами даёт несколько доказательств; owners[i] — номер бюллетеня proofs[i]
+	proofs := []*zkp.CorrectMessageProof{}
+	owners := []int{}
+	for i, ballot := range rec.Ballots {
+		c, err := parseBase64(ballot.EncryptedVote)
+		if err != nil {
+			return "", fmt.Errorf("ballot %s: %w", ballot.Label, err)
+		}
+		label, err := parseBase64(ballot.Label)
+		if err != nil {
+			return "", fmt.Errorf("ballot %s: %w", ballot.Label, err)
+		}
+
+		var ballotProofs []*zkp.CorrectMessageProof
+		switch rec.Voting.Type {
+		case "", models.VotingTypeSingle:
+			var proofRecord zkp.ProofRecord
+			if err = json.Unmarshal([]byte(ballot.ZKPProof), &proofRecord); err != nil {
+				return "", fmt.Errorf("ballot %s: error parsing proof: %w", ballot.Label, err)
+			}
+			if err = checkProofRecordVersion(rec, proofRecord); err != nil {
+				return "", fmt.Errorf("ballot %s: %w", ballot.Label, err)
+			}
+			ballotProofs = []*zkp.CorrectMessageProof{
+				proofRecord.Proof(c, validMessages, rec.Parameters.PaillierN, rec.Parameters.S(), rec.Parameters.ChallengeBits, votingID, label),
+			}
+		case models.VotingTypeApproval, models.VotingTypeMultiChoice, models.VotingTypeCumulative, models.VotingTypeRanked:
+			var multiRecord zkp.MultiChoiceRecord
+			if err = json.Unmarshal([]byte(ballot.ZKPProof), &multiRecord); err != nil {
+				return "", fmt.Errorf("ballot %s: error parsing proof: %w", ballot.Label, err)
+			}
+			for _, choice := range multiRecord.Choices {
+				if err = checkProofRecordVersion(rec, choice.Proof); err != nil {
+					return "", fmt.Errorf("ballot %s: %w", ballot.Label, err)
+				}
+			}
+			if err = checkProofRecordVersion(rec, multiRecord.Total); err != nil {
+				return "", fmt.Errorf("ballot %s: %w", ballot.Label, err)
+			}
+			var proof *zkp.MultiChoiceProof
+			ballotBase := rec.Parameters.Base
+			switch rec.Voting.Type {
+			case models.VotingTypeCumulative:
+				proof, err = multiRecord.PointsProof(len(rec.Options), rec.Voting.MaxChoices, rec.Parameters.PaillierN, rec.Parameters.S(), rec.Parameters.ChallengeBits, votingID, label)
+			case models.VotingTypeRanked:
+				// Строки ранжирования собираются в бюллетень по m ячеек, см. zkp.RankingBase
+				proof, err = multiRecord.RankingProof(len(rec.Options), rec.Parameters.Base, rec.Parameters.PaillierN, rec.Parameters.S(), rec.Parameters.ChallengeBits, votingID, label)
+				ballotBase = zkp.RankingBase(len(rec.Options), rec.Parameters.Base)
+			default:
+				proof, err = multiRecord.Proof(len(rec.Options), rec.Voting.MaxChoices, rec.Parameters.PaillierN, rec.Parameters.S(), rec.Parameters.ChallengeBits, votingID, label)
+			}
+			if err == nil {
+				err = proof.CheckBallot(c, ballotBase)
+			}
+			if err != nil {
+				return "", fmt.Errorf("ballot %s: %w", ballot.Label, err)
+			}
+			ballotProofs = proof.Proofs()
+		default:
+			return "", fmt.Errorf("unknown voting type %q", rec.Voting.Type)
+		}
+
+		for _, proof := range ballotProofs {
+			proofs = append(proofs, proof)
+			owners = append(owners, i)
+		}
+	}
+
+	// Доказательства всего реестра проверяются пакетно, см. zkp.BatchVerify
+	var batchErr *zkp.BatchError
+	if err = zkp.BatchVerify(proofs); errors.As(err, &batchErr) {
+		labels := []string{}
+		for _, index := range batchErr.Failed {
+			label := rec.Ballots[owners[index]].Label
+			if len(labels) == 0 || labels[len(labels)-1] != label {
+				labels = append(labels, label)
+			}
+		}
+		return "", fmt.Errorf("proof check failed for ballots %s", strings.Join(labels, ", "))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d ballots", len(rec.Ballots)), nil
+}
+
+// checkProofRecordVersion проверяет, что версия доказательства не ниже требуемой голосованием
+func checkProofRecordVersion(rec *ElectionRecord, proofRecord zkp.ProofRecord) error {
+	if rec.Parameters.ZKPVersion >= zkp.ProofVersionContext && proofRecord.Version < zkp.ProofVersionContext {
+		return fmt.Errorf("proof version %d is below required %d", proofRecord.Version, rec.Parameters.ZKPVersion)
+	}
+	return nil
+}
+
+// checkTreeHeads проверяет подписи Счетчика на опубликованных корнях.
+// Корни, опубликованные до введения подписей, пропускаются
+func checkTreeHeads(rec *ElectionRecord) (string, error) {
+	signed := 0
+	for _, root := range rec.MerklieRoots {
+		if root.Signature == "" {
+			continue
+		}
+		if root.SignedAt == nil || root.TreeSize == nil {
+			return "", fmt.Errorf("merkle root %d: signed root lacks tree size or timestamp", root.ID)
+		}
+		signed++
+	}
+	if signed == 0 {
+		return "no signed roots", nil
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(rec.Parameters.TreeHeadPublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return "", errors.New("tree head public key is missing or invalid")
+	}
+
+	for _, root := range rec.MerklieRoots {
+		if root.Signature == "" {
+			continue
+		}
+		head := merklie.TreeHead{
+			VotingID:       rec.VotingID,
+			TreeVersion:    root.TreeVersion,
+			TreeSize:       *root.TreeSize,
+			RootValue:      root.RootValue,
+			BoardRoot:      root.BoardRoot,
+			BoardSize:      root.BoardSize,
+			RevocationRoot: root.RevocationRoot,
+			Timestamp:      *root.SignedAt,
+			Signature:      root.Signature,
+		}
+		if err = head.Verify(publicKey); err != nil {
+			return "", fmt.Errorf("merkle root %d: %w", root.ID, err)
+		}
+	}
+
+	return fmt.Sprintf("%d of %d roots signed", signed, len(rec.MerklieRoots)), nil
+}
+
+// checkRevotes проверяет, что каждый бюллетень, замененный под опубликованными корнями, заменил его владелец:
+// запись переголосования раскрывает nonce, по которому пересчитывается метка старого бюллетеня,
+// а новый бюллетень подписан Регистратором как переголосование
+func checkRevotes(rec *ElectionRecord) (string, error) {
+	published := 0
+	for _, root := range rec.MerklieRoots {
+		if root.TreeSize != nil && *root.TreeSize > published {
+			published = *root.TreeSize
+		}
+	}
+	if published > len(rec.BallotLog) {
+		return "", fmt.Errorf("roots cover %d entries, but the log has %d", published, len(rec.BallotLog))
+	}
+
+	byLabel := map[string]int{}
+	for i, entry := range rec.BallotLog {
+		byLabel[entry.Label] = i
+	}
+
+	bs := blind_signature.BlindSignature{}
+	multiplier := bigint.NewBigIntFromUint(rec.Parameters.ReVotingMultiplier)
+	revoked := map[string]bool{}
+	for _, revote := range rec.Revotes {
+		if revoked[revote.OldLabel] {
+			return "", fmt.Errorf("ballot %s is replaced more than once", revote.OldLabel)
+		}
+		oldIndex, ok := byLabel[revote.OldLabel]
+		if !ok {
+			return "", fmt.Errorf("revote replaces ballot %s missing from the log", revote.OldLabel)
+		}
+		newIndex, ok := byLabel[revote.NewLabel]
+		if !ok {
+			return "", fmt.Errorf("revote ballot %s is missing from the log", revote.NewLabel)
+		}
+		old := rec.BallotLog[oldIndex]
+		if old.ReplacedBy == nil || *old.ReplacedBy != newIndex {
+			return "", fmt.Errorf("ballot log does not record %s as replaced by %s", revote.OldLabel, revote.NewLabel)
+		}
+
+		oldLabel, err := parseBase64(revote.OldLabel)
+		if err != nil {
+			return "", fmt.Errorf("revote %s: %w", revote.OldLabel, err)
+		}
+		nonce, err := parseBase64(revote.OldNonce)
+		if err != nil {
+			return "", fmt.Errorf("revote %s: %w", revote.OldLabel, err)
+		}
+		c, err := parseBase64(old.EncryptedVote)
+		if err != nil {
+			return "", fmt.Errorf("revote %s: %w", revote.OldLabel, err)
+		}
+		if zkp.ComputeDigest([]*bigint.BigInt{nonce, c}).Neq(oldLabel) {
+			return "", fmt.Errorf("revote %s: nonce does not open the replaced ballot label", revote.OldLabel)
+		}
+
+		newLabel, err := parseBase64(revote.NewLabel)
+		if err != nil {
+			return "", fmt.Errorf("revote %s: %w", revote.NewLabel, err)
+		}
+		signature, err := parseBase64(rec.BallotLog[newIndex].Signature)
+		if err != nil {
+			return "", fmt.Errorf("revote %s: %w", revote.NewLabel, err)
+		}
+		rsaN, rsaE, err := rec.Parameters.SignatureKey(rec.BallotLog[newIndex].Weight)
+		if err != nil {
+			return "", fmt.Errorf("revote %s: %w", revote.NewLabel, err)
+		}
+		if !bs.Verify(newLabel.Mul(multiplier), signature, rsaE, rsaN) {
+			return "", fmt.Errorf("revote %s: ballot is not signed as a re-vote", revote.NewLabel)
+		}
+
+		revoked[revote.OldLabel] = true
+	}
+
+	for i, entry := range rec.BallotLog[:published] {
+		if entry.ReplacedBy != nil && *entry.ReplacedBy < published && !revoked[entry.Label] {
+			return "", fmt.Errorf("log entry %d was replaced without a published revote", i)
+		}
+	}
+
+	return fmt.Sprintf("%d revotes", len(rec.Revotes)), nil
+}
+
+// checkBallotSignatures проверяет подпись Регистратора на метке (или метке с множителем переголосования)
+func checkBallotSignatures(rec *ElectionRecord) (string, error) {
+	bs := blind_signature.BlindSignature{}
+	multiplier := bigint.NewBigIntFromUint(rec.Parameters.ReVotingMultiplier)
+
+	reVotes := 0
+	for _, ballot := range rec.Ballots {
+		label, err := parseBase64(ballot.Label)
+		if err != nil {
+			return "", fmt.Errorf("ballot %s: %w", ballot.Label, err)
+		}
+		signature, err := parseBase64(ballot.Signature)
+		if err != nil {
+			return "", fmt.Errorf("ballot %s: %w", ballot.Label, err)
+		}
+		// Подпись ключом класса веса удостоверяет вес бюллетеня
+		rsaN, rsaE, err := rec.Parameters.SignatureKey(ballot.Weight)
+		if err != nil {
+			return "", fmt.Errorf("ballot %s: %w", ballot.Label, err)
+		}
+
+		if bs.Verify(label, signature, rsaE, rsaN) {
+			continue
+		}
+		if bs.Verify(label.Mul(multiplier), signature, rsaE, rsaN) {
+			reVotes++
+			continue
+		}
+		return "", fmt.Errorf("ballot %s: registrar signature is invalid", ballot.Label)
+	}
+
+	return fmt.Sprintf("%d ballots, %d re-votes", len(rec.Ballots), reVotes), nil
+}
@@ -0,0 +1,93 @@
+package tally
+
+import (
+	"errors"
+	"ev/internal/crypto/bigint"
+	"ev/internal/models"
+	"fmt"
+	"math/bits"
+)
+
+// Ёмкость счетчиков. Сумма бюллетеней шифрует Σ count_i * 2^(base*i): счетчик варианта i занимает
+// base бит и вмещает не больше 2^base - 1 голосов. При большем числе голосов счетчик переносится
+// в соседний, и итог искажается без какого-либо признака ошибки. Поэтому base выбирается
+// по суммарному весу голосующих при создании голосования, Счетчик не принимает бюллетени сверх ёмкости,
+// а расшифрованная сумма с лишними или непредставимыми счетчиками отвергается
+
+// MaxBase — наибольший размер счетчика в битах: итоги вариантов хранятся в int64
+const MaxBase = 63
+
+// PerBallot возвращает наибольший вклад бюллетеня с весом 1 в один счетчик:
+// бюллетень с распределением баллов может отдать варианту все maxChoices баллов
+func PerBallot(votingType string, maxChoices int) uint64 {
+	if votingType == models.VotingTypeCumulative && maxChoices > 1 {
+		return uint64(maxChoices)
+	}
+	return 1
+}
+
+// MaxCount возвращает наибольшее значение счетчика для бюллетеней суммарного веса totalWeight
+func MaxCount(votingType string, maxChoices int, totalWeight uint64) (uint64, error) {
+	hi, count := bits.Mul64(totalWeight, PerBallot(votingType, maxChoices))
+	if hi != 0 || bits.Len64(count) > MaxBase {
+		return 0, fmt.Errorf("total weight %d does not fit into a %d-bit counter", totalWeight, MaxBase)
+	}
+	return count, nil
+}
+
+// SizeBase возвращает наименьший размер счетчика, вмещающего maxCount голосов
+func SizeBase(maxCount uint64) uint {
+	return uint(max(bits.Len64(maxCount), 1))
+}
+
+// Capacity возвращает наибольшее число голосов, которое вмещает счетчик размером base бит
+func Capacity(base uint) uint64 {
+	if base >= MaxBase {
+		return 1<<MaxBase - 1
+	}
+	return 1<<base - 1
+}
+
+// PlaintextBits возвращает число бит, которое гарантированно вмещает открытый текст схемы
+// Дамгорда–Юрика с модулем n и показателем s, плюс один: n^s ≥ 2^(s·(bitlen(n)-1)).
+// При s = 1 это длина n, как для Paillier
+func PlaintextBits(n *bigint.BigInt, s uint) int {
+	return int(max(s, 1))*(n.BitLen()-1) + 1
+}
+
+// CheckBase проверяет, что slots счетчиков по base бит помещаются в открытый текст
+// длиной plaintextBits бит (см. PlaintextBits)
+func CheckBase(base uint, slots, plaintextBits int) error {
+	if base == 0 || base > MaxBase {
+		return fmt.Errorf("counter size %d is out of range 1..%d", base, MaxBase)
+	}
+	if uint64(slots)*uint64(base) >= uint64(plaintextBits) {
+		return fmt.Errorf("%d counters of %d bits do not fit into a %d-bit plaintext", slots, base, plaintextBits)
+	}
+	return nil
+}
+
+// DecodeCounts раскладывает расшифрованную сумму на slots счетчиков по base бит.
+// Сумма со счетчиками за пределами slots или не представимыми в int64 — признак переполнения
+func DecodeCounts(sum *bigint.BigInt, base uint, slots int) ([]int64, error) {
+	if base == 0 || base > MaxBase {
+		return nil, fmt.Errorf("counter size %d is out of range 1..%d", base, MaxBase)
+	}
+	if sum.Sign() < 0 {
+		return nil, errors.New("decrypted sum is negative")
+	}
+
+	chunks := sum.SplitIntoChunks(base)
+	if len(chunks) > slots {
+		return nil, fmt.Errorf("decrypted sum has %d counters for %d options", len(chunks), slots)
+	}
+
+	counts := make([]int64, slots)
+	for i, chunk := range chunks {
+		if !chunk.IsInt64() {
+			return nil, fmt.Errorf("counter %d is out of int64 range", i)
+		}
+		counts[i] = chunk.Int64()
+	}
+	return counts, nil
+}
@@ -0,0 +1,273 @@
+package tally
+
+import (
+	"errors"
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/paillier"
+	"ev/internal/crypto/zkp"
+	"ev/internal/models"
+	"fmt"
+	"math/bits"
+)
+
+// Ранжированный бюллетень. Ранжирование — перестановка вариантов: ranking[r] — вариант на месте r,
+// место 0 — наивысшее. Бюллетень шифрует матрицу перестановки m×m с ячейками base бит
+// и доказывает, что это перестановка (см. zkp.ProveRanking). Мгновенный второй тур нелинеен,
+// поэтому бюллетени не суммируются: к каждому добавляется его открытый вес, Счетчик перемешивает
+// и перешифровывает их с доказательством (zkp.Shuffle), и расшифровываются только перемешанные
+// бюллетени, не связанные с метками. По расшифрованным ранжированиям раунды может пересчитать
+// любой наблюдатель
+
+// RankBase возвращает размер ячейки матрицы перестановки m вариантов:
+// произведение строк содержит в каждой ячейке число до m, которое не должно переноситься
+func RankBase(m int) uint {
+	return uint(bits.Len(uint(m)))
+}
+
+// CheckCapacity проверяет, что бюллетень голосования данного типа с options вариантами
+// и счетчиками по base бит помещается в открытый текст длиной plaintextBits бит (см. PlaintextBits).
+// Перемешиваемый ранжированный бюллетень содержит матрицу перестановки и вес до MaxBase бит
+func CheckCapacity(votingType string, options int, base uint, plaintextBits int) error {
+	if votingType != models.VotingTypeRanked {
+		return CheckBase(base, options, plaintextBits)
+	}
+	if base == 0 || base > MaxBase || uint64(options) >= uint64(1)<<base {
+		return fmt.Errorf("ranking cells of %d bits do not fit %d options", base, options)
+	}
+	if uint64(options)*uint64(options)*uint64(base)+MaxBase >= uint64(plaintextBits) {
+		return fmt.Errorf("ranking of %d options with %d-bit cells does not fit into a %d-bit plaintext", options, base, plaintextBits)
+	}
+	return nil
+}
+
+// RankedInput возвращает перемешиваемый шифротекст бюллетеня: ballot · g^(weight * 2^(base*m*m)).
+// Вес добавляется открытым шифрованием, его может повторить любой наблюдатель
+func RankedInput(n *bigint.BigInt, s uint, ballot *bigint.BigInt, weight uint64, base uint, m int) *bigint.BigInt {
+	_, nn := zkp.Moduli(n, s)
+	g := n.Add(bigint.NewBigIntFromInt(1))
+	shifted := bigint.NewBigIntFromUint(weight).Lsh(base * uint(m*m))
+	return ballot.Mul(g.ModExp(shifted, nn)).Mod(nn)
+}
+
+// Ballot — расшифрованный перемешанный ранжированный бюллетень
+type Ballot struct {
+	Ranking []int `json:"ranking"`
+	Weight  int64 `json:"weight"`
+}
+
+// DecodeRanking раскладывает расшифрованный перемешанный бюллетень на ранжирование m вариантов и вес
+func DecodeRanking(plaintext *bigint.BigInt, base uint, m int) (Ballot, error) {
+	if plaintext.Sign() < 0 {
+		return Ballot{}, errors.New("decrypted ballot is negative")
+	}
+
+	cellBits := base * uint(m*m)
+	weight := plaintext.Rsh(cellBits)
+	if !weight.IsInt64() || weight.Int64() < 1 {
+		return Ballot{}, errors.New("decrypted ballot has no valid weight")
+	}
+
+	cells := make([]*bigint.BigInt, m*m)
+	for i, chunk := range plaintext.And(bigint.NewBigIntFromInt(1).Lsh(cellBits).Sub(bigint.NewBigIntFromInt(1))).SplitIntoChunks(base) {
+		cells[i] = chunk
+	}
+
+	one := bigint.NewBigIntFromInt(1)
+	ranking := make([]int, m)
+	used := make([]bool, m)
+	for place := range ranking {
+		ranking[place] = -1
+		for option := 0; option < m; option++ {
+			cell := cells[place*m+option]
+			if cell == nil || cell.Sign() == 0 {
+				continue
+			}
+			if !cell.Eq(one) || ranking[place] != -1 || used[option] {
+				return Ballot{}, fmt.Errorf("decrypted ballot is not a permutation at place %d", place)
+			}
+			ranking[place] = option
+			used[option] = true
+		}
+		if ranking[place] == -1 {
+			return Ballot{}, fmt.Errorf("decrypted ballot has no option at place %d", place)
+		}
+	}
+	return Ballot{Ranking: ranking, Weight: weight.Int64()}, nil
+}
+
+// RankedProof — доказательство итога ранжированного голосования: перемешивание бюллетеней
+// и расшифрование каждого перемешанного бюллетеня. Decryptions[i] доказывает расшифрование
+// Plaintexts[i] ключом Счетчика; при пороговом ключе Partials[t][i] — частичное расшифрование
+// бюллетеня i доверенным лицом t
+type RankedProof struct {
+	Shuffle     *zkp.ShuffleRecord              `json:"shuffle"`
+	Plaintexts  []*bigint.BigInt                `json:"plaintexts"`
+	Decryptions []*paillier.DecryptionProof     `json:"decryptions,omitempty"`
+	Partials    [][]*paillier.PartialDecryption `json:"partials,omitempty"`
+}
+
+// Verify проверяет перемешивание входов inputs (см. RankedInput) и расшифрование каждого выхода
+func (proof *RankedProof) Verify(n *bigint.BigInt, s uint, threshold *paillier.ThresholdPublicKey, votingID *bigint.BigInt, inputs []*bigint.BigInt) error {
+	if proof.Shuffle == nil {
+		return errors.New("ranked result has no shuffle")
+	}
+	if err := proof.Shuffle.Verify(n, s, votingID, inputs); err != nil {
+		return err
+	}
+
+	outputs := proof.Shuffle.Outputs
+	if len(proof.Plaintexts) != len(outputs) {
+		return fmt.Errorf("%d plaintexts for %d shuffled ballots", len(proof.Plaintexts), len(outputs))
+	}
+	for i, plaintext := range proof.Plaintexts {
+		if plaintext == nil {
+			return fmt.Errorf("shuffled ballot %d has no plaintext", i)
+		}
+	}
+
+	if threshold != nil {
+		for i, output := range outputs {
+			partials := make([]*paillier.PartialDecryption, len(proof.Partials))
+			for t, trustee := range proof.Partials {
+				if len(trustee) != len(outputs) {
+					return fmt.Errorf("trustee %d decrypted %d of %d shuffled ballots", t, len(trustee), len(outputs))
+				}
+				if trustee[i] == nil {
+					return fmt.Errorf("trustee %d did not decrypt shuffled ballot %d", t, i)
+				}
+				partials[t] = trustee[i]
+			}
+			if err := paillier.VerifyThresholdDecryption(threshold, output, proof.Plaintexts[i], partials); err != nil {
+				return fmt.Errorf("shuffled ballot %d: %w", i, err)
+			}
+		}
+		return nil
+	}
+
+	if len(proof.Decryptions) != len(outputs) {
+		return fmt.Errorf("%d decryption proofs for %d shuffled ballots", len(proof.Decryptions), len(outputs))
+	}
+	for i, output := range outputs {
+		if proof.Decryptions[i] == nil {
+			return fmt.Errorf("shuffled ballot %d has no decryption proof", i)
+		}
+		if err := paillier.VerifyDecryptionDJ(output, proof.Plaintexts[i], n, s, proof.Decryptions[i]); err != nil {
+			return fmt.Errorf("shuffled ballot %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Ballots раскладывает расшифрованные перемешанные бюллетени на ранжирования m вариантов
+func (proof *RankedProof) Ballots(base uint, m int) ([]Ballot, error) {
+	ballots := make([]Ballot, len(proof.Plaintexts))
+	for i, plaintext := range proof.Plaintexts {
+		ballot, err := DecodeRanking(plaintext, base, m)
+		if err != nil {
+			return nil, fmt.Errorf("shuffled ballot %d: %w", i, err)
+		}
+		ballots[i] = ballot
+	}
+	return ballots, nil
+}
+
+// Round — раунд мгновенного второго тура. Counts — голоса продолжающих борьбу вариантов;
+// в раунде либо определяется победитель, либо выбывает вариант Eliminated
+type Round struct {
+	Counts     map[int]int64 `json:"counts"`
+	Eliminated *int          `json:"eliminated,omitempty"`
+	Winner     *int          `json:"winner,omitempty"`
+}
+
+// FirstPreferences возвращает голоса первого раунда: сумму весов бюллетеней по варианту на первом месте
+func FirstPreferences(m int, ballots []Ballot) map[int]int64 {
+	counts := make(map[int]int64, m)
+	for o := 0; o < m; o++ {
+		counts[o] = 0
+	}
+	for _, ballot := range ballots {
+		counts[ballot.Ranking[0]] += ballot.Weight
+	}
+	return counts
+}
+
+// InstantRunoff проводит мгновенный второй тур по ранжированиям бюллетеней m вариантов.
+// Голос бюллетеня в раунде с его весом отдаётся высшему в ранжировании из продолжающих борьбу
+// вариантов. Побеждает вариант с большинством голосов раунда или последний оставшийся.
+// Выбывает вариант с наименьшим числом голосов; при равенстве — набравший меньше
+// в предыдущих раундах, а при полном равенстве — вариант с большим номером
+func InstantRunoff(m int, ballots []Ballot) ([]Round, error) {
+	if m < 1 {
+		return nil, errors.New("no options to rank")
+	}
+
+	var total int64
+	for i, ballot := range ballots {
+		if len(ballot.Ranking) != m {
+			return nil, fmt.Errorf("ballot %d ranks %d of %d options", i, len(ballot.Ranking), m)
+		}
+		if ballot.Weight < 1 {
+			return nil, fmt.Errorf("ballot %d has weight %d", i, ballot.Weight)
+		}
+		total += ballot.Weight
+	}
+	if total == 0 {
+		return []Round{}, nil
+	}
+
+	continuing := make(map[int]bool, m)
+	for o := 0; o < m; o++ {
+		continuing[o] = true
+	}
+
+	rounds := []Round{}
+	for {
+		round := Round{Counts: make(map[int]int64, len(continuing))}
+		for o := range continuing {
+			round.Counts[o] = 0
+		}
+		for _, ballot := range ballots {
+			for _, option := range ballot.Ranking {
+				if continuing[option] {
+					round.Counts[option] += ballot.Weight
+					break
+				}
+			}
+		}
+
+		for o := 0; o < m; o++ {
+			if continuing[o] && (round.Counts[o]*2 > total || len(continuing) == 1) {
+				winner := o
+				round.Winner = &winner
+				return append(rounds, round), nil
+			}
+		}
+
+		eliminated := -1
+		for o := m - 1; o >= 0; o-- {
+			if !continuing[o] {
+				continue
+			}
+			if eliminated == -1 || fewerVotes(o, eliminated, round, rounds) {
+				eliminated = o
+			}
+		}
+		round.Eliminated = &eliminated
+		delete(continuing, eliminated)
+		rounds = append(rounds, round)
+	}
+}
+
+// fewerVotes сообщает, что вариант a набрал меньше b в текущем раунде,
+// а при равенстве — в ближайшем предыдущем раунде, где они различаются
+func fewerVotes(a, b int, current Round, previous []Round) bool {
+	if current.Counts[a] != current.Counts[b] {
+		return current.Counts[a] < current.Counts[b]
+	}
+	for i := len(previous) - 1; i >= 0; i-- {
+		if previous[i].Counts[a] != previous[i].Counts[b] {
+			return previous[i].Counts[a] < previous[i].Counts[b]
+		}
+	}
+	return false
+}
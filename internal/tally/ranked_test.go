@@ -0,0 +1,151 @@
+package tally
+
+import (
+	"ev/internal/crypto/bigint"
+	"ev/internal/crypto/paillier"
+	"ev/internal/crypto/zkp"
+	"ev/internal/models"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRankedTallyRoundTrip(t *testing.T) {
+	key, err := paillier.NewPaillierKeyPair(512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const m = 3
+	base := RankBase(m)
+	if err = CheckCapacity(models.VotingTypeRanked, m, base, PlaintextBits(key.N, 1)); err != nil {
+		t.Fatal(err)
+	}
+	votingID := bigint.NewBigIntFromInt(5)
+
+	cast := []Ballot{
+		{Ranking: []int{0, 1, 2}, Weight: 4},
+		{Ranking: []int{1, 2, 0}, Weight: 3},
+		{Ranking: []int{2, 1, 0}, Weight: 2},
+	}
+
+	inputs := make([]*bigint.BigInt, len(cast))
+	for i, ballot := range cast {
+		rows, _ := zkp.EncryptRanking(key.N, 1, ballot.Ranking, base)
+		ciphertext := zkp.CombineChoices(key.N, 1, rows, zkp.RankingBase(m, base))
+		inputs[i] = RankedInput(key.N, 1, ciphertext, uint64(ballot.Weight), base, m)
+	}
+
+	proof := &RankedProof{Shuffle: zkp.Shuffle(key.N, 1, votingID, inputs)}
+	for _, output := range proof.Shuffle.Outputs {
+		plaintext, err := paillier.DecryptDJ(output, key.Lambda, key.N, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decryption, err := paillier.ProveDecryptionDJ(output, plaintext, key.Lambda, key.N, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof.Plaintexts = append(proof.Plaintexts, plaintext)
+		proof.Decryptions = append(proof.Decryptions, decryption)
+	}
+
+	if err = proof.Verify(key.N, 1, nil, votingID, inputs); err != nil {
+		t.Fatalf("valid ranked proof rejected: %v", err)
+	}
+
+	ballots, err := proof.Ballots(base, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	describe := func(b Ballot) string { return fmt.Sprint(b.Ranking, b.Weight) }
+	got, want := []string{}, []string{}
+	for i := range cast {
+		got, want = append(got, describe(ballots[i])), append(want, describe(cast[i]))
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decrypted ballots %v, cast %v", got, want)
+	}
+
+	if first := FirstPreferences(m, ballots); !reflect.DeepEqual(first, map[int]int64{0: 4, 1: 3, 2: 2}) {
+		t.Fatalf("first preferences %v", first)
+	}
+
+	proof.Plaintexts[0] = proof.Plaintexts[0].Add(bigint.NewBigIntFromInt(1))
+	if err = proof.Verify(key.N, 1, nil, votingID, inputs); err == nil {
+		t.Fatal("ranked proof with a changed plaintext accepted")
+	}
+}
+
+func TestDecodeRanking(t *testing.T) {
+	const m = 3
+	base := RankBase(m)
+	plaintext := func(cells [][2]int, weight int64) *bigint.BigInt {
+		p := bigint.NewBigIntFromInt(weight).Lsh(base * m * m)
+		for _, cell := range cells {
+			p = p.Add(bigint.NewBigIntFromInt(1).Lsh(base * uint(cell[0]*m+cell[1])))
+		}
+		return p
+	}
+
+	ballot, err := DecodeRanking(plaintext([][2]int{{0, 2}, {1, 0}, {2, 1}}, 3), base, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ballot, Ballot{Ranking: []int{2, 0, 1}, Weight: 3}) {
+		t.Fatalf("decoded %v", ballot)
+	}
+
+	invalid := map[string]*bigint.BigInt{
+		"repeated option": plaintext([][2]int{{0, 0}, {1, 0}, {2, 1}}, 1),
+		"empty place":     plaintext([][2]int{{0, 0}, {1, 1}}, 1),
+		"two options":     plaintext([][2]int{{0, 0}, {0, 1}, {1, 1}, {2, 2}}, 1),
+		"no weight":       plaintext([][2]int{{0, 0}, {1, 1}, {2, 2}}, 0),
+	}
+	for name, p := range invalid {
+		if _, err := DecodeRanking(p, base, m); err == nil {
+			t.Errorf("%s: decoded", name)
+		}
+	}
+}
+
+func TestInstantRunoff(t *testing.T) {
+	ballots := []Ballot{
+		{Ranking: []int{0, 1, 2}, Weight: 4},
+		{Ranking: []int{1, 2, 0}, Weight: 3},
+		{Ranking: []int{2, 1, 0}, Weight: 2},
+	}
+	rounds, err := InstantRunoff(3, ballots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Первый раунд: 4/3/2 без большинства, выбывает вариант 2; его голоса переходят к варианту 1
+	if len(rounds) != 2 {
+		t.Fatalf("%d rounds, expected 2", len(rounds))
+	}
+	if rounds[0].Eliminated == nil || *rounds[0].Eliminated != 2 {
+		t.Fatalf("round 1 eliminated %v", rounds[0].Eliminated)
+	}
+	if rounds[1].Winner == nil || *rounds[1].Winner != 1 || rounds[1].Counts[1] != 5 {
+		t.Fatalf("round 2: %+v", rounds[1])
+	}
+
+	// При полном равенстве выбывает вариант с большим номером
+	rounds, err = InstantRunoff(2, []Ballot{{Ranking: []int{0, 1}, Weight: 1}, {Ranking: []int{1, 0}, Weight: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *rounds[0].Eliminated != 1 || *rounds[len(rounds)-1].Winner != 0 {
+		t.Fatalf("tie resolved as %+v", rounds)
+	}
+
+	if _, err = InstantRunoff(3, []Ballot{{Ranking: []int{0, 1}, Weight: 1}}); err == nil {
+		t.Error("incomplete ranking accepted")
+	}
+	if _, err = InstantRunoff(3, []Ballot{{Ranking: []int{0, 1, 2}, Weight: 0}}); err == nil {
+		t.Error("ballot without weight accepted")
+	}
+}
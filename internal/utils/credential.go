@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"ev/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultCredentialValidity — срок действия учетных данных TempID, если он не задан в конфиге
+const defaultCredentialValidity = 10 * time.Minute
+
+// TempIDCredential — утверждение IDP о псевдонимах голосующего в голосовании.
+// Weight — вес голосующего по списку голосования; отсутствует, если вес равен 1
+type TempIDCredential struct {
+	VotingID  string   `json:"voting_id"`
+	TempIDs   []string `json:"temp_ids"`
+	ExpiresAt int64    `json:"expires_at"`
+	Weight    uint64   `json:"weight,omitempty"`
+}
+
+// SignedTempIDCredential — учетные данные в том виде, в котором их передаёт голосующий.
+// Подписываются именно байты Credential, поэтому повторная сериализация не нужна
+type SignedTempIDCredential struct {
+	Credential string `json:"credential"`
+	Signature  string `json:"signature"`
+}
+
+// IssueTempIDCredential выпускает подписанные IDP учетные данные TempID с весом weight для голосования votingID
+func IssueTempIDCredential(token *jwt.Token, votingID string, weight uint64) (*SignedTempIDCredential, error) {
+	privateKey, err := decodeKey(config.Config.IDPCredential.PrivateKey, ed25519.PrivateKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("idp private key: %w", err)
+	}
+
+	tempIDs, err := GetTempIDsFromToken(token, votingID)
+	if err != nil {
+		return nil, err
+	}
+
+	validity := defaultCredentialValidity
+	if config.Config.IDPCredential.ValidityMinutes > 0 {
+		validity = time.Duration(config.Config.IDPCredential.ValidityMinutes) * time.Minute
+	}
+
+	payload, err := json.Marshal(TempIDCredential{
+		VotingID:  votingID,
+		TempIDs:   tempIDs,
+		ExpiresAt: time.Now().Add(validity).Unix(),
+		Weight:    weight,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedTempIDCredential{
+		Credential: base64.StdEncoding.EncodeToString(payload),
+		Signature:  base64.StdEncoding.EncodeToString(ed25519.Sign(ed25519.PrivateKey(privateKey), payload)),
+	}, nil
+}
+
+// VerifyTempIDCredential проверяет подпись IDP, срок действия и голосование без обращения к IDP
+func VerifyTempIDCredential(signed *SignedTempIDCredential, votingID string) (*TempIDCredential, error) {
+	if signed == nil {
+		return nil, errors.New("credential is missing")
+	}
+
+	publicKey, err := decodeKey(config.Config.IDPCredential.PublicKey, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("idp public key: %w", err)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(signed.Credential)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(publicKey), payload, signature) {
+		return nil, errors.New("invalid credential signature")
+	}
+
+	var credential TempIDCredential
+	if err = json.Unmarshal(payload, &credential); err != nil {
+		return nil, err
+	}
+
+	if credential.VotingID != votingID {
+		return nil, errors.New("credential was issued for another voting")
+	}
+	if time.Now().Unix() > credential.ExpiresAt {
+		return nil, errors.New("credential has expired")
+	}
+	if len(credential.TempIDs) == 0 {
+		return nil, errors.New("credential has no temp IDs")
+	}
+
+	return &credential, nil
+}
+
+func decodeKey(encoded string, size int) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", size, len(key))
+	}
+	return key, nil
+}
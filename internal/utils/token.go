@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -104,27 +105,36 @@ func GetUserIDFromToken(token *jwt.Token) (int, error) {
 	return 0, errors.New("user_id not found in token")
 }
 
-func GetTempIDFromToken(token *jwt.Token) (string, error) {
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", errors.New("invalid token claims")
+// GetTempIDsFromToken возвращает псевдонимы пользователя для голосования votingID:
+// первым идёт TempID под активным ключом, за ним — под ключами до ротации
+func GetTempIDsFromToken(token *jwt.Token, votingID string) ([]string, error) {
+	userID, err := GetUserIDFromToken(token)
+	if err != nil {
+		return nil, err
 	}
 
-	userID, ok := claims["user_id"].(float64)
-	if !ok {
-		return "", errors.New("user_id not found or invalid type in token")
+	keys := config.Config.TempID
+	activeKey, ok := keys.Keys[keys.ActiveKey]
+	if !ok || activeKey == "" {
+		return nil, errors.New("active temp ID key is not configured")
 	}
 
-	nonce, ok := claims["nonce"].(string)
-	if !ok {
-		return "", errors.New("nonce not found or invalid type in token")
+	tempIDs := []string{ComputeTempID(activeKey, userID, votingID)}
+	for keyID, key := range keys.Keys {
+		if keyID == keys.ActiveKey || key == "" {
+			continue
+		}
+		tempIDs = append(tempIDs, ComputeTempID(key, userID, votingID))
 	}
 
-	// Создаем хеш из userID и nonce
-	hash := sha256.New()
-	hash.Write([]byte(fmt.Sprintf("%d%s", int(userID), nonce)))
-	tempID := hex.EncodeToString(hash.Sum(nil))
+	return tempIDs, nil
+}
 
-	return tempID, nil
+// ComputeTempID вычисляет HMAC-SHA256(key, userID | votingID).
+// Один и тот же пользователь получает один и тот же TempID в голосовании при любом входе,
+// а без ключа TempID нельзя сопоставить с пользователем
+func ComputeTempID(key string, userID int, votingID string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(fmt.Sprintf("%d|%s", userID, votingID)))
+	return hex.EncodeToString(mac.Sum(nil))
 }
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"ev/internal/config"
+	"ev/internal/crypto/merklie"
+)
+
+// SignTreeHead подписывает корень журнала ключом Счетчика из конфига
+func SignTreeHead(head *merklie.TreeHead) error {
+	privateKey, err := decodeKey(config.Config.TreeHead.PrivateKey, ed25519.PrivateKeySize)
+	if err != nil {
+		return fmt.Errorf("tree head private key: %w", err)
+	}
+
+	head.Sign(ed25519.PrivateKey(privateKey))
+	return nil
+}
+
+// VerifyTreeHead проверяет подпись корня журнала открытым ключом Счетчика из конфига
+func VerifyTreeHead(head *merklie.TreeHead) error {
+	publicKey, err := decodeKey(config.Config.TreeHead.PublicKey, ed25519.PublicKeySize)
+	if err != nil {
+		return fmt.Errorf("tree head public key: %w", err)
+	}
+
+	return head.Verify(ed25519.PublicKey(publicKey))
+}
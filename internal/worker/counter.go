@@ -2,11 +2,9 @@ package worker
 
 import (
 	"context"
+	"ev/internal/ballotlog"
 	"ev/internal/config"
-	"ev/internal/crypto/merklie"
 	"ev/internal/database"
-	"ev/internal/models"
-	"fmt"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -28,69 +26,23 @@ func ReloadResults() {
 	db := database.GetCounterPGConnection()
 	ctx := context.Background()
 
-	rows, err := db.Query(ctx, "SELECT * FROM encrypted_votes")
-	if err != nil {
-		log.Error().Err(err).Msg("Error reloading results")
-	}
-
-	defer rows.Close()
-
-	// Группируем голоса по voting_id
-	votesByVotingID := make(map[string][]models.EncryptedVote)
-
-	for rows.Next() {
-		var encryptedVote models.EncryptedVote
-		err = rows.Scan(&encryptedVote.VotingID, &encryptedVote.Label, &encryptedVote.EncryptedVote, &encryptedVote.CreatedAt)
-		if err != nil {
-			log.Error().Err(err).Msg("Error scanning encrypted vote")
-			continue
-		}
-		votingIDStr := fmt.Sprintf("%d", encryptedVote.VotingID)
-		votesByVotingID[votingIDStr] = append(votesByVotingID[votingIDStr], encryptedVote)
-	}
-
-	// Для каждого голосования в конфиге проверяем наличие голосов и строим дерево
+	// Для каждого голосования в конфиге публикуем корень дерева над журналом бюллетеней
 	for votingID := range config.CryptoParams {
 
-		rows, err := db.Query(ctx, "SELECT id FROM votings WHERE id = $1 AND state=1", votingID)
+		var logSize int
+		err := db.QueryRow(ctx, "SELECT COUNT(*) FROM ballot_log bl JOIN votings v ON v.id = bl.voting_id WHERE bl.voting_id = $1 AND v.state = 1", votingID).Scan(&logSize)
 		if err != nil {
 			log.Error().Err(err).Msg("Error reloading results")
-		}
-
-		defer rows.Close()
-
-		if !rows.Next() {
-			log.Info().
-				Str("voting_id", votingID).
-				Msg("Voting is not active")
 			continue
 		}
 
-		votes, hasVotes := votesByVotingID[votingID]
-		if !hasVotes {
+		if logSize == 0 {
 			log.Info().
 				Str("voting_id", votingID).
-				Msg("No votes found for voting")
+				Msg("Voting is not active or has no votes")
 			continue
 		}
 
-		// Создаем новое дерево Merkle для текущего голосования
-		merkleTree := merklie.NewMerkleTree()
-
-		// Добавляем голоса в дерево
-		for _, vote := range votes {
-			merkleTree.AddLeaf(vote.EncryptedVote)
-		}
-
-		// Получаем корень дерева
-		rootHash := merkleTree.GetRoot()
-
-		log.Info().
-			Str("voting_id", votingID).
-			Str("merkle_root", rootHash).
-			Int("total_votes", len(votes)).
-			Msg("Merkle tree root calculated")
-
 		// Начинаем транзакцию
 		tx, err := db.Begin(ctx)
 		if err != nil {
@@ -101,11 +53,8 @@ func ReloadResults() {
 			continue
 		}
 
-		currentTime := time.Now()
-
-		// Сохраняем корень в базу данных
-		var insertedID int64
-		err = tx.QueryRow(ctx, "INSERT INTO merklie_roots (voting_id, root_value, created_at) VALUES ($1, $2, $3) RETURNING id", votingID, rootHash, currentTime).Scan(&insertedID)
+		// Сохраняем корень, снимок действующих бюллетеней и записи переголосований в базу данных
+		_, rootHash, treeSize, err := ballotlog.PublishRoot(ctx, tx, votingID, time.Now())
 		if err != nil {
 			tx.Rollback(ctx)
 			log.Error().
@@ -115,19 +64,6 @@ func ReloadResults() {
 			continue
 		}
 
-		for _, vote := range votes {
-			_, err = tx.Exec(ctx, "INSERT INTO public_encrypted_votes (voting_id, label, corresponds_to_merklie_root, encrypted_vote, created_at, moved_into_at) VALUES ($1, $2, $3, $4, $5, $6)",
-				vote.VotingID, vote.Label, insertedID, vote.EncryptedVote, vote.CreatedAt, currentTime)
-			if err != nil {
-				tx.Rollback(ctx)
-				log.Error().
-					Err(err).
-					Str("voting_id", votingID).
-					Msg("Failed to insert vote into public_encrypted_votes")
-				continue
-			}
-		}
-
 		// Фиксируем транзакцию
 		if err = tx.Commit(ctx); err != nil {
 			log.Error().
@@ -137,5 +73,11 @@ func ReloadResults() {
 			tx.Rollback(ctx)
 			continue
 		}
+
+		log.Info().
+			Str("voting_id", votingID).
+			Str("merkle_root", rootHash).
+			Int("tree_size", treeSize).
+			Msg("Merkle tree root published")
 	}
 }
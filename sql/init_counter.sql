@@ -3,6 +3,13 @@ CREATE TABLE IF NOT EXISTS votings (
     name VARCHAR(100) NOT NULL,
     question TEXT NOT NULL,
     state INT NOT NULL,
+    -- Тип бюллетеня: single, approval, multi_choice (не больше max_choices вариантов), ranked
+    -- или cumulative (max_choices баллов)
+    voting_type VARCHAR(20) NOT NULL DEFAULT 'single',
+    max_choices INT NOT NULL DEFAULT 1,
+    -- Размер счетчика варианта в битах, подобранный по суммарному весу голосующих;
+    -- 0 — используется base из crypto.json
+    base INT NOT NULL DEFAULT 0,
     start_time TIMESTAMP NOT NULL,
     audit_time TIMESTAMP NOT NULL,
     end_time TIMESTAMP NOT NULL
@@ -12,7 +19,81 @@ CREATE TABLE IF NOT EXISTS encrypted_votes (
     voting_id INT NOT NULL,
     label TEXT NOT NULL,
     encrypted_vote TEXT NOT NULL,
+    zkp_proof TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    -- Вес бюллетеня, удостоверенный ключом подписи Регистратора (см. weight_classes в crypto.json)
+    weight BIGINT NOT NULL DEFAULT 1,
     created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (voting_id) REFERENCES votings(id),
+    UNIQUE (voting_id, label)
+);
+
+
+CREATE TABLE IF NOT EXISTS spent_credentials(
+    id SERIAL PRIMARY KEY,
+    voting_id INT NOT NULL,
+    label TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (voting_id) REFERENCES votings(id),
+    UNIQUE (voting_id, signature),
+    UNIQUE (voting_id, label)
+);
+
+
+-- Журнал бюллетеней только дополняется: переголосование не удаляет запись,
+-- а отмечает в replaced_by номер записи, которая её заменила
+CREATE TABLE IF NOT EXISTS ballot_log(
+    voting_id INT NOT NULL,
+    log_index INT NOT NULL,
+    label TEXT NOT NULL,
+    encrypted_vote TEXT NOT NULL,
+    zkp_proof TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    -- Вес бюллетеня, удостоверенный ключом подписи Регистратора (см. weight_classes в crypto.json)
+    weight BIGINT NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL,
+    replaced_by INT,
+    PRIMARY KEY (voting_id, log_index),
+    FOREIGN KEY (voting_id) REFERENCES votings(id),
+    UNIQUE (voting_id, label)
+);
+
+
+-- Переголосования: nonce старого бюллетеня доказывает, что его заменил владелец,
+-- так как old_label = ComputeDigest(old_nonce, зашифрованный старый голос)
+CREATE TABLE IF NOT EXISTS revotes(
+    voting_id INT NOT NULL,
+    old_label TEXT NOT NULL,
+    old_nonce TEXT NOT NULL,
+    new_label TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (voting_id, old_label),
+    FOREIGN KEY (voting_id) REFERENCES votings(id),
+    UNIQUE (voting_id, new_label)
+);
+
+
+CREATE TABLE IF NOT EXISTS public_revotes(
+    voting_id INT NOT NULL,
+    old_label TEXT NOT NULL,
+    old_nonce TEXT NOT NULL,
+    new_label TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    moved_into_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (voting_id, old_label),
+    FOREIGN KEY (voting_id) REFERENCES votings(id)
+);
+
+
+-- Сохранённые уровни дерева над журналом бюллетеней (merklie.MerkleTree.MarshalBinary),
+-- чтобы после перезапуска не пересчитывать дерево по всему журналу
+CREATE TABLE IF NOT EXISTS merklie_tree_states(
+    voting_id INT PRIMARY KEY,
+    tree_version INT NOT NULL,
+    tree_size INT NOT NULL,
+    state BYTEA NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
     FOREIGN KEY (voting_id) REFERENCES votings(id)
 );
 
@@ -22,6 +103,15 @@ CREATE TABLE IF NOT EXISTS merklie_roots(
     voting_id INT NOT NULL,
     root_value TEXT NOT NULL,
     created_at TIMESTAMP NOT NULL,
+    tree_version INT NOT NULL DEFAULT 1,
+    tree_size INT,
+    -- Подпись Счетчика над (voting_id, tree_version, tree_size, root_value, signed_at), см. merklie.TreeHead
+    signed_at BIGINT,
+    signature TEXT,
+    -- Корни деревьев, упорядоченных по метке: действующие бюллетени и записи замен (ballotlog.Boards)
+    board_root TEXT,
+    board_size INT,
+    revocation_root TEXT,
     FOREIGN KEY (voting_id) REFERENCES votings(id)
 );
 
@@ -31,6 +121,10 @@ CREATE TABLE IF NOT EXISTS public_encrypted_votes(
     label TEXT NOT NULL,
     corresponds_to_merklie_root INT NOT NULL,
     encrypted_vote TEXT NOT NULL,
+    zkp_proof TEXT NOT NULL,
+    signature TEXT NOT NULL,
+    -- Вес бюллетеня, удостоверенный ключом подписи Регистратора (см. weight_classes в crypto.json)
+    weight BIGINT NOT NULL DEFAULT 1,
     created_at TIMESTAMP NOT NULL,
     moved_into_at TIMESTAMP NOT NULL,
     FOREIGN KEY (voting_id) REFERENCES votings(id),
@@ -46,16 +140,65 @@ CREATE TABLE IF NOT EXISTS results(
     unencrypted_result TEXT NOT NULL,
     resulted_count TEXT NOT NULL,
     result_proof TEXT NOT NULL,
+    -- Раунды мгновенного второго тура ранжированного голосования (JSON)
+    rounds TEXT,
     created_at TIMESTAMP NOT NULL,
     FOREIGN KEY (voting_id) REFERENCES votings(id),
     FOREIGN KEY (corresponds_to_merklie_root) REFERENCES merklie_roots(id)
 );
 
 
+CREATE TABLE IF NOT EXISTS partial_decryptions(
+    id SERIAL PRIMARY KEY,
+    voting_id INT NOT NULL,
+    trustee_index INT NOT NULL,
+    crypted_result TEXT NOT NULL,
+    partial_decryption TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (voting_id) REFERENCES votings(id),
+    UNIQUE (voting_id, trustee_index, crypted_result)
+);
+
+
+-- Перемешивание ранжированных бюллетеней (zkp.ShuffleRecord, JSON): строится один раз
+-- для зашифрованной суммы, и доверенные лица расшифровывают одни и те же выходы
+CREATE TABLE IF NOT EXISTS shuffles(
+    id SERIAL PRIMARY KEY,
+    voting_id INT NOT NULL,
+    crypted_result TEXT NOT NULL,
+    shuffle TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (voting_id) REFERENCES votings(id),
+    UNIQUE (voting_id, crypted_result)
+);
+
+
 CREATE TABLE IF NOT EXISTS voting_options (
     id SERIAL PRIMARY KEY,
     voting_id INT NOT NULL,
     option_index INT NOT NULL,
     option_text TEXT NOT NULL,
     FOREIGN KEY (voting_id) REFERENCES votings(id)
-);
\ No newline at end of file
+);
+
+
+-- Столбцы, добавленные после первой версии схемы: CREATE TABLE IF NOT EXISTS не меняет
+-- существующие таблицы, поэтому для старых баз они добавляются отдельно
+ALTER TABLE encrypted_votes ADD COLUMN IF NOT EXISTS zkp_proof TEXT NOT NULL DEFAULT '';
+ALTER TABLE encrypted_votes ADD COLUMN IF NOT EXISTS signature TEXT NOT NULL DEFAULT '';
+ALTER TABLE public_encrypted_votes ADD COLUMN IF NOT EXISTS zkp_proof TEXT NOT NULL DEFAULT '';
+ALTER TABLE public_encrypted_votes ADD COLUMN IF NOT EXISTS signature TEXT NOT NULL DEFAULT '';
+ALTER TABLE merklie_roots ADD COLUMN IF NOT EXISTS tree_version INT NOT NULL DEFAULT 1;
+ALTER TABLE merklie_roots ADD COLUMN IF NOT EXISTS tree_size INT;
+ALTER TABLE merklie_roots ADD COLUMN IF NOT EXISTS signed_at BIGINT;
+ALTER TABLE merklie_roots ADD COLUMN IF NOT EXISTS signature TEXT;
+ALTER TABLE merklie_roots ADD COLUMN IF NOT EXISTS board_root TEXT;
+ALTER TABLE merklie_roots ADD COLUMN IF NOT EXISTS board_size INT;
+ALTER TABLE merklie_roots ADD COLUMN IF NOT EXISTS revocation_root TEXT;
+ALTER TABLE votings ADD COLUMN IF NOT EXISTS voting_type VARCHAR(20) NOT NULL DEFAULT 'single';
+ALTER TABLE votings ADD COLUMN IF NOT EXISTS max_choices INT NOT NULL DEFAULT 1;
+ALTER TABLE results ADD COLUMN IF NOT EXISTS rounds TEXT;
+ALTER TABLE encrypted_votes ADD COLUMN IF NOT EXISTS weight BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE public_encrypted_votes ADD COLUMN IF NOT EXISTS weight BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE ballot_log ADD COLUMN IF NOT EXISTS weight BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE votings ADD COLUMN IF NOT EXISTS base INT NOT NULL DEFAULT 0;
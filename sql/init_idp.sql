@@ -6,3 +6,12 @@ CREATE TABLE users (
 );
 
 
+-- Веса голосующих в голосовании (список голосующих с весами);
+-- голосующий без записи голосует с весом 1. IDP указывает вес в учетных данных TempID
+CREATE TABLE IF NOT EXISTS voter_weights (
+    user_id INT NOT NULL,
+    voting_id INT NOT NULL,
+    weight BIGINT NOT NULL CHECK (weight >= 1),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, voting_id)
+);
@@ -3,6 +3,13 @@ CREATE TABLE IF NOT EXISTS votings (
     name VARCHAR(100) NOT NULL,
     question TEXT NOT NULL,
     state INT NOT NULL,
+    -- Тип бюллетеня: single, approval, multi_choice (не больше max_choices вариантов), ranked
+    -- или cumulative (max_choices баллов)
+    voting_type VARCHAR(20) NOT NULL DEFAULT 'single',
+    max_choices INT NOT NULL DEFAULT 1,
+    -- Размер счетчика варианта в битах, подобранный по суммарному весу голосующих;
+    -- 0 — используется base из crypto.json
+    base INT NOT NULL DEFAULT 0,
     start_time TIMESTAMP NOT NULL,
     audit_time TIMESTAMP NOT NULL,
     end_time TIMESTAMP NOT NULL
@@ -23,4 +30,11 @@ CREATE TABLE IF NOT EXISTS voting_options (
     option_index INT NOT NULL,
     option_text TEXT NOT NULL,              
     FOREIGN KEY (voting_id) REFERENCES votings(id)
-);
\ No newline at end of file
+);
+
+
+-- Столбцы, добавленные после первой версии схемы: CREATE TABLE IF NOT EXISTS не меняет
+-- существующие таблицы, поэтому для старых баз они добавляются отдельно
+ALTER TABLE votings ADD COLUMN IF NOT EXISTS voting_type VARCHAR(20) NOT NULL DEFAULT 'single';
+ALTER TABLE votings ADD COLUMN IF NOT EXISTS max_choices INT NOT NULL DEFAULT 1;
+ALTER TABLE votings ADD COLUMN IF NOT EXISTS base INT NOT NULL DEFAULT 0;
@@ -1,15 +1,64 @@
+// Версии дерева Меркла, см. internal/crypto/merklie
+export const TREE_VERSION_1 = 1;
+export const TREE_VERSION_2 = 2;
+
 export function calculateSHA512(left, right) {
     const combined = left + right;
     return sha512(combined);
 }
 
-export function displayMerklePath(merklePathData) {
+function bytesToHex(bytes) {
+    return Array.from(new Uint8Array(bytes)).map(b => b.toString(16).padStart(2, '0')).join('');
+}
+
+function hexToBytes(hex) {
+    const bytes = new Uint8Array(hex.length / 2);
+    for (let i = 0; i < bytes.length; i++) {
+        bytes[i] = parseInt(hex.substr(i * 2, 2), 16);
+    }
+    return bytes;
+}
+
+async function sha256WithPrefix(prefix, bytes) {
+    const data = new Uint8Array(1 + bytes.length);
+    data[0] = prefix;
+    data.set(bytes, 1);
+    return bytesToHex(await crypto.subtle.digest('SHA-256', data));
+}
+
+// Хеш листа: в версии 2 — SHA-256(0x00 || бюллетень)
+export async function hashLeaf(version, data) {
+    if (version !== TREE_VERSION_2) {
+        return sha512(data);
+    }
+    return sha256WithPrefix(0x00, new TextEncoder().encode(data));
+}
+
+// Хеш узла: в версии 2 — SHA-256(0x01 || левый || правый) над байтами хешей
+export async function hashNode(version, left, right) {
+    if (version !== TREE_VERSION_2) {
+        return calculateSHA512(left, right);
+    }
+    const data = new Uint8Array(64);
+    data.set(hexToBytes(left), 0);
+    data.set(hexToBytes(right), 32);
+    return sha256WithPrefix(0x01, data);
+}
+
+function hashName(version) {
+    return version === TREE_VERSION_2 ? 'SHA-256 (0x01 || левый || правый)' : 'SHA-512';
+}
+
+// displayMerklePath отображает путь от листа до корня и возвращает вычисленный корень.
+// path — узлы доказательства из /api/v1/votings/{id}/ballots/{label}/proof:
+// узел с direction === 'right' хешируется справа от текущего хеша, 'left' — слева
+export async function displayMerklePath(leafHash, path, version = TREE_VERSION_1) {
     const container = document.getElementById('merkleContainer');
     container.innerHTML = '';
 
-    let currentHash = merklePathData[0].Hash;
+    let currentHash = leafHash;
 
-    merklePathData.forEach((node, index) => {
+    for (const node of path) {
         const levelDiv = document.createElement('div');
         levelDiv.className = 'level';
 
@@ -19,124 +68,96 @@ export function displayMerklePath(merklePathData) {
         // Текущий узел
         const currentNodeDiv = document.createElement('div');
         currentNodeDiv.className = 'node current-node';
-
-        const currentDirectionDiv = document.createElement('div');
-        currentDirectionDiv.className = 'direction';
-        currentDirectionDiv.textContent = 'Текущий хеш';
-
-        const currentHashDiv = document.createElement('div');
-        currentHashDiv.className = 'hash';
-        currentHashDiv.textContent = currentHash.substring(0, 20) + '...';
-
-        currentNodeDiv.appendChild(currentDirectionDiv);
-        currentNodeDiv.appendChild(currentHashDiv);
-
-        // Добавляем узлы в правильном порядке
-        if (index < merklePathData.length - 1) {
-            if (!node.IsRight) {
-                hashCombination.appendChild(currentNodeDiv);
-
-                const hashContainer = document.createElement('div');
-                hashContainer.className = 'hash-container';
-
-                const arrow = document.createElement('div');
-                arrow.className = 'hash-arrow';
-                arrow.textContent = '→';
-
-                const popupResult = document.createElement('div');
-                popupResult.className = 'popup-result';
-                const nextHash = calculateSHA512(currentHash, merklePathData[index + 1].Hash);
-                popupResult.innerHTML = `
-                    <div class="popup-title">Детали хеширования</div>
-                    <div class="hash-details">Левый хеш: ${currentHash}</div>
-                    <div class="hash-details">Правый хеш: ${merklePathData[index + 1].Hash}</div>
-                    <div class="hash-details">Порядок объединения: ${currentHash} + ${merklePathData[index + 1].Hash}</div>
-                    <div class="hash-details">Результат SHA-512:</div>
-                    <div class="full-hash">${nextHash}</div>
-                `;
-
-                hashContainer.appendChild(arrow);
-                hashContainer.appendChild(popupResult);
-                hashCombination.appendChild(hashContainer);
-
-                const siblingNode = document.createElement('div');
-                siblingNode.className = 'node sibling-node';
-                siblingNode.innerHTML = `
-                    <div class="direction">Правый сосед</div>
-                    <div class="hash">${merklePathData[index + 1].Hash.substring(0, 20)}...</div>
-                `;
-                hashCombination.appendChild(siblingNode);
-
-                currentHash = nextHash;
-            } else {
-                const siblingNode = document.createElement('div');
-                siblingNode.className = 'node sibling-node';
-                siblingNode.innerHTML = `
-                    <div class="direction">Левый сосед</div>
-                    <div class="hash">${merklePathData[index + 1].Hash.substring(0, 20)}...</div>
-                `;
-                hashCombination.appendChild(siblingNode);
-
-                const hashContainer = document.createElement('div');
-                hashContainer.className = 'hash-container';
-
-                const arrow = document.createElement('div');
-                arrow.className = 'hash-arrow';
-                arrow.textContent = '→';
-
-                const popupResult = document.createElement('div');
-                popupResult.className = 'popup-result';
-                const nextHash = calculateSHA512(merklePathData[index + 1].Hash, currentHash);
-                popupResult.innerHTML = `
-                    <div class="popup-title">Детали хеширования</div>
-                    <div class="hash-details">Левый хеш: ${merklePathData[index + 1].Hash}</div>
-                    <div class="hash-details">Правый хеш: ${currentHash}</div>
-                    <div class="hash-details">Порядок объединения: ${merklePathData[index + 1].Hash} + ${currentHash}</div>
-                    <div class="hash-details">Результат SHA-512:</div>
-                    <div class="full-hash">${nextHash}</div>
-                `;
-
-                hashContainer.appendChild(arrow);
-                hashContainer.appendChild(popupResult);
-                hashCombination.appendChild(hashContainer);
-
-                hashCombination.appendChild(currentNodeDiv);
-
-                currentHash = nextHash;
-            }
+        currentNodeDiv.innerHTML = `
+            <div class="direction">Текущий хеш</div>
+            <div class="hash">${currentHash.substring(0, 20)}...</div>
+        `;
+
+        const isRight = node.direction === 'right';
+        const left = isRight ? currentHash : node.hash;
+        const right = isRight ? node.hash : currentHash;
+        const nextHash = await hashNode(version, left, right);
+
+        const siblingNode = document.createElement('div');
+        siblingNode.className = 'node sibling-node';
+        siblingNode.innerHTML = `
+            <div class="direction">${isRight ? 'Правый сосед' : 'Левый сосед'}</div>
+            <div class="hash">${node.hash.substring(0, 20)}...</div>
+        `;
+
+        const hashContainer = document.createElement('div');
+        hashContainer.className = 'hash-container';
+
+        const arrow = document.createElement('div');
+        arrow.className = 'hash-arrow';
+        arrow.textContent = '→';
+
+        const popupResult = document.createElement('div');
+        popupResult.className = 'popup-result';
+        popupResult.innerHTML = `
+            <div class="popup-title">Детали хеширования</div>
+            <div class="hash-details">Левый хеш: ${left}</div>
+            <div class="hash-details">Правый хеш: ${right}</div>
+            <div class="hash-details">Порядок объединения: ${left} + ${right}</div>
+            <div class="hash-details">Результат ${hashName(version)}:</div>
+            <div class="full-hash">${nextHash}</div>
+        `;
+
+        hashContainer.appendChild(arrow);
+        hashContainer.appendChild(popupResult);
+
+        // Узлы выводятся в порядке объединения
+        if (isRight) {
+            hashCombination.appendChild(currentNodeDiv);
+            hashCombination.appendChild(hashContainer);
+            hashCombination.appendChild(siblingNode);
         } else {
-            // Последний узел (корневой хеш)
-            const rootNode = document.createElement('div');
-            rootNode.className = 'node root-node';
-            rootNode.innerHTML = `
-                <div class="direction">Корневой хеш</div>
-                <div class="hash">${currentHash.substring(0, 20)}...</div>
-            `;
-
-            const hashContainer = document.createElement('div');
-            hashContainer.className = 'hash-container';
-            hashContainer.appendChild(rootNode);
-
-            const popupResult = document.createElement('div');
-            popupResult.className = 'popup-result';
-            popupResult.innerHTML = `
-                <div class="popup-title">Корневой хеш дерева Меркла</div>
-                <div class="full-hash">${currentHash}</div>
-            `;
-
-            hashContainer.appendChild(popupResult);
+            hashCombination.appendChild(siblingNode);
             hashCombination.appendChild(hashContainer);
+            hashCombination.appendChild(currentNodeDiv);
         }
 
         levelDiv.appendChild(hashCombination);
 
-        if (index < merklePathData.length - 1) {
-            const arrow = document.createElement('div');
-            arrow.className = 'arrow';
-            arrow.textContent = '↓';
-            levelDiv.appendChild(arrow);
-        }
+        const levelArrow = document.createElement('div');
+        levelArrow.className = 'arrow';
+        levelArrow.textContent = '↓';
+        levelDiv.appendChild(levelArrow);
 
         container.appendChild(levelDiv);
-    });
-}
\ No newline at end of file
+
+        currentHash = nextHash;
+    }
+
+    // Корневой хеш
+    const levelDiv = document.createElement('div');
+    levelDiv.className = 'level';
+
+    const hashCombination = document.createElement('div');
+    hashCombination.className = 'hash-combination';
+
+    const hashContainer = document.createElement('div');
+    hashContainer.className = 'hash-container';
+
+    const rootNode = document.createElement('div');
+    rootNode.className = 'node root-node';
+    rootNode.innerHTML = `
+        <div class="direction">Корневой хеш</div>
+        <div class="hash">${currentHash.substring(0, 20)}...</div>
+    `;
+    hashContainer.appendChild(rootNode);
+
+    const popupResult = document.createElement('div');
+    popupResult.className = 'popup-result';
+    popupResult.innerHTML = `
+        <div class="popup-title">Корневой хеш дерева Меркла</div>
+        <div class="full-hash">${currentHash}</div>
+    `;
+    hashContainer.appendChild(popupResult);
+
+    hashCombination.appendChild(hashContainer);
+    levelDiv.appendChild(hashCombination);
+    container.appendChild(levelDiv);
+
+    return currentHash;
+}
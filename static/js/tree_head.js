@@ -0,0 +1,71 @@
+// Проверка подписи опубликованного корня дерева Меркла, см. internal/crypto/merklie/tree_head.go
+
+// v2 подписывает также корни доски и записей замен; v1 — корни, опубликованные до их введения
+const TREE_HEAD_CONTEXT = 'ev-tree-head-v2';
+const TREE_HEAD_CONTEXT_V1 = 'ev-tree-head-v1';
+
+function base64ToBytes(value) {
+    return Uint8Array.from(atob(value), c => c.charCodeAt(0));
+}
+
+// Подписываемое сообщение; формат совпадает с TreeHead.Message на сервере
+export function treeHeadMessage(head) {
+    const fields = [
+        head.voting_id,
+        head.tree_version,
+        head.tree_size,
+        head.root_value,
+        head.timestamp,
+    ];
+    if (head.board_root == null || head.board_size == null || head.revocation_root == null) {
+        return [TREE_HEAD_CONTEXT_V1, ...fields].join('\n');
+    }
+    return [TREE_HEAD_CONTEXT, ...fields, head.board_root, head.board_size, head.revocation_root].join('\n');
+}
+
+// Открытый ключ Счетчика публикуется отдельно от корней
+export async function fetchTreeHeadKey() {
+    const response = await fetch('/api/v1/tree-head-key');
+    if (!response.ok) {
+        throw new Error('tree head key is not published');
+    }
+    const data = await response.json();
+    return data.public_key;
+}
+
+export async function verifyTreeHead(head, publicKey) {
+    const key = await crypto.subtle.importKey('raw', base64ToBytes(publicKey), { name: 'Ed25519' }, false, ['verify']);
+    return crypto.subtle.verify(
+        { name: 'Ed25519' },
+        key,
+        base64ToBytes(head.signature),
+        new TextEncoder().encode(treeHeadMessage(head)),
+    );
+}
+
+// showTreeHeadStatus проверяет подпись корня и выводит результат в element
+export async function showTreeHeadStatus(element, head) {
+    if (head == null) {
+        element.textContent = 'ℹ️ Корень опубликован до введения подписей и не подписан';
+        return;
+    }
+
+    let publicKey;
+    try {
+        publicKey = await fetchTreeHeadKey();
+    } catch (e) {
+        element.textContent = '❌ Не удалось получить открытый ключ Счетчика';
+        return;
+    }
+
+    try {
+        if (await verifyTreeHead(head, publicKey)) {
+            element.textContent = '✅ Подпись корня Счетчиком подтверждена';
+        } else {
+            element.textContent = '❌ Подпись корня Счетчиком не подтверждена';
+        }
+    } catch (e) {
+        // Ed25519 в WebCrypto поддерживается не всеми браузерами
+        element.textContent = 'ℹ️ Браузер не поддерживает проверку подписей Ed25519';
+    }
+}
@@ -1,16 +1,32 @@
 import { modPow, modInverse, bigIntToBase64, base64ToBigInt, computeDigest } from './math.js';
 
+const DECRYPTION_CHALLENGE_BITS = 256n;
 
+// Проверка доказательства корректного расшифрования: z^(n^s) ≡ a·(C·g^(-m))^e mod n^(s+1).
+// При s = 1 (Paillier) это z^n ≡ a·(C·g^(-m))^e mod n^2
+export async function verifyDecryptionProof(C, m, n, proof, s = 1) {
+    if (!proof || !proof.a || !proof.z) {
+        return false;
+    }
 
-export function verifyValue(C, r_prime, n) {
-    const R = C % n;
-    return modPow(r_prime, n, n) == R;
-}
+    const ns = n ** BigInt(s);
+    const modulus = ns * n;
+    const a = base64ToBigInt(proof.a);
+    const z = base64ToBigInt(proof.z);
+
+    if (m < 0n || m >= ns || z <= 0n || z >= n || a <= 0n || a >= modulus) {
+        return false;
+    }
+
+    // При s = 1 g^m = 1 + m·n mod n^2
+    const gm = s > 1 ? modPow(n + 1n, m, modulus) : (1n + m * n) % modulus;
+    const u = (C * modInverse(gm, modulus)) % modulus;
 
-export function compute_m_from_proof(C, r_prime, n) {
-    const N_squared = n * n;
-    const r_prime_inv_N = modPow(r_prime, -n, N_squared);
-    const numerator = (C * r_prime_inv_N) % N_squared;
-    const m = ((numerator - 1) / n) % n;
-    return m;
-}
\ No newline at end of file
+    // s входит в челлендж только для схемы Дамгорда–Юрика
+    const challengeValues = s > 1 ? [n, BigInt(s), C, m, a] : [n, C, m, a];
+    const e = (await computeDigest(challengeValues)) % (1n << DECRYPTION_CHALLENGE_BITS);
+
+    const left = modPow(z, ns, modulus);
+    const right = (a * modPow(u, e, modulus)) % modulus;
+    return left === right;
+}
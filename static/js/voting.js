@@ -1,6 +1,6 @@
-import { modPow, bigIntToBase64, base64ToBigInt, computeDigest } from './math.js';
+import { bigIntToBase64, base64ToBigInt, computeDigest } from './math.js';
 import { blindBallot, unblindSignature, verifySignatureWithMultiplier } from './rsa.js';
-import { generateProof } from './zkp.js';
+import { encryptMessage, generateProof, encryptChoices, combineChoices, generateMultiChoiceProof, encryptPoints, generatePointsProof, encryptRanking, generateRankingProof } from './zkp.js';
 import { getUserData, userToNonce, getOldVotingParams } from './profile.js';
 import QRCode from "https://esm.sh/qrcode@1.5.3";
 
@@ -11,6 +11,7 @@ export const EV_STATE = {
     vote_variants: null,
     enc_vote: null,
     zkp_proof: null,
+    choices_proof: null,
     label: null,
     label_sig: null,
     oldVotingParams: null,
@@ -20,17 +21,81 @@ export const EV_STATE = {
 export function generateVoteVariants(base, options_amount, pailierPublicKey) {
     const voteVariants = [];
     for (let i = 0; i < options_amount; i++) {
-        voteVariants.push(modPow(2n, base * BigInt(i), pailierPublicKey.n ** 2n));
+        // Варианты — открытые тексты из Z_(n^s); CheckBase на сервере гарантирует, что они меньше n^s
+        voteVariants.push(2n ** (base * BigInt(i)));
     }
     return voteVariants;
 }
 
+// Бюллетень с выбором нескольких вариантов, см. models.Voting.IsMultiChoice
+export function isMultiChoice(params) {
+    return params.voting_type === 'approval' || params.voting_type === 'multi_choice';
+}
+
+// Бюллетень с распределением баллов, см. models.Voting.IsCumulative
+export function isCumulative(params) {
+    return params.voting_type === 'cumulative';
+}
+
+// Баллы вариантов или null, если баллы не целые, выходят за диапазон или в сумме не равны points
+function selectedPoints(options_amount, points) {
+    const distribution = [];
+    for (let option = 0; option < options_amount; option++) {
+        const value = Number(document.getElementById(`option${option}`)?.value);
+        if (!Number.isInteger(value) || value < 0 || value > points) {
+            return null;
+        }
+        distribution.push(value);
+    }
+    return distribution.reduce((sum, p) => sum + p, 0) === points ? distribution : null;
+}
+
+// Ранжированный бюллетень, см. models.Voting.IsRanked
+export function isRanked(params) {
+    return params.voting_type === 'ranked';
+}
+
+// Ранжирование по выбранным местам или null, если места расставлены не всем вариантам или повторяются
+function selectedRanking(options_amount) {
+    const ranking = new Array(options_amount).fill(null);
+    for (let option = 0; option < options_amount; option++) {
+        const place = parseInt(document.getElementById(`option${option}`)?.value);
+        if (isNaN(place) || ranking[place] !== null) {
+            return null;
+        }
+        ranking[place] = option;
+    }
+    return ranking;
+}
+
 function showConfirmation() {
-    const selectedOption = document.querySelector('input[name="vote"]:checked');
-    if (!selectedOption) {
+    if (isCumulative(EV_STATE.EV_STATIC_PARAMS)) {
+        const { options_amount, max_choices } = EV_STATE.EV_STATIC_PARAMS;
+        if (!selectedPoints(options_amount, max_choices)) {
+            alert(`Распределите между вариантами ровно ${max_choices} баллов`);
+            return;
+        }
+        document.getElementById('confirmationModal').style.display = 'flex';
+        return;
+    }
+    if (isRanked(EV_STATE.EV_STATIC_PARAMS)) {
+        if (!selectedRanking(EV_STATE.EV_STATIC_PARAMS.options_amount)) {
+            alert('Расставьте всем вариантам разные места');
+            return;
+        }
+        document.getElementById('confirmationModal').style.display = 'flex';
+        return;
+    }
+
+    const selectedOptions = document.querySelectorAll('input[name="vote"]:checked');
+    if (selectedOptions.length === 0) {
         alert('Пожалуйста, выберите вариант ответа');
         return;
     }
+    if (selectedOptions.length > EV_STATE.EV_STATIC_PARAMS.max_choices) {
+        alert(`Можно отметить не больше ${EV_STATE.EV_STATIC_PARAMS.max_choices} вариантов`);
+        return;
+    }
 
     document.getElementById('confirmationModal').style.display = 'flex';
 }
@@ -71,7 +136,7 @@ export async function initializeVoting(params) {
 
         // Деактивируем форму голосования и кнопки
         const form = document.getElementById('votingForm');
-        const inputs = form.querySelectorAll('input[type="radio"]');
+        const inputs = form.querySelectorAll('[name="vote"]');
         inputs.forEach(input => input.disabled = true);
         document.querySelector('.button.processVotingButton').disabled = true;
 
@@ -139,44 +204,183 @@ export async function initializeVoting(params) {
     }
 
     async function prepareVote() {
+        if (isMultiChoice(params)) {
+            return prepareMultiChoiceVote();
+        }
+        if (isCumulative(params)) {
+            return preparePointsVote();
+        }
+        if (isRanked(params)) {
+            return prepareRankedVote();
+        }
+
         const selectedOption = document.querySelector('input[name="vote"]:checked');
         if (!selectedOption) {
             alert('Пожалуйста, выберите вариант ответа');
             return false;
         }
-
         const selectedIndex = parseInt(selectedOption.value);
+
         const messageToEncrypt = EV_STATE.vote_variants[selectedIndex];
-        EV_STATE.zkp_proof = await generateProof(pailierPublicKey.n, EV_STATE.vote_variants, messageToEncrypt, challenge_bits);
+
+        // Сначала шифруем, чтобы метка была известна до построения доказательства
+        const encrypted = encryptMessage(pailierPublicKey.n, messageToEncrypt, pailierPublicKey.s);
+
+        EV_STATE.nonce = await userToNonce(EV_STATE.user);
+        console.log("EV_STATE.nonce: ", EV_STATE.nonce);
+        EV_STATE.label = await computeDigest([EV_STATE.nonce, encrypted.ciphertext]);
+
+        // Доказательство привязано к голосованию и метке бюллетеня
+        EV_STATE.zkp_proof = await generateProof(pailierPublicKey.n, EV_STATE.vote_variants, messageToEncrypt, challenge_bits, encrypted, {
+            voting_id: voting_id,
+            label: EV_STATE.label,
+        }, pailierPublicKey.s);
+        EV_STATE.choices_proof = null;
+        EV_STATE.enc_vote = encrypted.ciphertext;
         console.log("EV_STATE.zkp_proof: ", EV_STATE.zkp_proof);
 
         return true
     }
 
-    async function signBallotByRegistrator() {
-        if (!EV_STATE.zkp_proof) {
-            const errorMessage = document.querySelector('#step2 .error-message');
-            errorMessage.textContent = 'ZKP-доказательство не сгенерировано';
-            errorMessage.style.display = 'block';
+    // Каждый вариант отмечается отдельно; бюллетень собирается из шифротекстов отметок,
+    // а EV_STATE.zkp_proof доказывает допустимость числа отмеченных вариантов
+    async function prepareMultiChoiceVote() {
+        const selected = Array.from({ length: options_amount }, (_, i) =>
+            document.getElementById(`option${i}`)?.checked ?? false);
+        const selectedCount = selected.filter(Boolean).length;
+        if (selectedCount === 0 || selectedCount > params.max_choices) {
+            alert(`Отметьте от 1 до ${params.max_choices} вариантов`);
             return false;
         }
 
+        const encryptedChoices = encryptChoices(pailierPublicKey.n, selected, pailierPublicKey.s);
+        EV_STATE.enc_vote = combineChoices(pailierPublicKey.n, encryptedChoices, base, pailierPublicKey.s);
+
         EV_STATE.nonce = await userToNonce(EV_STATE.user);
-        const ciphertext = EV_STATE.zkp_proof.ciphertext;
-        console.log("EV_STATE.nonce: ", EV_STATE.nonce);
+        EV_STATE.label = await computeDigest([EV_STATE.nonce, EV_STATE.enc_vote]);
 
-        EV_STATE.label = await computeDigest([EV_STATE.nonce, ciphertext]);
+        const proof = await generateMultiChoiceProof(pailierPublicKey.n, selected, encryptedChoices, params.max_choices, challenge_bits, {
+            voting_id: voting_id,
+            label: EV_STATE.label,
+        }, pailierPublicKey.s);
+        EV_STATE.zkp_proof = proof.total;
+        EV_STATE.choices_proof = proof.choices;
+        console.log("EV_STATE.choices_proof: ", EV_STATE.choices_proof);
 
+        return true
+    }
 
-        const { rsaSignPublicKey } = EV_STATE.EV_STATIC_PARAMS;
+    // Баллы каждого варианта шифруются отдельно, как отметки бюллетеня с несколькими вариантами;
+    // EV_STATE.zkp_proof доказывает, что распределены ровно max_choices баллов
+    async function preparePointsVote() {
+        const distribution = selectedPoints(options_amount, params.max_choices);
+        if (!distribution) {
+            alert(`Распределите между вариантами ровно ${params.max_choices} баллов`);
+            return false;
+        }
 
-        const blindedBallotData = blindBallot(EV_STATE.label, rsaSignPublicKey);
+        const encryptedChoices = encryptPoints(pailierPublicKey.n, distribution, pailierPublicKey.s);
+        EV_STATE.enc_vote = combineChoices(pailierPublicKey.n, encryptedChoices, base, pailierPublicKey.s);
+
+        EV_STATE.nonce = await userToNonce(EV_STATE.user);
+        EV_STATE.label = await computeDigest([EV_STATE.nonce, EV_STATE.enc_vote]);
 
+        const proof = await generatePointsProof(pailierPublicKey.n, distribution, encryptedChoices, params.max_choices, challenge_bits, {
+            voting_id: voting_id,
+            label: EV_STATE.label,
+        }, pailierPublicKey.s);
+        EV_STATE.zkp_proof = proof.total;
+        EV_STATE.choices_proof = proof.choices;
+        console.log("EV_STATE.choices_proof: ", EV_STATE.choices_proof);
 
+        return true
+    }
+
+    // Каждое место ранжирования шифруется отдельной строкой матрицы перестановки;
+    // EV_STATE.zkp_proof доказывает, что каждый вариант занимает ровно одно место
+    async function prepareRankedVote() {
+        const ranking = selectedRanking(options_amount);
+        if (!ranking) {
+            alert('Расставьте всем вариантам разные места');
+            return false;
+        }
+
+        const encryptedRows = encryptRanking(pailierPublicKey.n, ranking, EV_STATE.vote_variants, pailierPublicKey.s);
+        // Строка занимает options_amount ячеек, см. zkp.RankingBase
+        EV_STATE.enc_vote = combineChoices(pailierPublicKey.n, encryptedRows, base * BigInt(options_amount), pailierPublicKey.s);
+
+        EV_STATE.nonce = await userToNonce(EV_STATE.user);
+        EV_STATE.label = await computeDigest([EV_STATE.nonce, EV_STATE.enc_vote]);
+
+        const proof = await generateRankingProof(pailierPublicKey.n, ranking, encryptedRows, EV_STATE.vote_variants, challenge_bits, {
+            voting_id: voting_id,
+            label: EV_STATE.label,
+        }, pailierPublicKey.s);
+        EV_STATE.zkp_proof = proof.total;
+        EV_STATE.choices_proof = proof.choices;
+        console.log("EV_STATE.choices_proof: ", EV_STATE.choices_proof);
+
+        return true
+    }
+
+    // credentialWeight возвращает вес голосующего из подписанных IDP учетных данных TempID
+    function credentialWeight(credential) {
         try {
+            const payload = JSON.parse(atob(credential.credential));
+            return payload.weight > 1 ? payload.weight : 1;
+        } catch (error) {
+            console.error('Ошибка при разборе учетных данных TempID:', error);
+            return 1;
+        }
+    }
+
+    // signingKeyForWeight возвращает открытый ключ Регистратора для бюллетеней с весом weight
+    function signingKeyForWeight(params, weight) {
+        if (weight <= 1) {
+            return params.rsaSignPublicKey;
+        }
+        const weightClass = params.weight_classes.find(c => c.weight === BigInt(weight));
+        return weightClass ? weightClass.key : null;
+    }
+
+    async function signBallotByRegistrator() {
+        if (!EV_STATE.zkp_proof) {
+            const errorMessage = document.querySelector('#step2 .error-message');
+            errorMessage.textContent = 'ZKP-доказательство не сгенерировано';
+            errorMessage.style.display = 'block';
+            return false;
+        }
+
+        try {
+            // IDP подписывает TempID, Регистратор проверяет подпись без обращения к IDP
+            const credentialResponse = await fetch(`/auth/temp-id-credential?voting_id=${EV_STATE.EV_STATIC_PARAMS.voting_id}`, {
+                credentials: 'include',
+            });
+            if (!credentialResponse.ok) {
+                const errorMessage = document.querySelector('#step2 .error-message');
+                errorMessage.textContent = 'Не удалось получить подписанный TempID у IDP';
+                errorMessage.style.display = 'block';
+                throw new Error(`HTTP error! status: ${credentialResponse.status}`);
+            }
+            const credential = await credentialResponse.json();
+
+            // Вес голосующего указан в учетных данных; бюллетени каждого веса Регистратор подписывает своим ключом
+            EV_STATE.weight = credentialWeight(credential);
+            const signKey = signingKeyForWeight(EV_STATE.EV_STATIC_PARAMS, EV_STATE.weight);
+            if (!signKey) {
+                const errorMessage = document.querySelector('#step2 .error-message');
+                errorMessage.textContent = 'Для веса голосующего нет ключа подписи Регистратора';
+                errorMessage.style.display = 'block';
+                return false;
+            }
+            EV_STATE.sign_key = signKey;
+
+            const blindedBallotData = blindBallot(EV_STATE.label, signKey);
+
             const ballotData = {
                 voting_id: String(EV_STATE.EV_STATIC_PARAMS.voting_id),
                 blinded_ballot: bigIntToBase64(blindedBallotData.blindedMessage),
+                credential: credential,
             };
 
             const response = await fetch('/ballot/register', {
@@ -184,7 +388,6 @@ export async function initializeVoting(params) {
                 headers: {
                     'Content-Type': 'application/json',
                 },
-                credentials: 'include',
                 body: JSON.stringify(ballotData)
             });
 
@@ -213,10 +416,10 @@ export async function initializeVoting(params) {
             const unblindedSignature = unblindSignature(
                 blindedSignature,
                 blindedBallotData.r,
-                BigInt(rsaSignPublicKey.n)
+                BigInt(signKey.n)
             );
 
-            const isVerified = await verifySignatureWithMultiplier(EV_STATE.label, unblindedSignature, rsaSignPublicKey, EV_STATE.EV_STATIC_PARAMS.re_voting_multiplier);
+            const isVerified = await verifySignatureWithMultiplier(EV_STATE.label, unblindedSignature, signKey, EV_STATE.EV_STATIC_PARAMS.re_voting_multiplier);
 
 
             if (!isVerified) {
@@ -248,9 +451,9 @@ export async function initializeVoting(params) {
             return false;
         }
 
-        const { rsaSignPublicKey } = EV_STATE.EV_STATIC_PARAMS;
+        const signKey = EV_STATE.sign_key ?? EV_STATE.EV_STATIC_PARAMS.rsaSignPublicKey;
 
-        const isVerified = await verifySignatureWithMultiplier(EV_STATE.label, EV_STATE.label_sig, rsaSignPublicKey, EV_STATE.EV_STATIC_PARAMS.re_voting_multiplier);
+        const isVerified = await verifySignatureWithMultiplier(EV_STATE.label, EV_STATE.label_sig, signKey, EV_STATE.EV_STATIC_PARAMS.re_voting_multiplier);
         if (!isVerified) {
             const errorMessage = document.querySelector('#step3 .error-message');
             errorMessage.textContent = "Ошибка верификации подписи регистратора на клиенте";
@@ -260,14 +463,22 @@ export async function initializeVoting(params) {
 
         const voteData = {
             voting_id: EV_STATE.EV_STATIC_PARAMS.voting_id,
-            encrypted_ballot: bigIntToBase64(EV_STATE.zkp_proof.ciphertext),
+            encrypted_ballot: bigIntToBase64(EV_STATE.enc_vote),
             zkp_proof_e_vec: EV_STATE.zkp_proof.e_vec.map(e => bigIntToBase64(e)),
             zkp_proof_z_vec: EV_STATE.zkp_proof.z_vec.map(z => bigIntToBase64(z)),
             zkp_proof_a_vec: EV_STATE.zkp_proof.a_vec.map(a => bigIntToBase64(a)),
+            zkp_version: EV_STATE.zkp_proof.version,
             signature: bigIntToBase64(EV_STATE.label_sig),
             label: bigIntToBase64(EV_STATE.label),
             old_label: EV_STATE.oldVotingParams?.oldLabel,
             old_nonce: EV_STATE.oldVotingParams?.oldNonce,
+            weight: EV_STATE.weight > 1 ? EV_STATE.weight : undefined,
+            choices: EV_STATE.choices_proof?.map(choice => ({
+                ciphertext: bigIntToBase64(choice.ciphertext),
+                zkp_proof_e_vec: choice.e_vec.map(e => bigIntToBase64(e)),
+                zkp_proof_z_vec: choice.z_vec.map(z => bigIntToBase64(z)),
+                zkp_proof_a_vec: choice.a_vec.map(a => bigIntToBase64(a)),
+            })),
         };
 
         try {
@@ -281,8 +492,9 @@ export async function initializeVoting(params) {
             });
 
             if (!response.ok) {
+                const failure = await response.json().catch(() => null);
                 const errorMessage = document.querySelector('#step3 .error-message');
-                errorMessage.textContent = `Ошибка отправки бюллетеня Счетчику: ${response.status}`;
+                errorMessage.textContent = failure?.message ?? `Ошибка отправки бюллетеня Счетчику: ${response.status}`;
                 errorMessage.style.display = 'block';
                 throw new Error(`Ошибка отправки бюллетеня Счетчику: ${response.status}`);
             }
@@ -333,7 +545,7 @@ export async function initializeVoting(params) {
             document.cookie = `oldLabel_${EV_STATE.EV_STATIC_PARAMS.voting_id}=${labelBase64}; path=/; max-age=86400; samesite=strict`;
             document.cookie = `oldNonce_${EV_STATE.EV_STATIC_PARAMS.voting_id}=${nonceBase64}; path=/; max-age=86400; samesite=strict`;
             document.cookie = `oldLink_${EV_STATE.EV_STATIC_PARAMS.voting_id}=${link}; path=/; max-age=86400; samesite=strict`;
-            document.cookie = `oldEncryptedValue_${EV_STATE.EV_STATIC_PARAMS.voting_id}=${bigIntToBase64(EV_STATE.zkp_proof.ciphertext)}; path=/; max-age=86400; samesite=strict`;
+            document.cookie = `oldEncryptedValue_${EV_STATE.EV_STATIC_PARAMS.voting_id}=${bigIntToBase64(EV_STATE.enc_vote)}; path=/; max-age=86400; samesite=strict`;
 
             return true
         } catch (error) {
@@ -347,6 +559,16 @@ export async function initializeVoting(params) {
     // Инициализация UI и обработчиков событий
     function initializeUI() {
 
+        // Места ранжированного бюллетеня: от 1 до числа вариантов
+        document.querySelectorAll('.rank-select').forEach(select => {
+            for (let place = 0; place < options_amount; place++) {
+                const option = document.createElement('option');
+                option.value = String(place);
+                option.textContent = String(place + 1);
+                select.appendChild(option);
+            }
+        });
+
         // Обработчики событий для кнопок
         const processVotingButton = document.querySelector('.button.processVotingButton');
         const confirmButton = document.querySelector('.modal-button.confirm');
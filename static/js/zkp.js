@@ -1,8 +1,18 @@
 import { modPow, modInverse, randomBigInt, gcd, computeDigest } from './math.js';
 
-export async function generateProof(n, validMessages, messageToEncrypt, challenge_bits) {
-    const nn = BigInt(n) * BigInt(n);
-    const numOfMessages = validMessages.length;
+// Версии формата доказательства (совпадают с zkp.ProofVersion* на сервере)
+export const ZKP_VERSION_LEGACY = 1;
+export const ZKP_VERSION_CONTEXT = 2;
+
+// Модули схемы Дамгорда–Юрика: открытый текст по модулю n^s, шифротекст по модулю n^(s+1).
+// При s = 1 это n и n² схемы Paillier (см. zkp.Moduli на сервере)
+export function moduli(n, s = 1) {
+    const ns = BigInt(n) ** BigInt(s);
+    return { ns, nn: ns * BigInt(n) };
+}
+
+export function encryptMessage(n, messageToEncrypt, s = 1) {
+    const { ns, nn } = moduli(n, s);
 
     let r;
     do {
@@ -10,7 +20,41 @@ export async function generateProof(n, validMessages, messageToEncrypt, challeng
     } while (gcd(r, n) !== 1n);
 
     const g = n + 1n;
-    const ciphertext = (modPow(g, messageToEncrypt, nn) * modPow(r, n, nn)) % nn;
+    const ciphertext = (modPow(g, messageToEncrypt, nn) * modPow(r, ns, nn)) % nn;
+
+    return { ciphertext, r };
+}
+
+// Челлендж версии 2 привязан к n, шифротексту, допустимым сообщениям, голосованию и метке.
+// s добавляется после n только для схемы Дамгорда–Юрика
+export async function computeChallenge(a_vec, ciphertext, valid_messages, n, challenge_bits, context = null, s = 1) {
+    const twoToB = 2n ** BigInt(challenge_bits);
+
+    if (!context) {
+        return (await computeDigest(a_vec)) % twoToB;
+    }
+
+    const values = [
+        BigInt(ZKP_VERSION_CONTEXT),
+        n,
+        ...(s > 1 ? [BigInt(s)] : []),
+        ciphertext,
+        BigInt(valid_messages.length),
+        ...valid_messages,
+        BigInt(context.voting_id),
+        context.label,
+        ...a_vec,
+    ];
+    return (await computeDigest(values)) % twoToB;
+}
+
+// context = { voting_id, label } — если задан, строится доказательство версии 2
+export async function generateProof(n, validMessages, messageToEncrypt, challenge_bits, encrypted = null, context = null, s = 1) {
+    const { ns, nn } = moduli(n, s);
+    const numOfMessages = validMessages.length;
+
+    const { ciphertext, r } = encrypted ?? encryptMessage(n, messageToEncrypt, s);
+    const g = n + 1n;
 
     const uiVec = [];
     for (const m of validMessages) {
@@ -45,10 +89,10 @@ export async function generateProof(n, validMessages, messageToEncrypt, challeng
 
     for (let i = 0; i < numOfMessages; i++) {
         if (i === trueIndex) {
-            const ai = modPow(w, n, nn);
+            const ai = modPow(w, ns, nn);
             aiVec.push(ai);
         } else {
-            const ziN = modPow(ziVec[j], n, nn);
+            const ziN = modPow(ziVec[j], ns, nn);
             const uiEi = modPow(uiVec[i], eiVec[j], nn);
             const uiEiInv = modInverse(uiEi, nn);
             const ai = (ziN * uiEiInv) % nn;
@@ -57,8 +101,7 @@ export async function generateProof(n, validMessages, messageToEncrypt, challeng
         }
     }
 
-    const hash = await computeDigest(aiVec);
-    const chal = hash % twoToB;
+    const chal = await computeChallenge(aiVec, ciphertext, validMessages, n, challenge_bits, context, s);
 
 
     let eiSum = 0n;
@@ -91,22 +134,22 @@ export async function generateProof(n, validMessages, messageToEncrypt, challeng
         z_vec: zVec,
         a_vec: aiVec,
         ciphertext: ciphertext,
-        valid_messages: validMessages
+        valid_messages: validMessages,
+        version: context ? ZKP_VERSION_CONTEXT : ZKP_VERSION_LEGACY
     };
 }
 
-export async function verify(e_vec, z_vec, a_vec, ciphertext, valid_messages, n, challenge_bits) {
+export async function verify(e_vec, z_vec, a_vec, ciphertext, valid_messages, n, challenge_bits, context = null, s = 1) {
     console.log("Проверка всех доказательств");
     const numOfMessages = valid_messages.length;
     const B = challenge_bits;
     const twoToB = BigInt(2) ** BigInt(B);
-    const nn = n * n;
+    const { ns, nn } = moduli(n, s);
     const g = n + 1n;
 
 
 
-    const hash = await computeDigest(a_vec);
-    const chal = hash % twoToB;
+    const chal = await computeChallenge(a_vec, ciphertext, valid_messages, n, challenge_bits, context, s);
 
 
     let eiSum = 0n;
@@ -133,7 +176,7 @@ export async function verify(e_vec, z_vec, a_vec, ciphertext, valid_messages, n,
 
     let result = true;
     for (let i = 0; i < numOfMessages; i++) {
-        const ziN = modPow(z_vec[i], n, nn);
+        const ziN = modPow(z_vec[i], ns, nn);
         const uiEi = modPow(uiVec[i], e_vec[i], nn);
         const rightSide = (a_vec[i] * uiEi) % nn;
 
@@ -148,4 +191,92 @@ export async function verify(e_vec, z_vec, a_vec, ciphertext, valid_messages, n,
 
     console.log("\n=== Все проверки пройдены успешно ===");
     return result;
-}
\ No newline at end of file
+}
+// Бюллетень с выбором нескольких вариантов, см. internal/crypto/zkp/multi_choice.go.
+// Отметка каждого варианта шифруется отдельно, бюллетень — произведение c_i^(2^(base*i)) mod n^(s+1)
+export function encryptChoices(n, selected, s = 1) {
+    return selected.map(isSelected => encryptMessage(n, isSelected ? 1n : 0n, s));
+}
+
+export function combineChoices(n, encryptedChoices, base, s = 1) {
+    const { nn } = moduli(n, s);
+    let ballot = 1n;
+    encryptedChoices.forEach((choice, i) => {
+        ballot = (ballot * modPow(choice.ciphertext, 2n ** (BigInt(base) * BigInt(i)), nn)) % nn;
+    });
+    return ballot;
+}
+
+// Доказательства 0/1 для каждого варианта и доказательство, что отмечено от 0 до maxChoices вариантов.
+// Произведение шифротекстов шифрует число отметок со случайностью Π r_i
+export async function generateMultiChoiceProof(n, selected, encryptedChoices, maxChoices, challenge_bits, context, s = 1) {
+    const { nn } = moduli(n, s);
+    const choiceMessages = [0n, 1n];
+
+    const choices = [];
+    let product = 1n;
+    let productR = 1n;
+    let total = 0n;
+    for (let i = 0; i < selected.length; i++) {
+        const message = selected[i] ? 1n : 0n;
+        choices.push(await generateProof(n, choiceMessages, message, challenge_bits, encryptedChoices[i], context, s));
+        product = (product * encryptedChoices[i].ciphertext) % nn;
+        productR = (productR * encryptedChoices[i].r) % n;
+        total += message;
+    }
+
+    const totalMessages = Array.from({ length: maxChoices + 1 }, (_, k) => BigInt(k));
+    const totalProof = await generateProof(n, totalMessages, total, challenge_bits, { ciphertext: product, r: productR }, context, s);
+
+    return { choices, total: totalProof };
+}
+
+// Бюллетень с распределением баллов, см. internal/crypto/zkp/cumulative.go.
+// Баллы каждого варианта шифруются отдельно, бюллетень собирается combineChoices
+export function encryptPoints(n, distribution, s = 1) {
+    return distribution.map(p => encryptMessage(n, BigInt(p), s));
+}
+
+// Доказательства, что у каждого варианта от 0 до points баллов, и что сумма баллов равна points
+export async function generatePointsProof(n, distribution, encryptedChoices, points, challenge_bits, context, s = 1) {
+    const { nn } = moduli(n, s);
+    const pointsMessages = Array.from({ length: points + 1 }, (_, k) => BigInt(k));
+
+    const choices = [];
+    let product = 1n;
+    let productR = 1n;
+    for (let i = 0; i < distribution.length; i++) {
+        choices.push(await generateProof(n, pointsMessages, BigInt(distribution[i]), challenge_bits, encryptedChoices[i], context, s));
+        product = (product * encryptedChoices[i].ciphertext) % nn;
+        productR = (productR * encryptedChoices[i].r) % n;
+    }
+
+    const totalProof = await generateProof(n, [BigInt(points)], BigInt(points), challenge_bits, { ciphertext: product, r: productR }, context, s);
+
+    return { choices, total: totalProof };
+}
+
+// Строки ранжированного бюллетеня, см. zkp.EncryptRanking: строка места r шифрует 2^(base*o_r)
+export function encryptRanking(n, ranking, rankingMessages, s = 1) {
+    return ranking.map(option => encryptMessage(n, rankingMessages[option], s));
+}
+
+// Доказательства, что каждая строка шифрует одну из rankingMessages, и что произведение строк шифрует
+// их сумму — каждый вариант занимает ровно одно место (zkp.ProveRanking)
+export async function generateRankingProof(n, ranking, encryptedRows, rankingMessages, challenge_bits, context, s = 1) {
+    const { nn } = moduli(n, s);
+    const total = rankingMessages.reduce((sum, message) => sum + message, 0n);
+
+    const choices = [];
+    let product = 1n;
+    let productR = 1n;
+    for (let place = 0; place < ranking.length; place++) {
+        choices.push(await generateProof(n, rankingMessages, rankingMessages[ranking[place]], challenge_bits, encryptedRows[place], context, s));
+        product = (product * encryptedRows[place].ciphertext) % nn;
+        productR = (productR * encryptedRows[place].r) % n;
+    }
+
+    const totalProof = await generateProof(n, [total], total, challenge_bits, { ciphertext: product, r: productR }, context, s);
+
+    return { choices, total: totalProof };
+}